@@ -0,0 +1,145 @@
+#!/bin/bash
+
+# 任务调度顺序性能对比脚本
+# 用法: ./bench-order.sh [源目录]
+# 功能: 分别使用 --order manifest、largest-first、locality 运行 cp、tar、untar，
+#       对比总耗时，并检查复制和解压结果与源目录一致
+#
+# 参数:
+#   源目录  可选，未指定时生成一个测试目录：大量小文件，再加上按路径排在最后的几个大文件，
+#           manifest 顺序下大文件最后才开始复制，形成只有少数协程在工作的长尾
+#
+# 环境变量:
+#   BENCH_RUNS         每种配置运行的次数，取最快的一次（默认 3）
+#   BENCH_CONCURRENCY  并发数（默认 CPU 核数）
+#   BENCH_SMALL        生成测试目录时的小文件数量（默认 20000）
+#   BENCH_SMALL_SIZE   每个小文件的大小，单位 KB（默认 16）
+#   BENCH_LARGE        生成测试目录时的大文件数量（默认 2）
+#   BENCH_LARGE_SIZE   每个大文件的大小，单位 MB（默认 512）
+#
+# 注意: cp 使用 --chunk-threshold 0 关闭大文件分块复制，单独体现调度顺序的效果；
+#       多次运行时源文件已在页缓存中，测得的是热缓存下的耗时
+
+set -e
+
+SCRIPT_DIR=$(cd "$(dirname "$0")" && pwd)
+SOURCE_DIR="$1"
+RUNS="${BENCH_RUNS:-3}"
+CONCURRENCY="${BENCH_CONCURRENCY:-$(getconf _NPROCESSORS_ONLN 2>/dev/null || echo 4)}"
+ORDERS="manifest largest-first locality"
+
+TEMP_DIR=$(mktemp -d)
+trap "rm -rf $TEMP_DIR" EXIT
+
+echo "=========================================="
+echo "任务调度顺序性能对比"
+echo "=========================================="
+
+# 编译当前代码
+echo "编译当前代码..."
+(cd "$SCRIPT_DIR" && go build -o "$TEMP_DIR/p-tool" .)
+P_TOOL="$TEMP_DIR/p-tool"
+
+# 准备测试目录
+if [ -z "$SOURCE_DIR" ]; then
+    SMALL="${BENCH_SMALL:-20000}"
+    SMALL_SIZE="${BENCH_SMALL_SIZE:-16}"
+    LARGE="${BENCH_LARGE:-2}"
+    LARGE_SIZE="${BENCH_LARGE_SIZE:-512}"
+    SOURCE_DIR="$TEMP_DIR/tree"
+    echo "生成测试目录: $SMALL 个 ${SMALL_SIZE}KB 小文件，$LARGE 个 ${LARGE_SIZE}MB 大文件..."
+    head -c $((SMALL_SIZE * 1024)) /dev/urandom > "$TEMP_DIR/small.bin"
+    for ((i = 0; i < SMALL; i++)); do
+        dir="$SOURCE_DIR/a/d$((i / 500))"
+        mkdir -p "$dir"
+        cp "$TEMP_DIR/small.bin" "$dir/f$i"
+    done
+    # 大文件放在按路径排序最后的目录中
+    mkdir -p "$SOURCE_DIR/z"
+    for ((i = 0; i < LARGE; i++)); do
+        head -c $((LARGE_SIZE * 1024 * 1024)) /dev/urandom > "$SOURCE_DIR/z/large$i.bin"
+    done
+    rm -f "$TEMP_DIR/small.bin"
+elif [ ! -d "$SOURCE_DIR" ]; then
+    echo "错误: 目录不存在: $SOURCE_DIR"
+    exit 1
+fi
+
+echo "源目录: $SOURCE_DIR"
+echo "并发数: $CONCURRENCY"
+echo "运行次数: $RUNS（取最快）"
+echo ""
+
+# run_bench 运行多次并输出最快的耗时（秒），每次运行前执行 $SETUP 清理输出
+run_bench() {
+    local best=""
+    for ((i = 0; i < RUNS; i++)); do
+        eval "$SETUP"
+        local start end elapsed
+        start=$(date +%s.%N)
+        "$@" > /dev/null
+        end=$(date +%s.%N)
+        elapsed=$(awk "BEGIN {printf \"%.3f\", $end - $start}")
+        if [ -z "$best" ] || awk "BEGIN {exit !($elapsed < $best)}"; then
+            best=$elapsed
+        fi
+    done
+    echo "$best"
+}
+
+# print_row 输出一行结果，加速比相对于 manifest 顺序
+print_row() {
+    local name=$1 elapsed=$2 base=$3
+    local speedup
+    speedup=$(awk "BEGIN {printf \"%.2f\", $base / $elapsed}")
+    printf "%-28s %12.3f %9sx\n" "$name" "$elapsed" "$speedup"
+}
+
+MISMATCH=0
+
+printf "%-28s %12s %10s\n" "配置" "耗时(秒)" "加速比"
+echo "------------------------------------------------------"
+
+# cp
+BASE=""
+for order in $ORDERS; do
+    SETUP="rm -rf '$TEMP_DIR/dest'"
+    elapsed=$(run_bench "$P_TOOL" cp "$SOURCE_DIR" "$TEMP_DIR/dest" --concurrency "$CONCURRENCY" --chunk-threshold 0 --order "$order")
+    [ -z "$BASE" ] && BASE=$elapsed
+    print_row "cp --order $order" "$elapsed" "$BASE"
+    if ! diff -r "$SOURCE_DIR" "$TEMP_DIR/dest" > /dev/null; then
+        echo "警告: cp --order $order 的结果与源目录不一致"
+        MISMATCH=1
+    fi
+done
+rm -rf "$TEMP_DIR/dest"
+
+# tar
+BASE=""
+for order in $ORDERS; do
+    SETUP="rm -f '$TEMP_DIR/out-$order.tar'"
+    elapsed=$(run_bench "$P_TOOL" tar "$SOURCE_DIR" "$TEMP_DIR/out-$order.tar" --concurrency "$CONCURRENCY" --order "$order")
+    [ -z "$BASE" ] && BASE=$elapsed
+    print_row "tar --order $order" "$elapsed" "$BASE"
+done
+
+# untar（使用 manifest 顺序生成的 tar 包，大文件位于 tar 包末尾）
+BASE=""
+for order in $ORDERS; do
+    SETUP="rm -rf '$TEMP_DIR/untar'"
+    elapsed=$(run_bench "$P_TOOL" untar "$TEMP_DIR/out-manifest.tar" "$TEMP_DIR/untar" --concurrency "$CONCURRENCY" --order "$order")
+    [ -z "$BASE" ] && BASE=$elapsed
+    print_row "untar --order $order" "$elapsed" "$BASE"
+    if ! diff -r "$SOURCE_DIR" "$TEMP_DIR/untar" > /dev/null; then
+        echo "警告: untar --order $order 的结果与源目录不一致"
+        MISMATCH=1
+    fi
+done
+
+echo ""
+if [ $MISMATCH -eq 0 ]; then
+    echo "结果一致: 各顺序复制和解压的结果与源目录完全相同"
+else
+    echo "警告: 部分结果与源目录不一致"
+    exit 1
+fi
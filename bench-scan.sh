@@ -0,0 +1,128 @@
+#!/bin/bash
+
+# 目录扫描性能对比脚本
+# 用法: ./bench-scan.sh [要扫描的目录] [基准版本]
+# 功能: 对比当前代码的并行扫描器与基准版本（默认为引入并行扫描器之前的串行扫描器）
+#       生成 manifest 的耗时，并检查两者输出的 manifest 是否一致
+#
+# 参数:
+#   要扫描的目录  可选，未指定时生成一个测试目录（规模由 BENCH_DIRS、BENCH_FILES 控制）
+#   基准版本      可选，git 版本号或已编译好的 p-tool 路径
+#
+# 环境变量:
+#   BENCH_RUNS         每种配置运行的次数，取最快的一次（默认 3）
+#   BENCH_CONCURRENCY  要测试的并发数列表（默认 "1 4 <CPU 核数>"）
+#   BENCH_DIRS         生成测试目录时的目录数量（默认 2000）
+#   BENCH_FILES        生成测试目录时每个目录的文件数量（默认 50）
+#
+# 注意: 多次运行时目录元数据已在页缓存中，测得的是热缓存下的耗时；
+#       在 NFS 等网络文件系统上运行更能体现并行扫描的收益
+
+set -e
+
+SCRIPT_DIR=$(cd "$(dirname "$0")" && pwd)
+SOURCE_DIR="$1"
+BASELINE="$2"
+RUNS="${BENCH_RUNS:-3}"
+CPUS=$(getconf _NPROCESSORS_ONLN 2>/dev/null || echo 4)
+CONCURRENCY_LIST="${BENCH_CONCURRENCY:-1 4 $CPUS}"
+
+TEMP_DIR=$(mktemp -d)
+trap "rm -rf $TEMP_DIR; git -C '$SCRIPT_DIR' worktree prune 2>/dev/null || true" EXIT
+
+echo "=========================================="
+echo "目录扫描性能对比"
+echo "=========================================="
+
+# 编译当前代码
+echo "编译当前代码..."
+(cd "$SCRIPT_DIR" && go build -o "$TEMP_DIR/p-tool-new" .)
+
+# 准备基准版本
+if [ -n "$BASELINE" ] && [ -x "$BASELINE" ]; then
+    cp "$BASELINE" "$TEMP_DIR/p-tool-base"
+    echo "基准版本: $BASELINE"
+else
+    if [ -z "$BASELINE" ]; then
+        # 默认使用引入并行扫描器之前的版本
+        BASELINE=$(git -C "$SCRIPT_DIR" log --diff-filter=A --format=%H -- cmd/scan.go | tail -1)
+        if [ -z "$BASELINE" ]; then
+            echo "错误: 无法确定基准版本，请手动指定"
+            exit 1
+        fi
+        BASELINE="${BASELINE}~1"
+    fi
+    echo "编译基准版本 $BASELINE..."
+    git -C "$SCRIPT_DIR" worktree add --detach -q "$TEMP_DIR/base-src" "$BASELINE"
+    (cd "$TEMP_DIR/base-src" && go build -o "$TEMP_DIR/p-tool-base" .)
+    git -C "$SCRIPT_DIR" worktree remove --force "$TEMP_DIR/base-src"
+fi
+
+# 准备测试目录
+if [ -z "$SOURCE_DIR" ]; then
+    DIRS="${BENCH_DIRS:-2000}"
+    FILES="${BENCH_FILES:-50}"
+    SOURCE_DIR="$TEMP_DIR/tree"
+    echo "生成测试目录: $DIRS 个目录，每个目录 $FILES 个文件..."
+    for ((d = 0; d < DIRS; d++)); do
+        # 三层目录结构，使目录树有一定深度
+        dir="$SOURCE_DIR/d$((d % 10))/d$((d / 10 % 20))/d$d"
+        mkdir -p "$dir"
+        for ((f = 0; f < FILES; f++)); do
+            : > "$dir/f$f"
+        done
+    done
+elif [ ! -d "$SOURCE_DIR" ]; then
+    echo "错误: 目录不存在: $SOURCE_DIR"
+    exit 1
+fi
+
+echo "扫描目录: $SOURCE_DIR"
+echo "运行次数: $RUNS（取最快）"
+echo ""
+
+# run_bench 运行多次并输出最快的耗时（秒）
+run_bench() {
+    local output=$1
+    shift
+    local best=""
+    for ((i = 0; i < RUNS; i++)); do
+        local start end elapsed
+        start=$(date +%s.%N)
+        "$@" "$SOURCE_DIR" "$output" > /dev/null
+        end=$(date +%s.%N)
+        elapsed=$(awk "BEGIN {printf \"%.3f\", $end - $start}")
+        if [ -z "$best" ] || awk "BEGIN {exit !($elapsed < $best)}"; then
+            best=$elapsed
+        fi
+    done
+    echo "$best"
+}
+
+# 基准版本没有 --concurrency 参数
+BASE_TIME=$(run_bench "$TEMP_DIR/manifest-base.txt" "$TEMP_DIR/p-tool-base" manifest)
+FILE_COUNT=$(grep -vc '^#' "$TEMP_DIR/manifest-base.txt" || true)
+
+printf "%-24s %12s %10s\n" "配置" "耗时(秒)" "加速比"
+echo "------------------------------------------------"
+printf "%-24s %12.3f %10s\n" "基准版本" "$BASE_TIME" "1.00x"
+
+MISMATCH=0
+for c in $CONCURRENCY_LIST; do
+    NEW_TIME=$(run_bench "$TEMP_DIR/manifest-new-$c.txt" "$TEMP_DIR/p-tool-new" manifest --concurrency "$c")
+    SPEEDUP=$(awk "BEGIN {printf \"%.2f\", $BASE_TIME / $NEW_TIME}")
+    printf "%-24s %12.3f %9sx\n" "并行扫描（并发 $c）" "$NEW_TIME" "$SPEEDUP"
+
+    if ! cmp -s "$TEMP_DIR/manifest-base.txt" "$TEMP_DIR/manifest-new-$c.txt"; then
+        MISMATCH=1
+    fi
+done
+
+echo ""
+echo "文件数量: $FILE_COUNT"
+if [ $MISMATCH -eq 0 ]; then
+    echo "输出一致: 各配置生成的 manifest 与基准版本完全相同"
+else
+    echo "警告: 生成的 manifest 与基准版本不一致"
+    exit 1
+fi
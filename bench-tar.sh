@@ -0,0 +1,155 @@
+#!/bin/bash
+
+# tar 打包性能对比脚本
+# 用法: ./bench-tar.sh [源目录] [基准版本]
+# 功能: 对比当前代码的流水线打包（并行预读、单个写入协程按顺序写入）与基准版本
+#       （默认为引入流水线之前、写入 tar 时持有全局锁读取文件的版本）的打包耗时，
+#       分别测试不压缩和 --zstd，并检查两者生成的 tar 包解压后与源目录一致
+#
+# 参数:
+#   源目录    可选，未指定时生成一个测试目录：大量小文件，再加上几个大文件
+#   基准版本  可选，git 版本号或已编译好的 p-tool 路径
+#
+# 环境变量:
+#   BENCH_RUNS         每种配置运行的次数，取最快的一次（默认 3）
+#   BENCH_CONCURRENCY  要测试的并发数列表（默认 "1 4 <CPU 核数>"）
+#   BENCH_SMALL        生成测试目录时的小文件数量（默认 20000）
+#   BENCH_SMALL_SIZE   每个小文件的大小，单位 KB（默认 16）
+#   BENCH_LARGE        生成测试目录时的大文件数量（默认 4）
+#   BENCH_LARGE_SIZE   每个大文件的大小，单位 MB（默认 256）
+#
+# 注意: 多次运行时源文件已在页缓存中，测得的是热缓存下的耗时；
+#       在冷缓存、网络文件系统或机械硬盘上，读取延迟越高，并行预读的收益越明显
+
+set -e
+
+SCRIPT_DIR=$(cd "$(dirname "$0")" && pwd)
+SOURCE_DIR="$1"
+BASELINE="$2"
+RUNS="${BENCH_RUNS:-3}"
+CPUS=$(getconf _NPROCESSORS_ONLN 2>/dev/null || echo 4)
+CONCURRENCY_LIST="${BENCH_CONCURRENCY:-1 4 $CPUS}"
+
+TEMP_DIR=$(mktemp -d)
+trap "rm -rf $TEMP_DIR; git -C '$SCRIPT_DIR' worktree prune 2>/dev/null || true" EXIT
+
+echo "=========================================="
+echo "tar 打包性能对比"
+echo "=========================================="
+
+# 编译当前代码
+echo "编译当前代码..."
+(cd "$SCRIPT_DIR" && go build -o "$TEMP_DIR/p-tool-new" .)
+
+# 准备基准版本
+if [ -n "$BASELINE" ] && [ -x "$BASELINE" ]; then
+    cp "$BASELINE" "$TEMP_DIR/p-tool-base"
+    echo "基准版本: $BASELINE"
+else
+    if [ -z "$BASELINE" ]; then
+        # 默认使用引入打包流水线之前的版本
+        BASELINE=$(git -C "$SCRIPT_DIR" log --diff-filter=A --format=%H -- cmd/tarpipe.go | tail -1)
+        if [ -z "$BASELINE" ]; then
+            echo "错误: 无法确定基准版本，请手动指定"
+            exit 1
+        fi
+        BASELINE="${BASELINE}~1"
+    fi
+    echo "编译基准版本 $BASELINE..."
+    git -C "$SCRIPT_DIR" worktree add --detach -q "$TEMP_DIR/base-src" "$BASELINE"
+    (cd "$TEMP_DIR/base-src" && go build -o "$TEMP_DIR/p-tool-base" .)
+    git -C "$SCRIPT_DIR" worktree remove --force "$TEMP_DIR/base-src"
+fi
+
+# 准备测试目录
+if [ -z "$SOURCE_DIR" ]; then
+    SMALL="${BENCH_SMALL:-20000}"
+    SMALL_SIZE="${BENCH_SMALL_SIZE:-16}"
+    LARGE="${BENCH_LARGE:-4}"
+    LARGE_SIZE="${BENCH_LARGE_SIZE:-256}"
+    SOURCE_DIR="$TEMP_DIR/tree"
+    echo "生成测试目录: $SMALL 个 ${SMALL_SIZE}KB 小文件，$LARGE 个 ${LARGE_SIZE}MB 大文件..."
+    head -c $((SMALL_SIZE * 1024)) /dev/urandom > "$TEMP_DIR/small.bin"
+    for ((i = 0; i < SMALL; i++)); do
+        dir="$SOURCE_DIR/d$((i / 500))"
+        mkdir -p "$dir"
+        cp "$TEMP_DIR/small.bin" "$dir/f$i"
+    done
+    for ((i = 0; i < LARGE; i++)); do
+        head -c $((LARGE_SIZE * 1024 * 1024)) /dev/urandom > "$SOURCE_DIR/large$i.bin"
+    done
+    rm -f "$TEMP_DIR/small.bin"
+elif [ ! -d "$SOURCE_DIR" ]; then
+    echo "错误: 目录不存在: $SOURCE_DIR"
+    exit 1
+fi
+
+echo "源目录: $SOURCE_DIR"
+echo "运行次数: $RUNS（取最快）"
+echo ""
+
+# run_bench 运行多次并输出最快的耗时（秒）
+run_bench() {
+    local output=$1
+    shift
+    local best=""
+    for ((i = 0; i < RUNS; i++)); do
+        rm -f "$output"
+        local start end elapsed
+        start=$(date +%s.%N)
+        "$@" "$SOURCE_DIR" "$output" > /dev/null
+        end=$(date +%s.%N)
+        elapsed=$(awk "BEGIN {printf \"%.3f\", $end - $start}")
+        if [ -z "$best" ] || awk "BEGIN {exit !($elapsed < $best)}"; then
+            best=$elapsed
+        fi
+    done
+    echo "$best"
+}
+
+# check_archive 使用系统 tar 解压 tar 包并与源目录比较
+check_archive() {
+    local archive=$1 compress=$2
+    rm -rf "$TEMP_DIR/check"
+    mkdir -p "$TEMP_DIR/check"
+    if [ -n "$compress" ]; then
+        zstd -dcq "$archive" | tar -xf - -C "$TEMP_DIR/check"
+    else
+        tar -xf "$archive" -C "$TEMP_DIR/check"
+    fi
+    rm -f "$TEMP_DIR/check/.__p-tool-manifest__.txt" "$TEMP_DIR/check/.__p-tool-footer__.txt"
+    diff -r "$SOURCE_DIR" "$TEMP_DIR/check" > /dev/null
+}
+
+printf "%-32s %12s %12s %10s\n" "配置" "基准(秒)" "流水线(秒)" "加速比"
+echo "--------------------------------------------------------------------"
+
+MISMATCH=0
+for compress in "" "--zstd"; do
+    if [ -n "$compress" ] && ! command -v zstd > /dev/null; then
+        echo "未找到 zstd 命令，跳过 --zstd 测试"
+        continue
+    fi
+    for c in $CONCURRENCY_LIST; do
+        BASE_TIME=$(run_bench "$TEMP_DIR/base.tar" "$TEMP_DIR/p-tool-base" tar --concurrency "$c" $compress)
+        NEW_TIME=$(run_bench "$TEMP_DIR/new.tar" "$TEMP_DIR/p-tool-new" tar --concurrency "$c" $compress)
+        SPEEDUP=$(awk "BEGIN {printf \"%.2f\", $BASE_TIME / $NEW_TIME}")
+        printf "%-32s %12.3f %12.3f %9sx\n" "tar${compress:+ $compress}（并发 $c）" "$BASE_TIME" "$NEW_TIME" "$SPEEDUP"
+
+        for archive in base new; do
+            if ! check_archive "$TEMP_DIR/$archive.tar" "$compress"; then
+                echo "警告: $archive 版本生成的 tar 包（$compress 并发 $c）解压后与源目录不一致"
+                MISMATCH=1
+            fi
+        done
+    done
+done
+rm -rf "$TEMP_DIR/check"
+
+echo ""
+if [ $MISMATCH -eq 0 ]; then
+    echo "结果一致: 各配置生成的 tar 包解压后与源目录完全相同"
+else
+    echo "警告: 部分 tar 包解压后与源目录不一致"
+    exit 1
+fi
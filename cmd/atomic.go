@@ -0,0 +1,133 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// atomicTempSuffix 原子写入（--atomic）时临时文件的后缀，临时文件名为 .<文件名>.ptool-tmp
+const atomicTempSuffix = ".ptool-tmp"
+
+// atomicTempPath 返回目标文件对应的临时文件路径（与目标文件在同一目录，保证 rename 是原子的）
+func atomicTempPath(destPath string) string {
+	return filepath.Join(filepath.Dir(destPath), "."+filepath.Base(destPath)+atomicTempSuffix)
+}
+
+// isAtomicTempName 判断文件名是否是原子写入的临时文件
+func isAtomicTempName(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, atomicTempSuffix) && len(name) > len(atomicTempSuffix)+1
+}
+
+// outputFile 正在写入的目标文件
+// atomic 为 true 时内容先写入同目录的临时文件，commit 时再重命名到目标路径，
+// 因此其他进程或崩溃后只会看到旧文件或完整的新文件，不会看到写了一半的文件
+type outputFile struct {
+	*os.File
+	destPath string
+	atomic   bool
+}
+
+// createOutputFile 创建目标文件，任何情况下都不会跟随已存在的符号链接写到别处
+// atomic 模式下删除遗留的临时文件后以 O_EXCL 新建临时文件；
+// 非 atomic 模式下直接截断目标文件，目标是符号链接时改为写入临时文件，commit 时用重命名替换链接本身
+func createOutputFile(destPath string, perm os.FileMode, atomic bool) (*outputFile, error) {
+	if !atomic {
+		file, err := openNoFollow(destPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+		if err == nil {
+			return &outputFile{File: file, destPath: destPath}, nil
+		}
+		if info, lerr := os.Lstat(destPath); lerr != nil || info.Mode()&os.ModeSymlink == 0 {
+			return nil, err
+		}
+	}
+
+	tempPath := atomicTempPath(destPath)
+	if err := os.Remove(tempPath); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	file, err := openNoFollow(tempPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &outputFile{File: file, destPath: destPath, atomic: true}, nil
+}
+
+// commit 完成写入：按持久化方式需要时先 fsync，然后关闭文件，atomic 模式下将临时文件重命名到目标路径
+func (f *outputFile) commit(d *durability) error {
+	if err := d.syncFile(f.File); err != nil {
+		f.abort()
+		return fmt.Errorf("同步文件失败: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		f.abort()
+		return fmt.Errorf("关闭文件失败: %w", err)
+	}
+	if f.atomic {
+		if err := os.Rename(f.Name(), f.destPath); err != nil {
+			os.Remove(f.Name())
+			return fmt.Errorf("重命名临时文件失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// abort 写入失败时关闭文件，atomic 模式下删除临时文件（目标文件保持不变）
+func (f *outputFile) abort() {
+	f.Close()
+	if f.atomic {
+		os.Remove(f.Name())
+	}
+}
+
+// removeAtomicTempFiles 删除目标目录中上次中断遗留的临时文件，返回删除的数量
+func removeAtomicTempFiles(destDir string, concurrency int) (int64, error) {
+	if _, err := os.Stat(destDir); os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	// 按符号链接本身扫描，避免删除目标目录以外的文件
+	fileList, err := scanDirectory(destDir, ManifestOptions{Concurrency: concurrency, Symlinks: symlinksPreserve})
+	if err = warnScanIncomplete(err); err != nil {
+		return 0, err
+	}
+
+	var removed int64
+	taskChan := make(chan string, concurrency*2)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for relPath := range taskChan {
+				fullPath := filepath.Join(destDir, filepath.FromSlash(relPath))
+				if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+					mu.Lock()
+					fmt.Fprintf(os.Stderr, "警告: 删除临时文件失败 %s: %v\n", fullPath, err)
+					mu.Unlock()
+					continue
+				}
+				atomic.AddInt64(&removed, 1)
+			}
+		}()
+	}
+
+	for i := range fileList {
+		if fileList[i].Type != manifestTypeDir && isAtomicTempName(path.Base(fileList[i].Path)) {
+			taskChan <- fileList[i].Path
+		}
+	}
+	close(taskChan)
+	wg.Wait()
+
+	return removed, nil
+}
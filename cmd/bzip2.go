@@ -0,0 +1,513 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"container/heap"
+)
+
+// bzip2 压缩（标准库 compress/bzip2 只能解压）
+// 每次调用 bzip2EncodeStream 生成一个完整的 bzip2 流，多个流直接拼接后 bzip2 -d 和 compress/bzip2 都能解压，
+// 并行压缩时每个协程各自生成一个流
+const (
+	bzip2BlockMagic   = 0x314159265359
+	bzip2StreamMagic  = 0x177245385090
+	bzip2GroupSize    = 50 // 每 50 个符号选择一次 Huffman 表
+	bzip2MaxCodeLen   = 17
+	bzip2RefineRounds = 4 // 为每组符号重新选择 Huffman 表的迭代次数
+)
+
+// bzip2CRCTable bzip2 使用的 CRC32（高位在前，多项式 0x04c11db7）
+var bzip2CRCTable = func() (table [256]uint32) {
+	for i := range table {
+		c := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if c&0x80000000 != 0 {
+				c = c<<1 ^ 0x04c11db7
+			} else {
+				c <<= 1
+			}
+		}
+		table[i] = c
+	}
+	return table
+}()
+
+// bzip2BitWriter 高位在前的位写入器
+type bzip2BitWriter struct {
+	out   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (bw *bzip2BitWriter) write(n uint, v uint64) {
+	bw.acc = bw.acc<<n | v&(1<<n-1)
+	bw.nbits += n
+	for bw.nbits >= 8 {
+		bw.nbits -= 8
+		bw.out = append(bw.out, byte(bw.acc>>bw.nbits))
+	}
+}
+
+// flush 补齐最后一个字节
+func (bw *bzip2BitWriter) flush() {
+	if bw.nbits > 0 {
+		bw.out = append(bw.out, byte(bw.acc<<(8-bw.nbits)))
+		bw.nbits = 0
+	}
+}
+
+// bzip2EncodeStream 将 src 压缩为一个 bzip2 流追加到 dst，level 为 1-9（块大小 level*100KB）
+func bzip2EncodeStream(dst, src []byte, level int) []byte {
+	bw := &bzip2BitWriter{out: dst}
+	bw.write(8, 'B')
+	bw.write(8, 'Z')
+	bw.write(8, 'h')
+	bw.write(8, uint64('0'+level))
+
+	maxBlock := level*100000 - 19
+	block := make([]byte, 0, maxBlock)
+	var combinedCRC uint32
+
+	// 第一步游程编码（RLE1）：4-255 个相同的字节编码为 4 个字节加一个重复次数，块 CRC 按原始字节计算
+	crc := uint32(0xffffffff)
+	flushBlock := func() {
+		if len(block) == 0 {
+			return
+		}
+		crc = ^crc
+		combinedCRC = (combinedCRC<<1 | combinedCRC>>31) ^ crc
+		bzip2EncodeBlock(bw, block, crc)
+		block = block[:0]
+		crc = 0xffffffff
+	}
+	for i := 0; i < len(src); {
+		b := src[i]
+		run := 1
+		for run < 255 && i+run < len(src) && src[i+run] == b {
+			run++
+		}
+		encoded := run
+		if run >= 4 {
+			encoded = 5
+		}
+		if len(block)+encoded > maxBlock {
+			flushBlock()
+		}
+		for j := 0; j < run; j++ {
+			crc = crc<<8 ^ bzip2CRCTable[byte(crc>>24)^b]
+		}
+		if run >= 4 {
+			block = append(block, b, b, b, b, byte(run-4))
+		} else {
+			for j := 0; j < run; j++ {
+				block = append(block, b)
+			}
+		}
+		i += run
+	}
+	flushBlock()
+
+	bw.write(24, bzip2StreamMagic>>24)
+	bw.write(24, bzip2StreamMagic&0xffffff)
+	bw.write(32, uint64(combinedCRC))
+	bw.flush()
+	return bw.out
+}
+
+// bzip2EncodeBlock 对一个 RLE1 之后的块做 BWT、MTF/RLE2 和 Huffman 编码
+func bzip2EncodeBlock(bw *bzip2BitWriter, block []byte, crc uint32) {
+	bw.write(24, bzip2BlockMagic>>24)
+	bw.write(24, bzip2BlockMagic&0xffffff)
+	bw.write(32, uint64(crc))
+	bw.write(1, 0) // 不使用随机化
+
+	// BWT
+	rotations := bzip2SortRotations(block)
+	n := len(block)
+	last := make([]byte, n)
+	origPtr := 0
+	for i, r := range rotations {
+		if r == 0 {
+			origPtr = i
+			last[i] = block[n-1]
+		} else {
+			last[i] = block[r-1]
+		}
+	}
+	bw.write(24, uint64(origPtr))
+
+	// 使用的字节映射表：16 位表示哪些 16 字节区间被使用，再逐个区间写入 16 位
+	var inUse [256]bool
+	for _, b := range block {
+		inUse[b] = true
+	}
+	var rangeBits uint64
+	for r := 0; r < 16; r++ {
+		for j := 0; j < 16; j++ {
+			if inUse[r*16+j] {
+				rangeBits |= 1 << (15 - r)
+				break
+			}
+		}
+	}
+	bw.write(16, rangeBits)
+	var unseqToSeq [256]byte
+	numInUse := 0
+	for r := 0; r < 16; r++ {
+		if rangeBits&(1<<(15-r)) == 0 {
+			continue
+		}
+		var bits uint64
+		for j := 0; j < 16; j++ {
+			if inUse[r*16+j] {
+				bits |= 1 << (15 - j)
+				unseqToSeq[r*16+j] = byte(numInUse)
+				numInUse++
+			}
+		}
+		bw.write(16, bits)
+	}
+
+	// MTF 和零游程编码（RUNA/RUNB），EOB 为最后一个符号
+	alphaSize := numInUse + 2
+	eob := uint16(numInUse + 1)
+	symbols := make([]uint16, 0, n+1)
+	var mtf [256]byte
+	for i := range mtf {
+		mtf[i] = byte(i)
+	}
+	zeroRun := 0
+	flushRun := func() {
+		if zeroRun == 0 {
+			return
+		}
+		// 双射二进制：RUNA = 1，RUNB = 2，低位在前
+		for z := zeroRun - 1; ; z = (z - 2) / 2 {
+			symbols = append(symbols, uint16(z&1))
+			if z < 2 {
+				break
+			}
+		}
+		zeroRun = 0
+	}
+	for _, b := range last {
+		s := unseqToSeq[b]
+		if mtf[0] == s {
+			zeroRun++
+			continue
+		}
+		flushRun()
+		j := 1
+		for mtf[j] != s {
+			j++
+		}
+		copy(mtf[1:j+1], mtf[:j])
+		mtf[0] = s
+		symbols = append(symbols, uint16(j+1))
+	}
+	flushRun()
+	symbols = append(symbols, eob)
+
+	bzip2EncodeSymbols(bw, symbols, alphaSize)
+}
+
+// bzip2EncodeSymbols 选择 Huffman 表并写入表、选择子和编码后的符号
+func bzip2EncodeSymbols(bw *bzip2BitWriter, symbols []uint16, alphaSize int) {
+	var numTables int
+	switch n := len(symbols); {
+	case n < 200:
+		numTables = 2
+	case n < 600:
+		numTables = 3
+	case n < 1200:
+		numTables = 4
+	case n < 2400:
+		numTables = 5
+	default:
+		numTables = 6
+	}
+	numSelectors := (len(symbols) + bzip2GroupSize - 1) / bzip2GroupSize
+
+	// 初始划分：按符号频率把字母表切分为 numTables 段，每张表偏向其中一段
+	freq := make([]int, alphaSize)
+	for _, s := range symbols {
+		freq[s]++
+	}
+	lengths := make([][]uint8, numTables)
+	remaining := len(symbols)
+	lo := 0
+	for t := numTables; t > 0; t-- {
+		target := remaining / t
+		hi := lo - 1
+		acc := 0
+		for acc < target && hi < alphaSize-1 {
+			hi++
+			acc += freq[hi]
+		}
+		if hi > lo && t != numTables && t != 1 && (numTables-t)%2 == 1 {
+			acc -= freq[hi]
+			hi--
+		}
+		table := make([]uint8, alphaSize)
+		for s := range table {
+			if s >= lo && s <= hi {
+				table[s] = 0
+			} else {
+				table[s] = 15
+			}
+		}
+		lengths[numTables-t] = table
+		remaining -= acc
+		lo = hi + 1
+	}
+
+	// 迭代：为每组选择代价最小的表，再根据分到的符号重新计算每张表的码长
+	selectors := make([]byte, numSelectors)
+	for round := 0; round < bzip2RefineRounds; round++ {
+		tableFreq := make([][]int, numTables)
+		for t := range tableFreq {
+			tableFreq[t] = make([]int, alphaSize)
+		}
+		for g := 0; g < numSelectors; g++ {
+			group := symbols[g*bzip2GroupSize : min((g+1)*bzip2GroupSize, len(symbols))]
+			best, bestCost := 0, -1
+			for t := 0; t < numTables; t++ {
+				cost := 0
+				for _, s := range group {
+					cost += int(lengths[t][s])
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = t, cost
+				}
+			}
+			selectors[g] = byte(best)
+			for _, s := range group {
+				tableFreq[best][s]++
+			}
+		}
+		for t := 0; t < numTables; t++ {
+			lengths[t] = bzip2CodeLengths(tableFreq[t])
+		}
+	}
+
+	bw.write(3, uint64(numTables))
+	bw.write(15, uint64(numSelectors))
+
+	// 选择子先做 MTF，再用一元码写入
+	var order [6]byte
+	for i := range order {
+		order[i] = byte(i)
+	}
+	for _, sel := range selectors {
+		j := 0
+		for order[j] != sel {
+			j++
+		}
+		copy(order[1:j+1], order[:j])
+		order[0] = sel
+		for ; j > 0; j-- {
+			bw.write(1, 1)
+		}
+		bw.write(1, 0)
+	}
+
+	// 码长以差分方式写入：起始长度 5 位，之后每个符号 "10" 加一、"11" 减一、"0" 结束
+	codes := make([][]uint32, numTables)
+	for t := 0; t < numTables; t++ {
+		cur := int(lengths[t][0])
+		bw.write(5, uint64(cur))
+		for _, l := range lengths[t] {
+			for cur < int(l) {
+				bw.write(2, 2)
+				cur++
+			}
+			for cur > int(l) {
+				bw.write(2, 3)
+				cur--
+			}
+			bw.write(1, 0)
+		}
+		codes[t] = bzip2AssignCodes(lengths[t])
+	}
+
+	for g := 0; g < numSelectors; g++ {
+		t := selectors[g]
+		for _, s := range symbols[g*bzip2GroupSize : min((g+1)*bzip2GroupSize, len(symbols))] {
+			bw.write(uint(lengths[t][s]), uint64(codes[t][s]))
+		}
+	}
+}
+
+// bzip2AssignCodes 按码长分配规范 Huffman 编码（先按长度、再按符号顺序）
+func bzip2AssignCodes(lengths []uint8) []uint32 {
+	codes := make([]uint32, len(lengths))
+	code := uint32(0)
+	for l := uint8(1); l <= bzip2MaxCodeLen; l++ {
+		for s, sl := range lengths {
+			if sl == l {
+				codes[s] = code
+				code++
+			}
+		}
+		code <<= 1
+	}
+	return codes
+}
+
+// huffNode 构建 Huffman 树的节点
+type huffNode struct {
+	weight int
+	depth  int
+	left   int // 子节点下标，叶子节点为 -1
+	right  int
+}
+
+// huffHeap 按权重（权重相同时按深度）排序的节点下标
+type huffHeap struct {
+	nodes []huffNode
+	items []int
+}
+
+func (h *huffHeap) Len() int { return len(h.items) }
+func (h *huffHeap) Less(i, j int) bool {
+	a, b := h.nodes[h.items[i]], h.nodes[h.items[j]]
+	if a.weight != b.weight {
+		return a.weight < b.weight
+	}
+	return a.depth < b.depth
+}
+func (h *huffHeap) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *huffHeap) Push(x interface{}) { h.items = append(h.items, x.(int)) }
+func (h *huffHeap) Pop() interface{} {
+	x := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return x
+}
+
+// bzip2CodeLengths 根据频率计算不超过 bzip2MaxCodeLen 的码长（所有符号都分配编码）
+// 与 bzip2 相同，码长超出限制时把频率减半后重新计算
+func bzip2CodeLengths(freq []int) []uint8 {
+	weights := make([]int, len(freq))
+	for s, f := range freq {
+		weights[s] = max(f, 1)
+	}
+	lengths := make([]uint8, len(freq))
+	for {
+		h := &huffHeap{nodes: make([]huffNode, 0, 2*len(weights))}
+		for _, w := range weights {
+			h.nodes = append(h.nodes, huffNode{weight: w, left: -1, right: -1})
+			h.items = append(h.items, len(h.nodes)-1)
+		}
+		heap.Init(h)
+		for h.Len() > 1 {
+			a := heap.Pop(h).(int)
+			b := heap.Pop(h).(int)
+			h.nodes = append(h.nodes, huffNode{
+				weight: h.nodes[a].weight + h.nodes[b].weight,
+				depth:  max(h.nodes[a].depth, h.nodes[b].depth) + 1,
+				left:   a,
+				right:  b,
+			})
+			heap.Push(h, len(h.nodes)-1)
+		}
+
+		// 从根节点向下计算每个叶子的深度
+		tooLong := false
+		depth := make([]int, len(h.nodes))
+		for i := len(h.nodes) - 1; i >= 0; i-- {
+			node := h.nodes[i]
+			if node.left < 0 {
+				if depth[i] > bzip2MaxCodeLen {
+					tooLong = true
+				}
+				lengths[i] = uint8(depth[i])
+				continue
+			}
+			depth[node.left] = depth[i] + 1
+			depth[node.right] = depth[i] + 1
+		}
+		if !tooLong {
+			return lengths
+		}
+		for s := range weights {
+			weights[s] = 1 + weights[s]/2
+		}
+	}
+}
+
+// bzip2SortRotations 返回按字典序排序后的循环旋转起始位置（BWT 的排序矩阵）
+// 使用倍增法：每轮按前 2k 个字节的排名做基数排序，O(n log n)，对高度重复的数据同样有效
+func bzip2SortRotations(block []byte) []int32 {
+	n := len(block)
+	sa := make([]int32, n)
+	rank := make([]int32, n)
+	tmp := make([]int32, n)
+
+	// 按第一个字节计数排序
+	var count [257]int32
+	for _, b := range block {
+		count[int(b)+1]++
+	}
+	for i := 1; i < 257; i++ {
+		count[i] += count[i-1]
+	}
+	for i, b := range block {
+		sa[count[b]] = int32(i)
+		count[b]++
+	}
+	classes := int32(0)
+	for i := 0; i < n; i++ {
+		if i > 0 && block[sa[i]] != block[sa[i-1]] {
+			classes++
+		}
+		rank[sa[i]] = classes
+	}
+	classes++
+
+	buckets := make([]int32, n+1)
+	for k := 1; k < n && int(classes) < n; k <<= 1 {
+		// 按第二关键字（位置 i+k 的排名）排序：sa 已按排名有序，依次取 sa[j]-k 即可
+		for j := 0; j < n; j++ {
+			p := int(sa[j]) - k
+			if p < 0 {
+				p += n
+			}
+			tmp[j] = int32(p)
+		}
+		// 按第一关键字稳定计数排序
+		for i := range buckets[:classes+1] {
+			buckets[i] = 0
+		}
+		for _, p := range tmp {
+			buckets[rank[p]+1]++
+		}
+		for i := int32(1); i <= classes; i++ {
+			buckets[i] += buckets[i-1]
+		}
+		for _, p := range tmp {
+			sa[buckets[rank[p]]] = p
+			buckets[rank[p]]++
+		}
+		// 重新计算排名
+		second := func(p int32) int32 {
+			q := int(p) + k
+			if q >= n {
+				q -= n
+			}
+			return rank[q]
+		}
+		tmp[sa[0]] = 0
+		classes = 0
+		for i := 1; i < n; i++ {
+			if rank[sa[i]] != rank[sa[i-1]] || second(sa[i]) != second(sa[i-1]) {
+				classes++
+			}
+			tmp[sa[i]] = classes
+		}
+		classes++
+		rank, tmp = tmp, rank
+	}
+	return sa
+}
@@ -0,0 +1,66 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// bzip2Decompress 用标准库 compress/bzip2 解压
+func bzip2Decompress(data []byte) ([]byte, error) {
+	return io.ReadAll(bzip2.NewReader(bytes.NewReader(data)))
+}
+
+func TestBzip2RoundTrip(t *testing.T) {
+	for _, level := range []int{1, 9} {
+		for _, in := range compressTestInputs(false) {
+			t.Run(fmt.Sprintf("级别 %d/%s", level, in.name), func(t *testing.T) {
+				out, err := bzip2Decompress(bzip2EncodeStream(nil, in.data, level))
+				if err != nil {
+					t.Fatalf("解压失败: %v", err)
+				}
+				if !bytes.Equal(out, in.data) {
+					t.Fatalf("解压结果不一致：长度 %d，应为 %d", len(out), len(in.data))
+				}
+			})
+		}
+	}
+}
+
+func TestBzip2AllSymbols(t *testing.T) {
+	// 所有 256 个字节值以及各种长度的游程，覆盖 MTF 和 RUNA/RUNB 编码
+	var data []byte
+	for i := 0; i < 256; i++ {
+		data = append(data, bytes.Repeat([]byte{byte(i)}, i%7+1)...)
+	}
+	for i := 0; i < 256; i++ {
+		data = append(data, byte(255-i), byte(i))
+	}
+	out, err := bzip2Decompress(bzip2EncodeStream(nil, data, 9))
+	if err != nil {
+		t.Fatalf("解压失败: %v", err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatalf("解压结果不一致")
+	}
+}
+
+func TestBzip2AppendsToDst(t *testing.T) {
+	// 多个流追加到同一个缓冲区，拼接后仍能完整解压
+	var stream []byte
+	stream = bzip2EncodeStream(stream, []byte("first "), 1)
+	stream = bzip2EncodeStream(stream, nil, 1)
+	stream = bzip2EncodeStream(stream, []byte("second"), 9)
+	out, err := bzip2Decompress(stream)
+	if err != nil {
+		t.Fatalf("解压失败: %v", err)
+	}
+	if string(out) != "first second" {
+		t.Fatalf("解压结果为 %q", out)
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/zeebo/blake3"
+	"github.com/zeebo/xxh3"
+)
+
+// newChecksumHash 根据算法名称创建哈希函数
+func newChecksumHash(algo string) (hash.Hash, error) {
+	switch algo {
+	case "xxh3":
+		return xxh3.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "blake3":
+		return blake3.New(), nil
+	default:
+		return nil, fmt.Errorf("不支持的校验和算法: %s（可选 xxh3、sha256、blake3）", algo)
+	}
+}
+
+// hashFile 计算文件内容的校验和（十六进制）
+func hashFile(path, algo string) (string, error) {
+	h, err := newChecksumHash(algo)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// 从缓冲区池获取缓冲区
+	buf := bufferPool.Get().([]byte)
+	defer bufferPool.Put(buf)
+
+	if _, err := io.CopyBuffer(h, file, buf); err != nil {
+		return "", fmt.Errorf("读取文件内容失败: %w", err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// computeChecksums 并行计算 manifest 中普通文件的校验和，结果写回条目
+func computeChecksums(dirPath string, fileList []ManifestEntry, algo string, concurrency int) error {
+	var failedFiles int64
+
+	taskChan := make(chan int, concurrency*2)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	// 启动工作协程（每个协程只写自己负责的条目，无需加锁）
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range taskChan {
+				entry := &fileList[index]
+				sum, err := hashFile(filepath.Join(dirPath, entry.Path), algo)
+				if err != nil {
+					mu.Lock()
+					fmt.Fprintf(os.Stderr, "警告: 计算校验和失败 %s: %v\n", entry.Path, err)
+					mu.Unlock()
+					atomic.AddInt64(&failedFiles, 1)
+					continue
+				}
+				entry.Checksum = sum
+			}
+		}()
+	}
+
+	// 发送任务
+	for i := range fileList {
+		if fileList[i].Type == manifestTypeFile {
+			taskChan <- i
+		}
+	}
+	close(taskChan)
+
+	// 等待所有协程完成
+	wg.Wait()
+
+	if failedFiles > 0 {
+		return fmt.Errorf("有 %d 个文件计算校验和失败", failedFiles)
+	}
+
+	return nil
+}
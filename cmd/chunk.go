@@ -0,0 +1,170 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// 大文件分块并行复制的默认参数
+const (
+	defaultChunkThreshold = "256MB" // 超过该大小的文件拆分为多个分块
+	defaultChunkSize      = "32MB"  // 每个分块的大小
+)
+
+// copyTask 复制协程池中的一个任务：整个条目，或大文件的一个分块
+type copyTask struct {
+	entry  *ManifestEntry
+	file   *chunkedFile // 不为 nil 时只复制 [offset, offset+length) 范围
+	offset int64
+	length int64
+}
+
+// chunkedFile 分块并行复制中的一个大文件
+// 各分块由不同协程使用 pread/pwrite 并发复制，最后一个完成的分块负责收尾（关闭、fsync、重命名）
+type chunkedFile struct {
+	src     *os.File
+	dst     *outputFile
+	size    int64
+	sparse  bool  // 源文件包含空洞，各分块只复制数据区域
+	pending int64 // 尚未完成的分块数
+
+	mu  sync.Mutex
+	err error // 第一个失败分块的错误
+}
+
+// openChunkedFile 打开源文件并创建目标文件，目标文件预先扩展到源文件大小
+// opts.reflink 允许时先尝试 reflink，成功时返回 cloned = true，不再需要分块复制
+func openChunkedFile(sourcePath, destPath string, opts copyOptions) (file *chunkedFile, cloned bool, err error) {
+	src, err := os.Open(sourcePath)
+	if err != nil {
+		return nil, false, err
+	}
+	info, err := src.Stat()
+	if err != nil {
+		src.Close()
+		return nil, false, err
+	}
+
+	dst, err := createOutputFile(destPath, 0666, opts.atomic)
+	if err != nil {
+		src.Close()
+		return nil, false, fmt.Errorf("无法创建目标文件: %w", err)
+	}
+	file = &chunkedFile{src: src, dst: dst, size: info.Size(), sparse: isSparseFile(info)}
+
+	// 大文件最适合 reflink：不需要复制任何数据
+	stats := opts.methods
+	devices := lazyDevices(dst.File, src)
+	if opts.reflink != reflinkNever && stats != nil && (opts.reflink == reflinkAlways || !stats.methodDisabled(&stats.noReflink, devices)) {
+		err := cloneFile(dst.File, src)
+		if err == nil {
+			atomic.AddInt64(&stats.reflink, 1)
+			return file, true, nil
+		}
+		if opts.reflink == reflinkAlways || !errors.Is(err, errors.ErrUnsupported) {
+			file.close()
+			return nil, false, fmt.Errorf("无法创建 reflink: %w", err)
+		}
+		stats.disableMethod(&stats.noReflink, devices)
+	}
+
+	if err := dst.Truncate(file.size); err != nil {
+		file.close()
+		return nil, false, fmt.Errorf("无法预分配目标文件: %w", err)
+	}
+	return file, false, nil
+}
+
+// split 将文件拆分为多个分块任务
+func (f *chunkedFile) split(entry *ManifestEntry, chunkSize int64) []copyTask {
+	var tasks []copyTask
+	for offset := int64(0); offset < f.size; offset += chunkSize {
+		length := chunkSize
+		if f.size-offset < length {
+			length = f.size - offset
+		}
+		tasks = append(tasks, copyTask{entry: entry, file: f, offset: offset, length: length})
+	}
+	atomic.StoreInt64(&f.pending, int64(len(tasks)))
+	return tasks
+}
+
+// copyRange 使用 pread/pwrite 复制 [offset, offset+length) 范围，返回复制的字节数
+// 稀疏文件只复制范围内的数据区域，空洞在预先扩展的目标文件中保持为空洞
+func (f *chunkedFile) copyRange(offset, length int64) (int64, error) {
+	if f.sparse {
+		segments, err := dataSegments(f.src, offset, offset+length)
+		if err == nil {
+			for _, seg := range segments {
+				if err := copyFileExtent(f.dst.File, f.src, seg.offset, seg.length); err != nil {
+					return 0, err
+				}
+			}
+			return length, nil
+		}
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return 0, err
+		}
+	}
+
+	buf := bufferPool.Get().([]byte)
+	defer bufferPool.Put(buf)
+
+	var copied int64
+	for copied < length {
+		n := int64(len(buf))
+		if length-copied < n {
+			n = length - copied
+		}
+		read, err := f.src.ReadAt(buf[:n], offset+copied)
+		if read > 0 {
+			if _, werr := f.dst.WriteAt(buf[:read], offset+copied); werr != nil {
+				return copied, werr
+			}
+			copied += int64(read)
+		}
+		if err != nil {
+			if err == io.EOF {
+				// 源文件在复制过程中被截断
+				return copied, fmt.Errorf("源文件大小在复制过程中发生变化")
+			}
+			return copied, err
+		}
+	}
+	return copied, nil
+}
+
+// chunkDone 记录一个分块完成，返回是否是最后一个分块
+func (f *chunkedFile) chunkDone(err error) bool {
+	if err != nil {
+		f.mu.Lock()
+		if f.err == nil {
+			f.err = err
+		}
+		f.mu.Unlock()
+	}
+	return atomic.AddInt64(&f.pending, -1) == 0
+}
+
+// finish 所有分块完成后关闭源文件并提交目标文件，返回第一个失败分块的错误
+func (f *chunkedFile) finish(d *durability) error {
+	f.src.Close()
+	if f.err != nil {
+		f.dst.abort()
+		return f.err
+	}
+	return f.dst.commit(d)
+}
+
+// close 放弃复制，关闭源文件和目标文件（atomic 模式下删除临时文件）
+func (f *chunkedFile) close() {
+	f.src.Close()
+	f.dst.abort()
+}
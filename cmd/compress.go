@@ -0,0 +1,586 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/cobra"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// 压缩格式（--compress）
+const (
+	compressNone  = "none"
+	compressZstd  = "zstd"
+	compressGzip  = "gzip"
+	compressLZ4   = "lz4"
+	compressXz    = "xz"
+	compressBzip2 = "bzip2"
+	compressAuto  = "auto" // 仅用于解压：根据魔数识别
+)
+
+// 压缩参数的默认值
+const (
+	defaultZstdLevel   = 6               // 与引入 --level 之前固定使用的级别一致
+	defaultGzipLevel   = 6               // 与 gzip 命令一致
+	defaultXzLevel     = 6               // 与 xz 命令一致
+	defaultBzip2Level  = 9               // 与 bzip2 命令一致
+	compressFrameSize  = 4 * 1024 * 1024 // 并行压缩时每个独立帧的输入大小
+	compressQueueDepth = 2               // 每个压缩协程排队的帧数，限制并行压缩占用的内存
+	compressMaxBuffer  = 1 << 30         // 并行压缩排队数据的上限，帧较大时据此减少压缩线程数
+)
+
+// xzDictSizes xz 各级别的字典大小，与 xz 命令的预设一致
+var xzDictSizes = [10]int{256 << 10, 1 << 20, 2 << 20, 4 << 20, 4 << 20, 8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20}
+
+// compressOptions 压缩参数（--compress、--level、--compress-threads、--window-size、--seekable）
+type compressOptions struct {
+	format     string
+	level      int  // 已按格式填充默认值
+	threads    int  // 压缩协程数，1 表示单线程流式压缩
+	windowSize int  // zstd 窗口大小或 xz 字典大小，0 表示由级别决定
+	seekable   bool // 写入 seekable zstd 格式，见 seekable.go
+}
+
+// addDecompressFlags 为解压命令添加 --compress 和 --zstd 参数
+func addDecompressFlags(cmd *cobra.Command) {
+	cmd.Flags().String("compress", compressAuto, "tar 包的压缩格式：auto（根据文件开头的魔数识别）、none、zstd、gzip、lz4、xz、bzip2")
+	cmd.Flags().Bool("zstd", false, "等同于 --compress zstd")
+}
+
+// addCompressFlags 为打包命令添加压缩格式和压缩参数
+func addCompressFlags(cmd *cobra.Command) {
+	cmd.Flags().String("compress", "", "压缩格式：none、zstd、gzip、lz4、xz、bzip2（默认 none）")
+	cmd.Flags().Bool("zstd", false, "等同于 --compress zstd")
+	cmd.Flags().Int("level", 0, "压缩级别，默认由格式决定（zstd 1-22 默认 6，gzip 1-9 默认 6，xz 0-9 默认 6，bzip2 1-9 默认 9；lz4 不支持）")
+	cmd.Flags().Int("compress-threads", 0, "压缩线程数，默认为 CPU 核数，帧较大导致排队的数据超过 1GB 时自动减少；为 1 时单线程流式压缩")
+	cmd.Flags().String("window-size", "", "zstd 窗口大小（1KB-512MB 的 2 的幂）或 xz 字典大小（4KB-4GB），如 8MB、64MB，默认由压缩级别决定")
+	cmd.Flags().Bool("seekable", false, "使用 seekable zstd 格式（按文件分组切分帧，末尾写入路径索引），可用 extract-file 直接提取单个文件；未指定压缩格式时使用 zstd")
+}
+
+// compressFormatFromFlags 读取并校验压缩格式，--zstd 等同于 --compress zstd
+func compressFormatFromFlags(cmd *cobra.Command) (string, error) {
+	format, _ := cmd.Flags().GetString("compress")
+	useZstd, _ := cmd.Flags().GetBool("zstd")
+	if useZstd {
+		if format != "" && format != compressZstd {
+			return "", fmt.Errorf("--zstd 与 --compress %s 冲突", format)
+		}
+		return compressZstd, nil
+	}
+	switch format {
+	case "":
+		return compressNone, nil
+	case compressNone, compressZstd, compressGzip, compressLZ4, compressXz, compressBzip2:
+		return format, nil
+	}
+	return "", fmt.Errorf("无效的 --compress 参数: %s（可选 none、zstd、gzip、lz4、xz、bzip2）", format)
+}
+
+// decompressFormatFromFlags 读取解压命令的压缩格式，未指定时返回 auto
+func decompressFormatFromFlags(cmd *cobra.Command) (string, error) {
+	format, _ := cmd.Flags().GetString("compress")
+	useZstd, _ := cmd.Flags().GetBool("zstd")
+	if format == compressAuto && !useZstd {
+		return compressAuto, nil
+	}
+	if format == compressAuto {
+		return compressZstd, nil
+	}
+	return compressFormatFromFlags(cmd)
+}
+
+// compressOptionsFromFlags 读取并校验压缩参数，未指定级别时使用格式的默认级别
+func compressOptionsFromFlags(cmd *cobra.Command) (compressOptions, error) {
+	var opts compressOptions
+	var err error
+	if opts.format, err = compressFormatFromFlags(cmd); err != nil {
+		return opts, err
+	}
+	opts.level, _ = cmd.Flags().GetInt("level")
+	opts.threads, _ = cmd.Flags().GetInt("compress-threads")
+	windowStr, _ := cmd.Flags().GetString("window-size")
+	opts.seekable, _ = cmd.Flags().GetBool("seekable")
+
+	if opts.seekable {
+		format, _ := cmd.Flags().GetString("compress")
+		if format == "" {
+			opts.format = compressZstd
+		}
+		if opts.format != compressZstd {
+			return opts, fmt.Errorf("--seekable 只支持 zstd 压缩，不能与 --compress %s 同时使用", opts.format)
+		}
+	}
+
+	if opts.format == compressNone {
+		if cmd.Flags().Changed("level") || cmd.Flags().Changed("compress-threads") || windowStr != "" {
+			fmt.Fprintf(os.Stderr, "警告: 未指定压缩格式，--level、--compress-threads、--window-size 不会生效\n")
+		}
+		return opts, nil
+	}
+
+	levelSet := cmd.Flags().Changed("level")
+	minLevel, maxLevel := 1, 9
+	switch opts.format {
+	case compressZstd:
+		minLevel, maxLevel = 1, 22
+		if !levelSet {
+			opts.level = defaultZstdLevel
+		}
+	case compressGzip:
+		if !levelSet {
+			opts.level = defaultGzipLevel
+		}
+	case compressXz:
+		minLevel = 0
+		if !levelSet {
+			opts.level = defaultXzLevel
+		}
+	case compressBzip2:
+		if !levelSet {
+			opts.level = defaultBzip2Level
+		}
+	case compressLZ4:
+		if levelSet {
+			fmt.Fprintf(os.Stderr, "警告: lz4 只支持默认级别，忽略 --level\n")
+		}
+		minLevel, maxLevel = 0, 0
+		opts.level = 0
+	}
+	if opts.level < minLevel || opts.level > maxLevel {
+		return opts, fmt.Errorf("无效的 --level 参数: %d（%s 可选 %d-%d）", opts.level, opts.format, minLevel, maxLevel)
+	}
+
+	if opts.threads < 0 {
+		return opts, fmt.Errorf("无效的 --compress-threads 参数: %d", opts.threads)
+	}
+	if opts.threads == 0 {
+		opts.threads = runtime.NumCPU()
+	}
+
+	if windowStr != "" {
+		if opts.format != compressZstd && opts.format != compressXz {
+			fmt.Fprintf(os.Stderr, "警告: %s 不支持调整窗口大小，忽略 --window-size\n", opts.format)
+			return opts, nil
+		}
+		size, err := parseByteSize(windowStr)
+		// zstd 窗口必须是 2 的幂，xz 字典可以是范围内的任意大小
+		switch {
+		case opts.format == compressZstd && (err != nil || size < zstd.MinWindowSize || size > zstd.MaxWindowSize || size&(size-1) != 0):
+			return opts, fmt.Errorf("无效的 --window-size 参数: %s（zstd 窗口必须是 %s 到 %s 之间的 2 的幂）",
+				windowStr, formatBytes(zstd.MinWindowSize), formatBytes(zstd.MaxWindowSize))
+		case opts.format == compressXz && (err != nil || size < lzma.MinDictCap || size > lzma.MaxDictCap):
+			return opts, fmt.Errorf("无效的 --window-size 参数: %s（xz 字典必须在 %s 到 %s 之间）",
+				windowStr, formatBytes(lzma.MinDictCap), formatBytes(lzma.MaxDictCap))
+		}
+		opts.windowSize = int(size)
+	}
+
+	// 排队的数据约为线程数 × compressQueueDepth 个帧，zstd 和 xz 的帧随窗口扩大，
+	// 超过 compressMaxBuffer 时减少线程数（减少到 1 时改为单线程流式压缩，不再切分帧）
+	frameSize := opts.frameSize()
+	if opts.threads > 1 && opts.threads*compressQueueDepth*frameSize > compressMaxBuffer {
+		threads := max(compressMaxBuffer/(compressQueueDepth*frameSize), 1)
+		if cmd.Flags().Changed("compress-threads") {
+			fmt.Fprintf(os.Stderr, "警告: 每帧 %s 时 %d 个线程排队的数据会超过 %s，压缩线程数减少为 %d\n",
+				formatBytes(int64(frameSize)), opts.threads, formatBytes(compressMaxBuffer), threads)
+		}
+		opts.threads = threads
+	}
+	return opts, nil
+}
+
+// String 返回用于输出的压缩参数描述，例如 "zstd 级别 6，8 线程"
+func (o compressOptions) String() string {
+	if o.format == compressLZ4 {
+		return fmt.Sprintf("%s，%d 线程", o.format, o.threads)
+	}
+	if o.seekable {
+		return fmt.Sprintf("%s（seekable）级别 %d，%d 线程", o.format, o.level, o.threads)
+	}
+	return fmt.Sprintf("%s 级别 %d，%d 线程", o.format, o.level, o.threads)
+}
+
+// frameSize 返回并行压缩时每个独立帧的输入大小，zstd 和 xz 的每个帧至少容纳一个完整窗口，否则更大的窗口没有意义
+func (o compressOptions) frameSize() int {
+	switch o.format {
+	case compressZstd:
+		return max(compressFrameSize, o.windowSize)
+	case compressXz:
+		return max(compressFrameSize, o.xzWriterConfig().DictCap)
+	}
+	return compressFrameSize
+}
+
+// zstdEncoderOptions 返回对应的 zstd 编码器选项
+func (o compressOptions) zstdEncoderOptions() []zstd.EOption {
+	eopts := []zstd.EOption{
+		zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(o.level)),
+		zstd.WithEncoderConcurrency(o.threads),
+	}
+	if o.windowSize > 0 {
+		eopts = append(eopts, zstd.WithWindowSize(o.windowSize))
+	}
+	return eopts
+}
+
+// xzWriterConfig 返回对应级别的 xz 参数，级别只决定字典大小（与 xz 命令的预设一致）
+// 匹配算法固定使用 HashTable4：BinaryTree 压缩比没有更好，遇到高度重复的数据时还会慢上几个数量级。
+// 缓冲区使用 64KB：默认的 4KB 缓冲区加上小于 64KB 的字典时，写入会报 insufficient space
+func (o compressOptions) xzWriterConfig() xz.WriterConfig {
+	cfg := xz.WriterConfig{DictCap: xzDictSizes[o.level], BufSize: 64 << 10, Matcher: lzma.HashTable4}
+	if o.windowSize > 0 {
+		cfg.DictCap = o.windowSize
+	}
+	return cfg
+}
+
+// newCompressWriter 创建写入 w 的压缩器，opts.format 为 none 时返回 nil
+// 多线程时把输入切分为独立的帧（zstd 帧、gzip 成员、lz4 块、xz 流或 bzip2 流）并行压缩，按顺序拼接输出，
+// 结果仍是对应格式的标准数据，zstd、gzip、lz4、xz、bzip2 命令都能直接解压。
+// 单线程时 zstd、gzip、xz 使用流式压缩器，只输出一个帧
+func newCompressWriter(w io.Writer, opts compressOptions) (io.WriteCloser, error) {
+	switch opts.format {
+	case compressZstd:
+		if opts.seekable {
+			return newSeekableWriter(w, opts)
+		}
+		if opts.threads <= 1 {
+			return zstd.NewWriter(w, opts.zstdEncoderOptions()...)
+		}
+		encoder, err := zstd.NewWriter(nil, opts.zstdEncoderOptions()...)
+		if err != nil {
+			return nil, err
+		}
+		pw := newParallelWriter(w, opts.frameSize(), opts.threads, func(dst, src []byte) ([]byte, error) {
+			return encoder.EncodeAll(src, dst), nil
+		})
+		pw.onClose = func() { encoder.Close() }
+		return pw, nil
+
+	case compressGzip:
+		if opts.threads <= 1 {
+			return gzip.NewWriterLevel(w, opts.level)
+		}
+		// 每个块写成一个独立的 gzip 成员，gzip -d 会依次解压并拼接所有成员
+		return newParallelWriter(w, compressFrameSize, opts.threads, func(dst, src []byte) ([]byte, error) {
+			buf := bytes.NewBuffer(dst)
+			gz, err := gzip.NewWriterLevel(buf, opts.level)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := gz.Write(src); err != nil {
+				return nil, err
+			}
+			if err := gz.Close(); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), nil
+		}), nil
+
+	case compressLZ4:
+		return newLZ4Writer(w, opts.threads)
+
+	case compressXz:
+		cfg := opts.xzWriterConfig()
+		if opts.threads <= 1 {
+			return cfg.NewWriter(w)
+		}
+		// 每个块写成一个独立的 xz 流，xz -d 会依次解压所有流
+		return newParallelWriter(w, opts.frameSize(), opts.threads, func(dst, src []byte) ([]byte, error) {
+			buf := bytes.NewBuffer(dst)
+			xw, err := cfg.NewWriter(buf)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := xw.Write(src); err != nil {
+				return nil, err
+			}
+			if err := xw.Close(); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), nil
+		}), nil
+
+	case compressBzip2:
+		// 每个块写成一个独立的 bzip2 流（通常只包含一个 bzip2 块）
+		return newParallelWriter(w, opts.level*100000-19, opts.threads, func(dst, src []byte) ([]byte, error) {
+			return bzip2EncodeStream(dst, src, opts.level), nil
+		}), nil
+	}
+	return nil, nil
+}
+
+// newDecompressReader 创建读取 r 中压缩数据的解压器，format 为 none 时直接返回 r
+// 所有格式都支持多个帧（流、成员）拼接的数据
+func newDecompressReader(r io.Reader, format string) (io.ReadCloser, error) {
+	switch format {
+	case compressZstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("创建 zstd 解码器失败: %w", err)
+		}
+		return decoder.IOReadCloser(), nil
+	case compressGzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("创建 gzip 解码器失败: %w", err)
+		}
+		return gz, nil
+	case compressLZ4:
+		lr, err := newLZ4Reader(r)
+		if err != nil {
+			return nil, fmt.Errorf("创建 lz4 解码器失败: %w", err)
+		}
+		return io.NopCloser(lr), nil
+	case compressXz:
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("创建 xz 解码器失败: %w", err)
+		}
+		return io.NopCloser(xr), nil
+	case compressBzip2:
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	}
+	return io.NopCloser(r), nil
+}
+
+// detectCompressFormat 根据数据开头的魔数识别压缩格式，未压缩的 tar 包返回 none，无法识别时返回空字符串
+func detectCompressFormat(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return compressZstd
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return compressGzip
+	case bytes.HasPrefix(head, []byte{0x04, 0x22, 0x4d, 0x18}):
+		return compressLZ4
+	case bytes.HasPrefix(head, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		return compressXz
+	case len(head) >= 4 && bytes.HasPrefix(head, []byte("BZh")) && head[3] >= '1' && head[3] <= '9':
+		return compressBzip2
+	case isTarHeader(head):
+		return compressNone
+	}
+	return ""
+}
+
+// isTarHeader 判断 block 是否为 tar header：有 ustar 魔数，或者（旧 V7 格式）校验和正确
+func isTarHeader(block []byte) bool {
+	if len(block) < tarBlockSize {
+		return false
+	}
+	if bytes.HasPrefix(block[257:], []byte("ustar")) {
+		return true
+	}
+	field := bytes.Trim(block[148:156], " \x00")
+	if len(field) == 0 {
+		return false
+	}
+	expected, err := strconv.ParseInt(string(field), 8, 64)
+	if err != nil {
+		return false
+	}
+	var sum int64
+	for i, b := range block[:tarBlockSize] {
+		if i >= 148 && i < 156 {
+			b = ' '
+		}
+		sum += int64(b)
+	}
+	return sum == expected
+}
+
+// sniffCompressFormat 读取 r 开头的数据（不消耗）识别 name 的压缩格式
+// 识别结果与 format 不一致时给出警告并使用识别结果；无法识别时使用 format，format 为 auto 时返回错误
+func sniffCompressFormat(r *bufio.Reader, name, format string) (string, error) {
+	head, _ := r.Peek(tarBlockSize)
+	detected := detectCompressFormat(head)
+	switch {
+	case detected == "" && format == compressAuto:
+		return "", fmt.Errorf("无法识别 %s 的格式：既不是 tar 包，也不是支持的压缩格式（zstd、gzip、lz4、xz、bzip2）", name)
+	case detected == "":
+		return format, nil
+	case format != compressAuto && format != detected:
+		fmt.Fprintf(os.Stderr, "警告: %s 的压缩格式为 %s，忽略 --compress %s\n", name, detected, format)
+	}
+	return detected, nil
+}
+
+// compressBlock 并行压缩中的一个块
+type compressBlock struct {
+	src   []byte
+	dst   []byte
+	err   error
+	ready chan struct{}
+}
+
+// parallelWriter 把输入切分为固定大小的块，由多个协程并行压缩为独立的帧，
+// 单个写入协程按输入顺序写入 w；排队的块数受 threads*compressQueueDepth 限制
+type parallelWriter struct {
+	w         io.Writer
+	blockSize int
+	compress  func(dst, src []byte) ([]byte, error) // 将 src 压缩后追加到 dst
+	onClose   func()                                // 所有块写入后调用，释放压缩器
+	onBlock   func(rawSize, compressedSize int)     // 每个块写入后由写入协程按顺序调用（可选）
+
+	cur     *compressBlock      // 正在填充的块
+	tasks   chan *compressBlock // 等待压缩的块
+	queue   chan *compressBlock // 等待写入的块，按输入顺序
+	workers sync.WaitGroup
+	written chan struct{} // 写入协程退出后关闭
+	pool    sync.Pool     // 复用块的输入和输出缓冲区
+	closed  bool
+
+	mu       sync.Mutex
+	firstErr error // 第一个压缩或写入错误
+}
+
+// newParallelWriter 创建并行压缩写入器，启动 threads 个压缩协程和一个写入协程
+func newParallelWriter(w io.Writer, blockSize, threads int, compress func(dst, src []byte) ([]byte, error)) *parallelWriter {
+	p := &parallelWriter{
+		w:         w,
+		blockSize: blockSize,
+		compress:  compress,
+		tasks:     make(chan *compressBlock, threads),
+		queue:     make(chan *compressBlock, threads*compressQueueDepth),
+		written:   make(chan struct{}),
+	}
+	for i := 0; i < threads; i++ {
+		p.workers.Add(1)
+		go func() {
+			defer p.workers.Done()
+			for block := range p.tasks {
+				if p.err() == nil {
+					block.dst, block.err = p.compress(block.dst[:0], block.src)
+				}
+				close(block.ready)
+			}
+		}()
+	}
+	go p.writeLoop()
+	return p
+}
+
+// err 返回已发生的第一个错误
+func (p *parallelWriter) err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.firstErr
+}
+
+// setErr 记录第一个错误
+func (p *parallelWriter) setErr(err error) {
+	p.mu.Lock()
+	if p.firstErr == nil {
+		p.firstErr = err
+	}
+	p.mu.Unlock()
+}
+
+// writeLoop 按顺序等待块压缩完成并写入 w；出错后继续取出剩余的块，避免发送方阻塞
+func (p *parallelWriter) writeLoop() {
+	defer close(p.written)
+	for block := range p.queue {
+		<-block.ready
+		if p.err() == nil {
+			if block.err != nil {
+				p.setErr(block.err)
+			} else if _, err := p.w.Write(block.dst); err != nil {
+				p.setErr(err)
+			} else if p.onBlock != nil {
+				p.onBlock(len(block.src), len(block.dst))
+			}
+		}
+		p.pool.Put(block)
+	}
+}
+
+// getBlock 从池中取出一个块，复用上次的缓冲区
+func (p *parallelWriter) getBlock() *compressBlock {
+	if block, ok := p.pool.Get().(*compressBlock); ok {
+		block.src = block.src[:0]
+		block.err = nil
+		block.ready = make(chan struct{})
+		return block
+	}
+	return &compressBlock{src: make([]byte, 0, p.blockSize), ready: make(chan struct{})}
+}
+
+// submit 将正在填充的块发送压缩
+func (p *parallelWriter) submit() {
+	block := p.cur
+	p.cur = nil
+	p.queue <- block
+	p.tasks <- block
+}
+
+func (p *parallelWriter) Write(data []byte) (int, error) {
+	if p.closed {
+		return 0, fmt.Errorf("压缩写入器已关闭")
+	}
+	if err := p.err(); err != nil {
+		return 0, err
+	}
+	written := 0
+	for len(data) > 0 {
+		if p.cur == nil {
+			p.cur = p.getBlock()
+		}
+		n := p.blockSize - len(p.cur.src)
+		if n > len(data) {
+			n = len(data)
+		}
+		p.cur.src = append(p.cur.src, data[:n]...)
+		data = data[n:]
+		written += n
+		if len(p.cur.src) == p.blockSize {
+			p.submit()
+		}
+	}
+	return written, nil
+}
+
+// Close 压缩剩余的输入，等待所有块写入完成，返回压缩或写入过程中的第一个错误
+func (p *parallelWriter) Close() error {
+	if p.closed {
+		return p.err()
+	}
+	p.closed = true
+	if p.cur != nil && len(p.cur.src) > 0 {
+		p.submit()
+	}
+	close(p.tasks)
+	close(p.queue)
+	p.workers.Wait()
+	<-p.written
+	if p.onClose != nil {
+		p.onClose()
+	}
+	return p.err()
+}
+
+// countingWriter 统计写入的字节数，用于计算压缩比和速度
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
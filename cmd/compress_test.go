@@ -0,0 +1,123 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// testInput 压缩测试的一组输入
+type testInput struct {
+	name string
+	data []byte
+}
+
+// compressTestInputs 返回覆盖各种编码边界的输入：空输入、单字节游程、超过 255 的游程、
+// 不可压缩的数据，以及 bzip2 块（级别 1）和 lz4 块大小附近的长度
+func compressTestInputs(withLarge bool) []testInput {
+	rng := rand.New(rand.NewSource(1))
+	random := func(n int) []byte {
+		data := make([]byte, n)
+		rng.Read(data)
+		return data
+	}
+	bzip2Block := 1*100000 - 19
+
+	inputs := []testInput{
+		{"空输入", nil},
+		{"单字节", []byte{'a'}},
+		{"短文本", []byte("hello, hello, hello world")},
+	}
+	for _, n := range []int{2, 3, 4, 5, 15, 16, 19, 255, 256, 259, 260, 270, 1000, 65535, 65536, 70000} {
+		inputs = append(inputs, testInput{fmt.Sprintf("游程 %d", n), bytes.Repeat([]byte{'x'}, n)})
+	}
+	for _, n := range []int{1, 12, 13, 14, 15, 16, 270, 1000, 65536} {
+		inputs = append(inputs, testInput{fmt.Sprintf("随机 %d", n), random(n)})
+	}
+
+	// 字面量和匹配交替出现，长度跨过 15 和 15+255 的扩展字节边界
+	var mixed []byte
+	for _, n := range []int{1, 14, 15, 16, 269, 270, 271, 600} {
+		mixed = append(mixed, random(n)...)
+		mixed = append(mixed, bytes.Repeat([]byte{byte(n)}, n+4)...)
+	}
+	inputs = append(inputs, testInput{"字面量与匹配交替", mixed})
+
+	// 每 4 个相同字节在 bzip2 的 RLE1 中变为 5 个字节，块的切分位置与输入长度不同
+	inputs = append(inputs, testInput{"4 字节游程", bytes.Repeat([]byte("aaaab"), bzip2Block/5+100)})
+	for _, n := range []int{bzip2Block - 1, bzip2Block, bzip2Block + 1, 2*bzip2Block + 1} {
+		inputs = append(inputs, testInput{fmt.Sprintf("随机 %d（bzip2 块边界）", n), random(n)})
+	}
+
+	if withLarge {
+		for _, n := range []int{lz4BlockMaxSize - 1, lz4BlockMaxSize, lz4BlockMaxSize + 1} {
+			inputs = append(inputs, testInput{fmt.Sprintf("随机 %d（lz4 块边界）", n), random(n)})
+		}
+		text := bytes.Repeat([]byte("p-tool 并行压缩测试数据 0123456789\n"), 2*lz4BlockMaxSize/40)
+		inputs = append(inputs, testInput{"重复文本（多个块）", text})
+	}
+	return inputs
+}
+
+// compressRoundTrip 用 newCompressWriter 压缩 data，再用 newDecompressReader 解压
+func compressRoundTrip(t *testing.T, opts compressOptions, data []byte) []byte {
+	t.Helper()
+	var compressed bytes.Buffer
+	w, err := newCompressWriter(&compressed, opts)
+	if err != nil {
+		t.Fatalf("创建压缩器失败: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("压缩失败: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("压缩失败: %v", err)
+	}
+
+	if format := detectCompressFormat(compressed.Bytes()); format != opts.format {
+		t.Fatalf("魔数识别为 %q，应为 %q", format, opts.format)
+	}
+	r, err := newDecompressReader(&compressed, opts.format)
+	if err != nil {
+		t.Fatalf("创建解压器失败: %v", err)
+	}
+	defer r.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("解压失败: %v", err)
+	}
+	return out
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	formats := []compressOptions{
+		{format: compressLZ4, threads: 1},
+		{format: compressLZ4, threads: 4},
+		{format: compressBzip2, level: 1, threads: 1},
+		{format: compressBzip2, level: 1, threads: 4},
+		{format: compressZstd, level: defaultZstdLevel, threads: 4},
+		{format: compressGzip, level: defaultGzipLevel, threads: 4},
+		{format: compressXz, level: 0, threads: 4},
+	}
+	for _, opts := range formats {
+		// bzip2 的块排序较慢，不使用几 MB 的输入
+		inputs := compressTestInputs(opts.format != compressBzip2 && !testing.Short())
+		for _, in := range inputs {
+			// 没有输入时并行压缩不输出任何帧；tar 包至少包含结束标记，不会遇到这种情况
+			if len(in.data) == 0 && opts.format != compressLZ4 {
+				continue
+			}
+			t.Run(fmt.Sprintf("%s/%d 线程/%s", opts.format, opts.threads, in.name), func(t *testing.T) {
+				out := compressRoundTrip(t, opts, in.data)
+				if !bytes.Equal(out, in.data) {
+					t.Fatalf("解压结果不一致：长度 %d，应为 %d", len(out), len(in.data))
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,176 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/spf13/cobra"
+)
+
+// reflink 的使用方式（--reflink）
+const (
+	reflinkAuto   = "auto"   // 优先 reflink，不支持时依次退回 copy_file_range 和用户态复制（默认）
+	reflinkAlways = "always" // 必须使用 reflink，不支持时复制失败
+	reflinkNever  = "never"  // 不使用 reflink，优先 copy_file_range
+)
+
+// copyMethodStats 统计每种复制方式处理的文件数，并按设备组合记住不支持的方式，避免每个文件都重复尝试
+type copyMethodStats struct {
+	reflink   int64 // FICLONE
+	copyRange int64 // copy_file_range
+	buffered  int64 // 用户态缓冲复制
+	chunked   int64 // 大文件分块并行复制（pread/pwrite）
+	sparse    int64 // 只复制数据区域、保留空洞的稀疏文件
+
+	noReflink   sync.Map // devicePair → 已确认不支持 reflink
+	noCopyRange sync.Map // devicePair → 已确认不支持 copy_file_range
+	disabled    int32    // 两个 map 中的记录数，为 0 时无需获取设备号
+}
+
+// devicePair 源文件和目标文件所在的设备
+// reflink 和 copy_file_range 是否可用取决于这两个文件系统，不支持的方式按设备组合记录，
+// 源目录跨多个文件系统时，一个文件系统不支持不会影响其他文件
+type devicePair struct {
+	src, dst uint64
+}
+
+// lazyDevices 返回按需获取两个文件所在设备的函数，结果只获取一次（不支持 inode 的平台上均为 0）
+func lazyDevices(dst, src *os.File) func() devicePair {
+	var pair devicePair
+	done := false
+	return func() devicePair {
+		if !done {
+			done = true
+			if info, err := src.Stat(); err == nil {
+				if id, ok := inodeID(info); ok {
+					pair.src = id.dev
+				}
+			}
+			if info, err := dst.Stat(); err == nil {
+				if id, ok := inodeID(info); ok {
+					pair.dst = id.dev
+				}
+			}
+		}
+		return pair
+	}
+}
+
+// methodDisabled 判断该设备组合是否已确认不支持 methods 对应的复制方式
+func (s *copyMethodStats) methodDisabled(methods *sync.Map, devices func() devicePair) bool {
+	if atomic.LoadInt32(&s.disabled) == 0 {
+		return false
+	}
+	_, ok := methods.Load(devices())
+	return ok
+}
+
+// disableMethod 记录该设备组合不支持 methods 对应的复制方式
+func (s *copyMethodStats) disableMethod(methods *sync.Map, devices func() devicePair) {
+	if _, loaded := methods.LoadOrStore(devices(), true); !loaded {
+		atomic.AddInt32(&s.disabled, 1)
+	}
+}
+
+// addReflinkFlag 为命令添加 --reflink 参数
+func addReflinkFlag(cmd *cobra.Command) {
+	cmd.Flags().String("reflink", reflinkAuto, "reflink 使用方式：auto（优先 reflink，依次退回 copy_file_range 和普通复制）、always（必须 reflink）、never（不使用 reflink）")
+}
+
+// reflinkFromFlags 读取并校验 --reflink 参数
+func reflinkFromFlags(cmd *cobra.Command) (string, error) {
+	mode, _ := cmd.Flags().GetString("reflink")
+	switch mode {
+	case reflinkAuto, reflinkAlways, reflinkNever:
+		return mode, nil
+	}
+	return "", fmt.Errorf("无效的 --reflink 参数: %s（可选 auto、always、never）", mode)
+}
+
+// copyFileContent 将源文件内容复制到目标文件，依次尝试 reflink、copy_file_range 和用户态缓冲复制
+// 稀疏文件不使用 copy_file_range 和缓冲复制（会把空洞写成零），而是只复制数据区域并保留空洞
+// 返回复制的字节数
+func copyFileContent(dst, src *os.File, opts copyOptions) (int64, error) {
+	stats := opts.methods
+	if stats == nil {
+		stats = &copyMethodStats{}
+	}
+	devices := lazyDevices(dst, src)
+
+	if opts.reflink != reflinkNever && (opts.reflink == reflinkAlways || !stats.methodDisabled(&stats.noReflink, devices)) {
+		err := cloneFile(dst, src)
+		if err == nil {
+			atomic.AddInt64(&stats.reflink, 1)
+			info, err := src.Stat()
+			if err != nil {
+				return 0, nil
+			}
+			return info.Size(), nil
+		}
+		if opts.reflink == reflinkAlways {
+			return 0, fmt.Errorf("无法创建 reflink: %w", err)
+		}
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return 0, err
+		}
+		stats.disableMethod(&stats.noReflink, devices)
+	}
+
+	// 稀疏文件只复制数据区域
+	if info, err := src.Stat(); err == nil && isSparseFile(info) {
+		segments, err := dataSegments(src, 0, info.Size())
+		if err == nil {
+			if err := copySparseFile(dst, src, info.Size(), segments); err != nil {
+				return 0, err
+			}
+			atomic.AddInt64(&stats.sparse, 1)
+			return info.Size(), nil
+		}
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return 0, err
+		}
+	}
+
+	if !stats.methodDisabled(&stats.noCopyRange, devices) {
+		n, err := copyFileRange(dst, src)
+		if err == nil {
+			atomic.AddInt64(&stats.copyRange, 1)
+			return n, nil
+		}
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return n, err
+		}
+		stats.disableMethod(&stats.noCopyRange, devices)
+	}
+
+	// 为源文件添加缓冲读取（小文件场景优化：减少系统调用）
+	bufferedReader := bufio.NewReaderSize(src, 64*1024)
+	// 使用带缓冲的 Writer 提高 I/O 性能（64KB 缓冲区）
+	bufferedWriter := bufio.NewWriterSize(dst, 64*1024)
+
+	n, err := io.Copy(bufferedWriter, bufferedReader)
+	if err == nil {
+		err = bufferedWriter.Flush()
+	}
+	if err == nil {
+		atomic.AddInt64(&stats.buffered, 1)
+	}
+	return n, err
+}
+
+// print 输出每种复制方式处理的文件数
+func (s *copyMethodStats) print() {
+	if s == nil {
+		return
+	}
+	fmt.Fprintf(os.Stdout, "\n复制方式: reflink %d 个文件，copy_file_range %d 个文件，普通复制 %d 个文件，分块并行复制 %d 个文件，稀疏复制 %d 个文件\n",
+		atomic.LoadInt64(&s.reflink), atomic.LoadInt64(&s.copyRange), atomic.LoadInt64(&s.buffered), atomic.LoadInt64(&s.chunked), atomic.LoadInt64(&s.sparse))
+}
@@ -4,9 +4,8 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -29,141 +28,461 @@ var cpCmd = &cobra.Command{
 - 自动在内存中生成 manifest 列表（如果未指定 manifest 文件）
 - 并行复制文件，提高复制速度
 - 显示复制进度
+- 使用 --preserve 保留元数据（mode、timestamps、ownership、xattr），-a 等同于 --preserve=all；
+  文件在内容写入后设置，目录的元数据在所有文件复制完成后从深到浅统一恢复
+- 使用 --update 增量复制，跳过大小和修改时间与目标一致的文件（详见 sync 命令），
+  配合 --checksum 改为比较内容校验和
+- 使用 --delete 镜像复制：先并行删除目标目录中 manifest 未列出的文件和空目录（被过滤规则排除的路径保留），
+  --delete-dry-run 只列出将被删除的路径；删除比例超过 --delete-threshold（默认 50%）时拒绝执行
+  源目录有无法读取的目录时跳过删除（仍复制能读取的文件），并以非零状态退出
+- 复制过程中按批次将已完成的条目写入 journal（默认为目标目录旁边的 .<目标目录名>.ptool-journal，
+  可用 --journal 指定），全部成功后自动删除；中断或有文件失败时使用 --resume 跳过已完成的条目继续复制，
+  最后一批记录的文件会重新检查大小，不完整的重新复制
+- 使用 --atomic 时每个文件先写入同目录的临时文件 .<文件名>.ptool-tmp，写完后再重命名到目标路径，
+  崩溃或并发读取时不会看到写了一半的文件；开始复制前会自动清理上次中断遗留的临时文件
+- 使用 --fsync-mode 控制持久化：none（默认）、file（每个文件 fsync）、end（结束时对目标文件系统执行一次 syncfs，
+  同 --sync）、dir（每个文件 fsync，最后再 fsync 所有写入过条目的目录）；同步阶段的耗时单独输出
+- Linux 上优先使用 reflink（FICLONE，btrfs、XFS 等）共享数据块，不支持时使用 copy_file_range 在内核中复制，
+  都不支持时退回用户态缓冲复制；--reflink=always 要求必须 reflink，--reflink=never 不使用 reflink，
+  完成后输出每种方式复制的文件数
+- 超过 --chunk-threshold（默认 256MB）的大文件拆分为 --chunk-size（默认 32MB）的分块，
+  由协程池中的多个协程使用 pread/pwrite 并发复制，分块与小文件共用同一个协程池
+- 稀疏文件（虚拟机镜像、数据库文件等）使用 SEEK_DATA/SEEK_HOLE 找出数据区域，只复制数据，
+  空洞在目标文件中保留为空洞，不会被写成零
+- --order 指定任务调度顺序：manifest（默认）、largest-first（大文件优先，避免大文件排在最后
+  形成长尾）、locality（按 inode 顺序读取，适合机械硬盘）
 
 示例：
   p-tool cp /source /dest
   p-tool cp /source /dest --manifest-file /tmp/manifest.txt
-  p-tool cp /source /dest --concurrency 8`,
+  p-tool cp /source /dest --concurrency 8
+  p-tool cp /source /dest --exclude node_modules/.cache --exclude '*.tmp'
+  p-tool cp /source /dest --preserve mode,timestamps
+  p-tool cp /source /dest -a
+  p-tool cp /source /dest --update
+  p-tool cp /source /dest --update --checksum xxh3
+  p-tool cp /source /dest --update --delete
+  p-tool cp /source /dest --delete-dry-run
+  p-tool cp /source /dest --resume
+  p-tool cp /source /dest --atomic
+  p-tool cp /source /dest --sync
+  p-tool cp /source /dest --atomic --fsync-mode dir
+  p-tool cp /source /dest --reflink always
+  p-tool cp /source /dest --chunk-threshold 1GB --chunk-size 64MB
+  p-tool cp /source /dest --order largest-first`,
 	Args: cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
-		sourceDir := args[0]
-		destDir := args[1]
+		update, _ := cmd.Flags().GetBool("update")
+		runCopy(cmd, args, update)
+	},
+}
 
-		manifestFile, _ := cmd.Flags().GetString("manifest-file")
-		concurrency, _ := cmd.Flags().GetInt("concurrency")
+func init() {
+	rootCmd.AddCommand(cpCmd)
 
-		// 验证源目录
-		sourceInfo, err := os.Stat(sourceDir)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "错误: 无法访问源目录 %s: %v\n", sourceDir, err)
+	addCopyFlags(cpCmd)
+	cpCmd.Flags().Bool("update", false, "增量复制，只复制大小或修改时间与目标不一致的文件（同 sync 命令）")
+}
+
+// addCopyFlags 添加 cp 和 sync 命令共用的参数
+func addCopyFlags(cmd *cobra.Command) {
+	cmd.Flags().String("manifest-file", "", "指定 manifest 文件路径（可选）")
+	cmd.Flags().Int("concurrency", 0, "指定并发数量，默认为 CPU 核数")
+	cmd.Flags().String("checksum", "", "增量复制时比较内容校验和而不是修改时间（xxh3、sha256、blake3）")
+	addFilterFlags(cmd)
+	addSymlinksFlag(cmd)
+	addPreserveFlags(cmd)
+	addDeleteFlags(cmd)
+	addFsyncFlags(cmd)
+	addReflinkFlag(cmd)
+	cmd.Flags().String("chunk-threshold", defaultChunkThreshold, "超过该大小的文件拆分为多个分块并行复制（如 256MB、1GB），0 表示不分块")
+	cmd.Flags().String("chunk-size", defaultChunkSize, "大文件分块并行复制时每个分块的大小")
+	addOrderFlag(cmd)
+	cmd.Flags().String("journal", "", "journal 文件路径，记录已完成的条目用于中断后继续，默认为目标目录旁边的 .<目标目录名>.ptool-journal")
+	cmd.Flags().Bool("resume", false, "根据 journal 跳过上次已完成的条目，继续中断的复制")
+	cmd.Flags().Bool("atomic", false, "先写入同目录的临时文件 .<文件名>.ptool-tmp，完成后再重命名到目标路径")
+}
+
+// copyOptions 复制文件时的选项
+type copyOptions struct {
+	preserve preserveOptions // 需要保留的元数据
+	atomic   bool            // 先写入临时文件再重命名，避免出现写了一半的目标文件
+	sync     *durability     // 持久化方式
+	reflink  string          // reflink 使用方式（auto、always、never）
+	methods  *copyMethodStats
+
+	chunkThreshold int64 // 超过该大小的文件拆分为多个分块并行复制，0 表示不分块
+	chunkSize      int64 // 每个分块的大小
+
+	order string // 任务调度顺序（manifest、largest-first、locality）
+}
+
+// runCopy 执行 cp / sync 命令
+// update 为 true 时只复制与目标目录不一致的文件（增量同步），并保留修改时间以便下次比较
+func runCopy(cmd *cobra.Command, args []string, update bool) {
+	sourceDir := args[0]
+	destDir := args[1]
+
+	manifestFile, _ := cmd.Flags().GetString("manifest-file")
+	concurrency, _ := cmd.Flags().GetInt("concurrency")
+	checksumAlgo, _ := cmd.Flags().GetString("checksum")
+	journalPath, _ := cmd.Flags().GetString("journal")
+	resume, _ := cmd.Flags().GetBool("resume")
+	atomicWrite, _ := cmd.Flags().GetBool("atomic")
+
+	// 解析需要保留的元数据
+	preserve, err := preserveFromFlags(cmd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	deleteOpts, err := deleteFromFlags(cmd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	dur, err := durabilityFromFlags(cmd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	reflink, err := reflinkFromFlags(cmd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	order, err := orderFromFlags(cmd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 解析大文件分块参数
+	chunkThresholdStr, _ := cmd.Flags().GetString("chunk-threshold")
+	chunkThreshold, err := parseByteSize(chunkThresholdStr)
+	if err != nil || chunkThreshold < 0 {
+		fmt.Fprintf(os.Stderr, "错误: 无效的 --chunk-threshold 参数: %s\n", chunkThresholdStr)
+		os.Exit(1)
+	}
+	chunkSizeStr, _ := cmd.Flags().GetString("chunk-size")
+	chunkSize, err := parseByteSize(chunkSizeStr)
+	if err != nil || chunkSize <= 0 {
+		fmt.Fprintf(os.Stderr, "错误: 无效的 --chunk-size 参数: %s\n", chunkSizeStr)
+		os.Exit(1)
+	}
+
+	if checksumAlgo != "" {
+		if !update {
+			fmt.Fprintf(os.Stderr, "错误: --checksum 只能在增量复制（--update 或 sync）时使用\n")
 			os.Exit(1)
 		}
-		if !sourceInfo.IsDir() {
-			fmt.Fprintf(os.Stderr, "错误: %s 不是一个目录\n", sourceDir)
+		if _, err := newChecksumHash(checksumAlgo); err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
 			os.Exit(1)
 		}
+	}
+
+	// 增量复制依赖修改时间判断文件是否变化，需要保留修改时间
+	if update {
+		preserve.timestamps = true
+	}
+
+	// 验证源目录
+	sourceInfo, err := os.Stat(sourceDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: 无法访问源目录 %s: %v\n", sourceDir, err)
+		os.Exit(1)
+	}
+	if !sourceInfo.IsDir() {
+		fmt.Fprintf(os.Stderr, "错误: %s 不是一个目录\n", sourceDir)
+		os.Exit(1)
+	}
 
-		// 获取源目录绝对路径
-		absSourceDir, err := filepath.Abs(sourceDir)
+	// 获取源目录绝对路径
+	absSourceDir, err := filepath.Abs(sourceDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: 无法获取源目录绝对路径: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 解析过滤规则和忽略文件
+	scanOpts, err := scanOptionsFromFlags(cmd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+	scanOpts.Concurrency = concurrency
+	// 镜像模式下源目录中的空目录同样需要保留（并在目标目录中创建），扫描时记录目录条目
+	scanOpts.IncludeDirs = deleteOpts.enabled
+
+	var fileList []ManifestEntry
+	var manifestAlgo string
+	var sourceIncomplete bool // 源目录有无法读取的子目录，manifest 不完整
+
+	// 如果未指定 manifest 文件，在内存中生成
+	if manifestFile == "" {
+		var err error
+		fileList, err = GenerateManifestInMemory(absSourceDir, scanOpts)
+		sourceIncomplete = errors.Is(err, errScanIncomplete)
+		if err = warnScanIncomplete(err); err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 生成 manifest 失败: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		// 读取 manifest 文件
+		fileList, manifestAlgo, err = readManifestWithChecksum(manifestFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 读取 manifest 文件失败: %v\n", err)
+			os.Exit(1)
+		}
+		// 对 manifest 中的路径同样应用过滤规则和忽略文件
+		fileList, err = filterManifestEntries(absSourceDir, fileList, scanOpts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "错误: 无法获取源目录绝对路径: %v\n", err)
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
 			os.Exit(1)
 		}
+	}
 
-		var fileList []string
+	if len(fileList) == 0 {
+		fmt.Fprintf(os.Stderr, "错误: manifest 文件为空\n")
+		os.Exit(1)
+	}
+
+	// 源目录扫描不完整时，无法读取的目录在目标中对应的内容都会被当作多余的条目，
+	// 与 rsync 遇到 I/O 错误时一样跳过删除，只复制能读取到的文件，最后以非零状态退出
+	deleteSkipped := deleteOpts.enabled && sourceIncomplete
+	if deleteSkipped {
+		fmt.Fprintf(os.Stderr, "错误: 源目录扫描不完整，跳过删除目标目录中多余的条目\n")
+		if deleteOpts.dryRun {
+			os.Exit(1)
+		}
+	}
+	exitIfDeleteSkipped := func() {
+		if deleteSkipped {
+			fmt.Fprintf(os.Stderr, "错误: 源目录扫描不完整，已跳过删除\n")
+			os.Exit(1)
+		}
+	}
 
-		// 如果未指定 manifest 文件，在内存中生成
-		if manifestFile == "" {
-			var err error
-			fileList, err = GenerateManifestInMemory(absSourceDir)
+	// 镜像模式：找出目标目录中 manifest 未列出的文件和目录
+	var extraFiles, extraDirs []string
+	if deleteOpts.enabled && !deleteSkipped {
+		if _, err := os.Stat(destDir); err == nil {
+			var total int
+			extraFiles, extraDirs, total, err = findExtraneousEntries(destDir, fileList, scanOpts)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "错误: 生成 manifest 失败: %v\n", err)
+				fmt.Fprintf(os.Stderr, "错误: 扫描目标目录失败: %v\n", err)
 				os.Exit(1)
 			}
-		} else {
-			// 读取 manifest 文件
-			fileList, err = readManifest(manifestFile)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "错误: 读取 manifest 文件失败: %v\n", err)
+			count := len(extraFiles) + len(extraDirs)
+			thresholdErr := checkDeleteThreshold(count, total, deleteOpts.maxPercent)
+
+			if deleteOpts.dryRun {
+				printPathList("将被删除的文件", extraFiles)
+				printPathList("将被删除的目录", extraDirs)
+				fmt.Fprintf(os.Stdout, "共 %d 个条目将被删除（目标目录共 %d 个条目）\n", count, total)
+				if thresholdErr != nil {
+					fmt.Fprintf(os.Stderr, "警告: %v\n", thresholdErr)
+				}
+				return
+			}
+			if thresholdErr != nil {
+				fmt.Fprintf(os.Stderr, "错误: %v\n", thresholdErr)
 				os.Exit(1)
 			}
+		} else if deleteOpts.dryRun {
+			fmt.Fprintf(os.Stdout, "目标目录不存在，没有需要删除的条目\n")
+			return
 		}
+	}
 
-		if len(fileList) == 0 {
-			fmt.Fprintf(os.Stderr, "错误: manifest 文件为空\n")
-			os.Exit(1)
+	// 目录条目不需要复制内容，在删除多余的条目之后直接创建
+	fileList, dirEntries := splitDirEntries(fileList)
+
+	// 创建目标目录
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: 无法创建目标目录 %s: %v\n", destDir, err)
+		os.Exit(1)
+	}
+
+	// 获取目标目录绝对路径
+	absDestDir, err := filepath.Abs(destDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: 无法获取目标目录绝对路径: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 设置并发数
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+
+	// 清理上次中断遗留的临时文件
+	if atomicWrite {
+		removed, err := removeAtomicTempFiles(absDestDir, concurrency)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "警告: 清理临时文件失败: %v\n", err)
+		} else if removed > 0 {
+			fmt.Fprintf(os.Stdout, "已清理上次中断遗留的 %d 个临时文件\n", removed)
 		}
+	}
 
-		// 创建目标目录
-		if err := os.MkdirAll(destDir, 0755); err != nil {
-			fmt.Fprintf(os.Stderr, "错误: 无法创建目标目录 %s: %v\n", destDir, err)
+	// 先删除多余的条目，避免与需要复制的路径类型冲突（例如目标中同名的目录）
+	if len(extraFiles)+len(extraDirs) > 0 {
+		fmt.Fprintf(os.Stdout, "删除目标目录中多余的 %d 个文件和 %d 个目录...\n", len(extraFiles), len(extraDirs))
+		if err := deleteExtraneous(absDestDir, extraFiles, extraDirs, concurrency); err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
 			os.Exit(1)
 		}
+	}
+	for i := range dirEntries {
+		if err := os.MkdirAll(filepath.Join(absDestDir, dirEntries[i].Path), 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "警告: 创建目录失败: %v\n", err)
+		}
+	}
+	// finishDirs 所有文件写入后恢复目录条目的元数据，写入文件会更新目录的修改时间
+	finishDirs := func() {
+		if preserve.any() && len(dirEntries) > 0 {
+			preserveDirectories(absSourceDir, absDestDir, dirEntries, preserve)
+		}
+	}
 
-		// 获取目标目录绝对路径
-		absDestDir, err := filepath.Abs(destDir)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "错误: 无法获取目标目录绝对路径: %v\n", err)
+	// 继续中断的复制：跳过 journal 中已完成的条目
+	if journalPath == "" {
+		journalPath = defaultJournalPath(absDestDir)
+	}
+	if resume {
+		state, err := readJournal(journalPath, absSourceDir, absDestDir)
+		switch {
+		case os.IsNotExist(err):
+			fmt.Fprintf(os.Stderr, "警告: 未找到 journal 文件 %s，将完整复制\n", journalPath)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
 			os.Exit(1)
+		default:
+			remaining, recheck := skipCompletedEntries(absDestDir, fileList, state)
+			fmt.Fprintf(os.Stdout, "根据 journal 跳过 %d 个已完成的条目", len(fileList)-len(remaining))
+			if recheck > 0 {
+				fmt.Fprintf(os.Stdout, "（最后一批中有 %d 个不完整，将重新复制）", recheck)
+			}
+			fmt.Fprintf(os.Stdout, "\n")
+			fileList = remaining
 		}
+	}
 
-		// 设置并发数
-		if concurrency <= 0 {
-			concurrency = runtime.NumCPU()
-		}
+	// 记录复制进度，全部成功后删除
+	journal, err := openJournal(journalPath, absSourceDir, absDestDir, resume)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "警告: %v，中断后将无法继续复制\n", err)
+	}
+
+	// 增量复制：跳过目标目录中已一致的文件
+	if update {
+		fmt.Fprintf(os.Stdout, "对比源目录和目标目录中（%d 个文件）...\n", len(fileList))
+		changed := selectChangedEntries(absSourceDir, absDestDir, fileList, checksumAlgo, manifestAlgo, concurrency)
+		fmt.Fprintf(os.Stdout, "跳过 %d 个未变化的文件，需要复制 %d 个文件\n", len(fileList)-len(changed), len(changed))
+		fileList = changed
+	}
 
-		fmt.Fprintf(os.Stdout, "开始复制 %d 个文件（并发数: %d）...\n", len(fileList), concurrency)
+	if len(fileList) == 0 {
+		journal.remove()
+		fmt.Fprintf(os.Stdout, "\n目标目录已是最新，无需复制\n")
+		finishDirs()
+		exitIfDeleteSkipped()
+		return
+	}
 
-		// 预创建所有目录（小文件场景优化：避免并发时重复创建目录）
-		fmt.Fprintf(os.Stdout, "预创建目录结构中...\n")
-		if err := precreateDirectories(absDestDir, fileList, concurrency); err != nil {
-			fmt.Fprintf(os.Stderr, "警告: 预创建目录失败，将按需创建: %v\n", err)
-		}
+	fmt.Fprintf(os.Stdout, "开始复制 %d 个文件（并发数: %d）...\n", len(fileList), concurrency)
 
-		// 并行复制文件
-		if err := copyFilesParallel(absSourceDir, absDestDir, fileList, concurrency); err != nil {
-			fmt.Fprintf(os.Stderr, "错误: 复制文件失败: %v\n", err)
-			os.Exit(1)
+	// 预创建所有目录（小文件场景优化：避免并发时重复创建目录）
+	fmt.Fprintf(os.Stdout, "预创建目录结构中...\n")
+	if err := precreateDirectories(absDestDir, fileList, concurrency); err != nil {
+		fmt.Fprintf(os.Stderr, "警告: 预创建目录失败，将按需创建: %v\n", err)
+	}
+
+	// 并行复制文件
+	copyOpts := copyOptions{
+		preserve:       preserve,
+		atomic:         atomicWrite,
+		sync:           dur,
+		reflink:        reflink,
+		methods:        &copyMethodStats{},
+		chunkThreshold: chunkThreshold,
+		chunkSize:      chunkSize,
+		order:          order,
+	}
+	err = copyFilesParallel(absSourceDir, absDestDir, fileList, concurrency, copyOpts, journal)
+	copyOpts.methods.print()
+	if err != nil {
+		journal.close()
+		fmt.Fprintf(os.Stderr, "错误: 复制文件失败: %v\n", err)
+		if journal != nil {
+			fmt.Fprintf(os.Stderr, "修复问题后可使用 --resume 跳过已完成的条目继续复制\n")
 		}
+		os.Exit(1)
+	}
 
-		fmt.Fprintf(os.Stdout, "\n复制完成！\n")
-	},
-}
+	// 同步到磁盘（journal 在数据落盘后再删除）
+	if err := dur.finish(absDestDir, dirsToSync(absDestDir, manifestPaths(fileList)), concurrency); err != nil {
+		journal.close()
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+	journal.remove()
+	finishDirs()
 
-func init() {
-	rootCmd.AddCommand(cpCmd)
+	fmt.Fprintf(os.Stdout, "\n复制完成！\n")
+	exitIfDeleteSkipped()
+}
 
-	cpCmd.Flags().String("manifest-file", "", "指定 manifest 文件路径（可选）")
-	cpCmd.Flags().Int("concurrency", 0, "指定并发数量，默认为 CPU 核数")
+// readManifest 读取 manifest 文件，返回文件条目列表（兼容旧的每行一个路径的格式）
+func readManifest(manifestPath string) ([]ManifestEntry, error) {
+	fileList, _, err := readManifestWithChecksum(manifestPath)
+	return fileList, err
 }
 
-// readManifest 读取 manifest 文件，返回文件相对路径列表
-func readManifest(manifestPath string) ([]string, error) {
+// readManifestWithChecksum 读取 manifest 文件，同时返回记录校验和所用的算法
+func readManifestWithChecksum(manifestPath string) ([]ManifestEntry, string, error) {
 	file, err := os.Open(manifestPath)
 	if err != nil {
-		return nil, fmt.Errorf("无法打开 manifest 文件: %w", err)
+		return nil, "", fmt.Errorf("无法打开 manifest 文件: %w", err)
 	}
 	defer file.Close()
 
-	var fileList []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			// 移除开头的 ./
-			line = strings.TrimPrefix(line, "./")
-			fileList = append(fileList, line)
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("读取 manifest 文件时出错: %w", err)
+	fileList, checksumAlgo, err := parseManifest(file)
+	if err != nil {
+		return nil, "", fmt.Errorf("读取 manifest 文件时出错: %w", err)
 	}
 
-	return fileList, nil
+	return fileList, checksumAlgo, nil
 }
 
 // copyFilesParallel 并行复制文件
-func copyFilesParallel(sourceDir, destDir string, fileList []string, concurrency int) error {
+// opts.preserve 指定需要保留的元数据：文件在内容写入后立即设置，目录在所有文件复制完成后统一设置
+// journal 不为 nil 时记录复制成功的条目
+func copyFilesParallel(sourceDir, destDir string, fileList []ManifestEntry, concurrency int, opts copyOptions, journal *copyJournal) error {
+	preserve := opts.preserve
 	totalFiles := int64(len(fileList))
 	var copiedFiles int64
 	var failedFiles int64
+	var copiedBytes int64
+
+	// manifest 带有大小信息时显示数据量进度（旧格式 manifest 为 -1，不显示）
+	totalBytes := manifestTotalSize(fileList)
+
+	// 按 --order 决定任务的发送顺序（需要时先 stat 源文件）
+	ordered := orderEntries(sourceDir, fileList, opts.order, concurrency)
 
 	// 记录开始时间，用于计算每秒文件数
 	startTime := time.Now()
 
 	// 创建任务通道（增大缓冲区，避免生产者阻塞）
-	taskChan := make(chan string, concurrency*2)
+	// 大文件拆分为多个分块任务，与小文件共用同一个协程池
+	taskChan := make(chan copyTask, concurrency*2)
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 
@@ -178,58 +497,171 @@ func copyFilesParallel(sourceDir, destDir string, fileList []string, concurrency
 		for {
 			select {
 			case <-ticker.C:
-				updateProgress(atomic.LoadInt64(&copiedFiles), totalFiles, startTime)
+				updateProgress(atomic.LoadInt64(&copiedFiles), totalFiles, atomic.LoadInt64(&copiedBytes), totalBytes, startTime)
 			case <-progressDone:
 				return
 			}
 		}
 	}()
 
+	// finishEntry 条目的内容写入完成（或失败）后设置元数据、记录 journal 并更新统计
+	finishEntry := func(entry *ManifestEntry, err error) {
+		sourcePath := filepath.Join(sourceDir, entry.Path)
+		destPath := filepath.Join(destDir, entry.Path)
+
+		// 内容写入完成后设置元数据
+		if err == nil && preserve.any() {
+			if err := applyPreservedMetadata(sourcePath, destPath, entry.Type == manifestTypeSymlink, preserve); err != nil {
+				mu.Lock()
+				fmt.Fprintf(os.Stderr, "警告: 保留元数据失败 %s: %v\n", destPath, err)
+				mu.Unlock()
+			}
+		}
+
+		if err != nil {
+			// 区分文件不存在和其他错误
+			if os.IsNotExist(err) {
+				mu.Lock()
+				fmt.Fprintf(os.Stderr, "警告: 源文件不存在: %s\n", sourcePath)
+				mu.Unlock()
+				atomic.AddInt64(&failedFiles, 1)
+			} else {
+				mu.Lock()
+				fmt.Fprintf(os.Stderr, "警告: 复制文件失败 %s -> %s: %v\n", sourcePath, destPath, err)
+				mu.Unlock()
+				atomic.AddInt64(&failedFiles, 1)
+			}
+		} else {
+			journal.record(entry.Path)
+		}
+
+		atomic.AddInt64(&copiedFiles, 1)
+	}
+
+	// sendChunks 打开大文件并将其拆分为分块任务发送给协程池
+	sendChunks := func(entry *ManifestEntry) {
+		sourcePath := filepath.Join(sourceDir, entry.Path)
+		destPath := filepath.Join(destDir, entry.Path)
+		if err := ensureDestDir(destPath, &dirCache); err != nil {
+			finishEntry(entry, err)
+			return
+		}
+		file, cloned, err := openChunkedFile(sourcePath, destPath, opts)
+		if err != nil {
+			finishEntry(entry, err)
+			return
+		}
+		if cloned {
+			atomic.AddInt64(&copiedBytes, file.size)
+			finishEntry(entry, file.finish(opts.sync))
+			return
+		}
+
+		tasks := file.split(entry, opts.chunkSize)
+		if len(tasks) == 0 {
+			// 源文件在扫描后被清空
+			finishEntry(entry, file.finish(opts.sync))
+			return
+		}
+		if opts.methods != nil {
+			atomic.AddInt64(&opts.methods.chunked, 1)
+			if file.sparse {
+				atomic.AddInt64(&opts.methods.sparse, 1)
+			}
+		}
+		for _, task := range tasks {
+			taskChan <- task
+		}
+	}
+
 	// 启动工作协程
 	for i := 0; i < concurrency; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for relPath := range taskChan {
-				sourcePath := filepath.Join(sourceDir, relPath)
-				destPath := filepath.Join(destDir, relPath)
-
-				// 复制文件（移除 Stat 检查，直接尝试打开，减少系统调用）
-				if err := copyFile(sourcePath, destPath, &dirCache); err != nil {
-					// 区分文件不存在和其他错误
-					if os.IsNotExist(err) {
-						mu.Lock()
-						fmt.Fprintf(os.Stderr, "警告: 源文件不存在: %s\n", sourcePath)
-						mu.Unlock()
-						atomic.AddInt64(&failedFiles, 1)
-					} else {
-						mu.Lock()
-						fmt.Fprintf(os.Stderr, "警告: 复制文件失败 %s -> %s: %v\n", sourcePath, destPath, err)
-						mu.Unlock()
-						atomic.AddInt64(&failedFiles, 1)
+			for task := range taskChan {
+				entry := task.entry
+
+				// 大文件的一个分块，最后完成的分块负责收尾
+				if task.file != nil {
+					n, err := task.file.copyRange(task.offset, task.length)
+					atomic.AddInt64(&copiedBytes, n)
+					if task.file.chunkDone(err) {
+						finishEntry(entry, task.file.finish(opts.sync))
 					}
+					continue
 				}
 
-				atomic.AddInt64(&copiedFiles, 1)
+				sourcePath := filepath.Join(sourceDir, entry.Path)
+				destPath := filepath.Join(destDir, entry.Path)
+
+				var n int64
+				var err error
+				if entry.Type == manifestTypeSymlink {
+					// 符号链接按链接本身复制
+					err = copySymlink(sourcePath, destPath, &dirCache)
+				} else {
+					// 复制文件（移除 Stat 检查，直接尝试打开，减少系统调用）
+					n, err = copyFile(sourcePath, destPath, &dirCache, opts)
+				}
+				atomic.AddInt64(&copiedBytes, n)
+				finishEntry(entry, err)
 			}
 		}()
 	}
 
-	// 发送任务
-	for _, relPath := range fileList {
-		taskChan <- relPath
+	// 发送任务（硬链接需要等目标文件复制完成后再创建）
+	var hardlinks []*ManifestEntry
+	for i := range ordered {
+		entry := &ordered[i]
+		if entry.Type == manifestTypeHardlink {
+			hardlinks = append(hardlinks, entry)
+			continue
+		}
+		if opts.chunkThreshold > 0 && entry.Type == manifestTypeFile && entry.Size >= opts.chunkThreshold {
+			sendChunks(entry)
+			continue
+		}
+		taskChan <- copyTask{entry: entry}
 	}
 	close(taskChan)
 
 	// 等待所有协程完成
 	wg.Wait()
 
+	// 在目标目录重建硬链接，失败时（如目标文件复制失败）退回为复制文件内容
+	for _, entry := range hardlinks {
+		if err := createHardlink(destDir, entry, &dirCache); err != nil {
+			sourcePath := filepath.Join(sourceDir, entry.Path)
+			n, copyErr := copyFile(sourcePath, filepath.Join(destDir, entry.Path), &dirCache, opts)
+			atomic.AddInt64(&copiedBytes, n)
+			if copyErr != nil {
+				fmt.Fprintf(os.Stderr, "警告: 创建硬链接失败 %s: %v\n", entry.Path, err)
+				atomic.AddInt64(&failedFiles, 1)
+				atomic.AddInt64(&copiedFiles, 1)
+				continue
+			}
+			if preserve.any() {
+				if err := applyPreservedMetadata(sourcePath, filepath.Join(destDir, entry.Path), false, preserve); err != nil {
+					fmt.Fprintf(os.Stderr, "警告: 保留元数据失败 %s: %v\n", entry.Path, err)
+				}
+			}
+		}
+		journal.record(entry.Path)
+		atomic.AddInt64(&copiedFiles, 1)
+	}
+
+	// 最后恢复目录的元数据（从深到浅），避免复制文件时更新目录的修改时间
+	if preserve.any() {
+		preserveDirectories(sourceDir, destDir, fileList, preserve)
+	}
+
 	// 停止进度更新协程
 	close(progressDone)
 	time.Sleep(120 * time.Millisecond) // 等待最后一次更新完成
 
 	// 显示最终进度
-	updateProgress(atomic.LoadInt64(&copiedFiles), totalFiles, startTime)
+	updateProgress(atomic.LoadInt64(&copiedFiles), totalFiles, atomic.LoadInt64(&copiedBytes), totalBytes, startTime)
 
 	if failedFiles > 0 {
 		return fmt.Errorf("有 %d 个文件复制失败或源文件不存在", failedFiles)
@@ -238,12 +670,25 @@ func copyFilesParallel(sourceDir, destDir string, fileList []string, concurrency
 	return nil
 }
 
+// splitDirEntries 将目录条目从 fileList 中分离出来，返回其余条目和目录条目
+func splitDirEntries(fileList []ManifestEntry) (files, dirs []ManifestEntry) {
+	files = fileList[:0:0]
+	for i := range fileList {
+		if fileList[i].Type == manifestTypeDir {
+			dirs = append(dirs, fileList[i])
+		} else {
+			files = append(files, fileList[i])
+		}
+	}
+	return files, dirs
+}
+
 // precreateDirectories 预创建所有需要的目录（并行优化版本）
-func precreateDirectories(baseDir string, fileList []string, concurrency int) error {
+func precreateDirectories(baseDir string, fileList []ManifestEntry, concurrency int) error {
 	// 收集所有需要的目录
 	dirSet := make(map[string]bool)
-	for _, relPath := range fileList {
-		dir := filepath.Dir(relPath)
+	for i := range fileList {
+		dir := filepath.Dir(fileList[i].Path)
 		if dir != "." && dir != "" {
 			dirSet[dir] = true
 		}
@@ -339,9 +784,9 @@ func precreateDirectories(baseDir string, fileList []string, concurrency int) er
 	return firstErr
 }
 
-// copyFile 复制单个文件（小文件场景优化版本）
-func copyFile(sourcePath, destPath string, dirCache *sync.Map) error {
-	// 使用缓存检查目录是否已创建（小文件场景优化：减少重复的 MkdirAll 调用）
+// ensureDestDir 确保目标文件的父目录存在
+// 使用缓存检查目录是否已创建（小文件场景优化：减少重复的 MkdirAll 调用）
+func ensureDestDir(destPath string, dirCache *sync.Map) error {
 	destDir := filepath.Dir(destPath)
 	if _, exists := dirCache.Load(destDir); !exists {
 		// 双重检查，避免并发时重复创建
@@ -352,41 +797,70 @@ func copyFile(sourcePath, destPath string, dirCache *sync.Map) error {
 			}
 		}
 	}
+	return nil
+}
+
+// copySymlink 在目标位置创建与源符号链接指向相同的符号链接（不复制链接目标的内容）
+func copySymlink(sourcePath, destPath string, dirCache *sync.Map) error {
+	if err := ensureDestDir(destPath, dirCache); err != nil {
+		return err
+	}
+
+	target, err := os.Readlink(sourcePath)
+	if err != nil {
+		return fmt.Errorf("无法读取符号链接: %w", err)
+	}
+
+	// 目标位置已存在文件或链接时先删除（不删除目录）
+	if info, err := os.Lstat(destPath); err == nil && !info.IsDir() {
+		if err := os.Remove(destPath); err != nil {
+			return fmt.Errorf("无法删除已存在的目标文件: %w", err)
+		}
+	}
+
+	if err := os.Symlink(target, destPath); err != nil {
+		return fmt.Errorf("无法创建符号链接: %w", err)
+	}
+	return nil
+}
+
+// copyFile 复制单个文件（小文件场景优化版本），返回复制的字节数
+// opts.atomic 为 true 时先写入临时文件，复制完成后再重命名到目标路径
+func copyFile(sourcePath, destPath string, dirCache *sync.Map, opts copyOptions) (int64, error) {
+	if err := ensureDestDir(destPath, dirCache); err != nil {
+		return 0, err
+	}
 
 	// 打开源文件（移除 Stat 检查，直接打开以减少系统调用）
 	sourceFile, err := os.Open(sourcePath)
 	if err != nil {
-		return fmt.Errorf("无法打开源文件: %w", err)
+		return 0, fmt.Errorf("无法打开源文件: %w", err)
 	}
 	defer sourceFile.Close()
 
 	// 创建目标文件
-	destFile, err := os.Create(destPath)
+	destFile, err := createOutputFile(destPath, 0666, opts.atomic)
 	if err != nil {
-		return fmt.Errorf("无法创建目标文件: %w", err)
+		return 0, fmt.Errorf("无法创建目标文件: %w", err)
 	}
-	defer destFile.Close()
-
-	// 为源文件添加缓冲读取（小文件场景优化：减少系统调用）
-	bufferedReader := bufio.NewReaderSize(sourceFile, 64*1024)
-	// 使用带缓冲的 Writer 提高 I/O 性能（64KB 缓冲区）
-	bufferedWriter := bufio.NewWriterSize(destFile, 64*1024)
-	defer bufferedWriter.Flush()
 
-	// 复制文件内容
-	_, err = io.Copy(bufferedWriter, bufferedReader)
+	// 复制文件内容（依次尝试 reflink、copy_file_range 和用户态缓冲复制）
+	n, err := copyFileContent(destFile.File, sourceFile, opts)
 	if err != nil {
-		return fmt.Errorf("复制文件内容失败: %w", err)
+		destFile.abort()
+		return n, fmt.Errorf("复制文件内容失败: %w", err)
 	}
-
-	// 注意：移除了每个文件的 Sync() 调用
-	// Sync() 会强制等待数据写入磁盘，对于大量文件来说极其缓慢
-	// 系统会在适当的时候自动刷新缓冲区，或者可以使用 --sync 选项在最后统一同步
-	return nil
+	// 默认不对每个文件调用 Sync()：Sync() 会强制等待数据写入磁盘，对于大量文件来说极其缓慢
+	// 需要持久化时使用 --fsync-mode=file 逐个同步，或使用 --sync 在最后统一同步
+	if err := destFile.commit(opts.sync); err != nil {
+		return n, err
+	}
+	return n, nil
 }
 
 // updateProgress 更新进度条
-func updateProgress(current, total int64, startTime time.Time) {
+// totalBytes 为 -1 时表示总数据量未知，只显示文件数进度
+func updateProgress(current, total, currentBytes, totalBytes int64, startTime time.Time) {
 	if total == 0 {
 		return
 	}
@@ -394,11 +868,31 @@ func updateProgress(current, total int64, startTime time.Time) {
 
 	// 计算每秒文件数
 	elapsed := time.Since(startTime)
-	var filesPerSec float64
+	var filesPerSec, bytesPerSec float64
 	if elapsed.Seconds() > 0 {
 		filesPerSec = float64(current) / elapsed.Seconds()
+		bytesPerSec = float64(currentBytes) / elapsed.Seconds()
 	}
 
-	fmt.Fprintf(os.Stdout, "\r进度: %d/%d (%.1f%%) | 速度: %.1f 文件/秒", current, total, percentage, filesPerSec)
+	if totalBytes >= 0 {
+		fmt.Fprintf(os.Stdout, "\r进度: %d/%d (%.1f%%) | 数据: %s/%s | 速度: %.1f 文件/秒, %s/秒",
+			current, total, percentage, formatBytes(currentBytes), formatBytes(totalBytes), filesPerSec, formatBytes(int64(bytesPerSec)))
+	} else {
+		fmt.Fprintf(os.Stdout, "\r进度: %d/%d (%.1f%%) | 速度: %.1f 文件/秒", current, total, percentage, filesPerSec)
+	}
 	os.Stdout.Sync()
 }
+
+// formatBytes 将字节数格式化为便于阅读的字符串
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,189 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// deleteOptions 镜像模式（--delete）的参数
+type deleteOptions struct {
+	enabled    bool // 删除目标目录中 manifest 未列出的文件和空目录
+	dryRun     bool // 只列出将被删除的路径，不复制也不删除
+	maxPercent int  // 将被删除的条目超过目标目录条目总数的百分比时拒绝执行
+}
+
+// addDeleteFlags 为命令添加镜像模式相关参数
+func addDeleteFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("delete", false, "镜像模式，删除目标目录中 manifest 未列出的文件和空目录")
+	cmd.Flags().Bool("delete-dry-run", false, "只列出镜像模式将删除的路径，不复制也不删除")
+	cmd.Flags().Int("delete-threshold", 50, "将被删除的条目超过目标目录条目总数的该百分比时拒绝删除，100 表示不限制")
+}
+
+// deleteFromFlags 根据命令参数生成镜像模式的参数
+func deleteFromFlags(cmd *cobra.Command) (deleteOptions, error) {
+	var opts deleteOptions
+	opts.enabled, _ = cmd.Flags().GetBool("delete")
+	opts.dryRun, _ = cmd.Flags().GetBool("delete-dry-run")
+	opts.maxPercent, _ = cmd.Flags().GetInt("delete-threshold")
+	if opts.maxPercent < 0 || opts.maxPercent > 100 {
+		return opts, fmt.Errorf("无效的 --delete-threshold 参数: %d（取值范围 0-100）", opts.maxPercent)
+	}
+	// 预览删除时无需再指定 --delete
+	if opts.dryRun {
+		opts.enabled = true
+	}
+	return opts, nil
+}
+
+// findExtraneousEntries 扫描目标目录，返回 manifest 中没有的文件和目录以及目标目录的条目总数
+// 目标目录按符号链接本身扫描，被过滤规则或忽略文件排除的路径不会被删除
+func findExtraneousEntries(destDir string, fileList []ManifestEntry, scanOpts ManifestOptions) (files, dirs []string, total int, err error) {
+	scanOpts.Symlinks = symlinksPreserve
+	scanOpts.IncludeDirs = true
+	// 目标目录中无法读取的子目录不会被列出，其中的文件也就不会被删除
+	destList, err := scanDirectory(destDir, scanOpts)
+	if err = warnScanIncomplete(err); err != nil {
+		return nil, nil, 0, err
+	}
+
+	// manifest 中的条目以及它们的所有上级目录都需要保留
+	expectedFiles := make(map[string]bool, len(fileList))
+	expectedDirs := make(map[string]bool)
+	for i := range fileList {
+		entry := &fileList[i]
+		if entry.Type == manifestTypeDir {
+			expectedDirs[entry.Path] = true
+		} else {
+			expectedFiles[entry.Path] = true
+		}
+		for dir := parentRelDir(entry.Path); dir != "" && !expectedDirs[dir]; dir = parentRelDir(dir) {
+			expectedDirs[dir] = true
+		}
+	}
+
+	for i := range destList {
+		entry := &destList[i]
+		if entry.Type == manifestTypeDir {
+			if !expectedDirs[entry.Path] {
+				dirs = append(dirs, entry.Path)
+			}
+		} else if !expectedFiles[entry.Path] {
+			files = append(files, entry.Path)
+		}
+	}
+
+	return files, dirs, len(destList), nil
+}
+
+// checkDeleteThreshold 检查将被删除的条目比例是否超过安全阈值
+func checkDeleteThreshold(count, total, maxPercent int) error {
+	if count == 0 || maxPercent >= 100 {
+		return nil
+	}
+	if count*100 > total*maxPercent {
+		return fmt.Errorf("将删除目标目录中 %d/%d 个条目（%.1f%%），超过安全阈值 %d%%，请检查源目录和目标目录是否正确，或调整 --delete-threshold",
+			count, total, float64(count)*100/float64(total), maxPercent)
+	}
+	return nil
+}
+
+// deleteExtraneous 并行删除多余的文件，然后从深到浅删除多余的目录
+// 目录中还有被排除的文件时保留该目录
+func deleteExtraneous(destDir string, files, dirs []string, concurrency int) error {
+	totalFiles := int64(len(files) + len(dirs))
+	var deletedFiles int64
+	var failedFiles int64
+
+	startTime := time.Now()
+
+	// 启动进度更新协程
+	progressDone := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				updateProgress(atomic.LoadInt64(&deletedFiles), totalFiles, 0, -1, startTime)
+			case <-progressDone:
+				return
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	removeAll := func(paths []string) {
+		taskChan := make(chan string, concurrency*2)
+		var wg sync.WaitGroup
+
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for relPath := range taskChan {
+					fullPath := filepath.Join(destDir, filepath.FromSlash(relPath))
+					if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+						// 目录中还有被排除的文件，不是错误
+						if entries, readErr := os.ReadDir(fullPath); readErr == nil && len(entries) > 0 {
+							atomic.AddInt64(&deletedFiles, 1)
+							continue
+						}
+						mu.Lock()
+						fmt.Fprintf(os.Stderr, "\n警告: 删除失败 %s: %v\n", fullPath, err)
+						mu.Unlock()
+						atomic.AddInt64(&failedFiles, 1)
+					}
+					atomic.AddInt64(&deletedFiles, 1)
+				}
+			}()
+		}
+
+		for _, relPath := range paths {
+			taskChan <- relPath
+		}
+		close(taskChan)
+		wg.Wait()
+	}
+
+	// 先删除文件，再按深度从深到浅逐层删除目录（同一层的目录之间互不影响，可以并行）
+	removeAll(files)
+
+	depth := func(dir string) int {
+		return strings.Count(dir, "/")
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		return depth(dirs[i]) > depth(dirs[j])
+	})
+	for start := 0; start < len(dirs); {
+		end := start + 1
+		for end < len(dirs) && depth(dirs[end]) == depth(dirs[start]) {
+			end++
+		}
+		removeAll(dirs[start:end])
+		start = end
+	}
+
+	// 停止进度更新协程
+	close(progressDone)
+	time.Sleep(120 * time.Millisecond)
+
+	// 显示最终进度
+	updateProgress(atomic.LoadInt64(&deletedFiles), totalFiles, 0, -1, startTime)
+	fmt.Fprintf(os.Stdout, "\n")
+
+	if failedFiles > 0 {
+		return fmt.Errorf("有 %d 个路径删除失败", failedFiles)
+	}
+	return nil
+}
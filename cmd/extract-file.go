@@ -0,0 +1,168 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"archive/tar"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// extractFileCmd 表示从 tar 包中提取单个文件的命令
+var extractFileCmd = &cobra.Command{
+	Use:   "extract-file <tar包> <路径>",
+	Short: "从 tar 包中提取单个文件",
+	Long: `从 tar 包中提取单个文件。
+
+支持的功能：
+- tar --seekable 生成的 tar 包根据末尾的路径索引直接定位到文件，只解压文件所在的帧，
+  耗时与 tar 包大小无关
+- 其他 tar 包（自动识别压缩格式）顺序读取直到找到文件
+- 硬链接条目提取其指向的文件内容
+- 默认输出到标准输出，使用 --output 写入文件（保留权限和修改时间）
+
+示例：
+  p-tool extract-file backup.tar.zst dir/file.txt > file.txt
+  p-tool extract-file backup.tar.zst dir/file.txt --output /tmp/file.txt`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		archivePath := args[0]
+		relPath := normalizeManifestPath(args[1])
+		output, _ := cmd.Flags().GetString("output")
+
+		file, err := os.Open(archivePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 无法打开 tar 包 %s: %v\n", archivePath, err)
+			os.Exit(1)
+		}
+		defer file.Close()
+
+		// 优先使用路径索引定位，不是 seekable 格式时退回顺序读取
+		var locate func(path string) (*tar.Reader, *tar.Header, error)
+		archive, err := openSeekableArchive(file)
+		switch {
+		case err == nil:
+			defer archive.Close()
+			locate = func(path string) (*tar.Reader, *tar.Header, error) {
+				return locateSeekableEntry(archive, path)
+			}
+		case errors.Is(err, errNotSeekable):
+			fmt.Fprintf(os.Stderr, "警告: %s %v（可使用 tar --seekable 生成），需要顺序读取 tar 包\n", archivePath, err)
+			locate = func(path string) (*tar.Reader, *tar.Header, error) {
+				return scanTarEntry(file, archivePath, path)
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "错误: 读取 tar 包索引失败: %v\n", err)
+			os.Exit(1)
+		}
+
+		tarReader, header, err := locate(relPath)
+		// 硬链接条目没有内容，改为提取链接指向的条目
+		if err == nil && header.Typeflag == tar.TypeLink {
+			tarReader, header, err = locate(normalizeManifestPath(header.Linkname))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+			os.Exit(1)
+		}
+		if header.Typeflag != tar.TypeReg {
+			fmt.Fprintf(os.Stderr, "错误: %s 不是普通文件\n", relPath)
+			os.Exit(1)
+		}
+
+		if output == "" {
+			if _, err := io.Copy(os.Stdout, tarReader); err != nil {
+				fmt.Fprintf(os.Stderr, "错误: 提取文件失败: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		if err := writeExtractedFile(output, header, tarReader); err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 提取文件失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stdout, "已提取 %s → %s（%s）\n", relPath, output, formatBytes(header.Size))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(extractFileCmd)
+
+	extractFileCmd.Flags().StringP("output", "o", "", "写入的目标文件路径，默认输出到标准输出")
+}
+
+// locateSeekableEntry 根据路径索引定位条目，返回读取该条目内容的 tar.Reader
+func locateSeekableEntry(archive *seekableArchive, path string) (*tar.Reader, *tar.Header, error) {
+	offset, ok := archive.offsets[path]
+	if !ok {
+		return nil, nil, fmt.Errorf("tar 包中没有 %s", path)
+	}
+	reader, err := archive.readerAt(offset)
+	if err != nil {
+		return nil, nil, err
+	}
+	tarReader := tar.NewReader(reader)
+	header, err := tarReader.Next()
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取 tar header 失败: %w", err)
+	}
+	if normalizeManifestPath(header.Name) != path {
+		return nil, nil, fmt.Errorf("路径索引与 tar 包内容不一致：偏移 %d 处是 %s 而不是 %s", offset, header.Name, path)
+	}
+	return tarReader, header, nil
+}
+
+// scanTarEntry 从头顺序读取 tar 包直到找到 path，压缩格式根据魔数识别
+func scanTarEntry(file *os.File, archivePath, path string) (*tar.Reader, *tar.Header, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	bufferedReader := bufio.NewReaderSize(file, 1024*1024)
+	format, err := sniffCompressFormat(bufferedReader, archivePath, compressAuto)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 只读取到目标条目为止，解压器随进程退出释放
+	reader, err := newDecompressReader(bufferedReader, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil, nil, fmt.Errorf("tar 包中没有 %s", path)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("读取 tar header 失败: %w", err)
+		}
+		if normalizeManifestPath(header.Name) == path {
+			return tarReader, header, nil
+		}
+	}
+}
+
+// writeExtractedFile 将条目内容写入 target，并设置权限和修改时间
+// 先写入临时文件再重命名，提取失败时不会留下不完整的文件，也不会破坏已有的 target
+func writeExtractedFile(target string, header *tar.Header, r io.Reader) error {
+	file, err := createOutputFile(target, os.FileMode(header.Mode), true)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.abort()
+		return err
+	}
+	if err := file.commit(nil); err != nil {
+		return err
+	}
+	applyEntryMetadata(target, header)
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import "os"
+
+// hardlinkID 在不支持 inode 的平台上不识别硬链接
+func hardlinkID(info os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
+
+// inodeID 在不支持 inode 的平台上不可用，locality 顺序退回按路径排序
+func inodeID(info os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
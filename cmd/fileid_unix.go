@@ -0,0 +1,32 @@
+//go:build unix
+
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+	"syscall"
+)
+
+// hardlinkID 返回文件的设备号和 inode，只有链接数大于 1 的普通文件才返回 true
+func hardlinkID(info os.FileInfo) (fileID, bool) {
+	if !info.Mode().IsRegular() {
+		return fileID{}, false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink <= 1 {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
+
+// inodeID 返回文件的设备号和 inode，用于按磁盘位置排序（--order locality）
+func inodeID(info os.FileInfo) (fileID, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
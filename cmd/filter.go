@@ -0,0 +1,300 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// globPattern 是编译后的 glob 规则
+// - 不含 / 的规则匹配任意层级的文件或目录名，例如 *.tmp
+// - 含 / 的规则从扫描根目录开始匹配，例如 node_modules/.cache
+// - ** 匹配零个或多个目录层级，例如 **/build/**；结尾的 /** 只匹配目录下的内容
+// - 以 / 结尾的规则只匹配目录
+// - 字符类支持 [!...] 写法，与 [^...] 等价
+type globPattern struct {
+	segments []string // 按 / 切分的规则
+	anchored bool     // 是否从根目录开始匹配
+	dirOnly  bool     // 是否只匹配目录
+}
+
+// compileGlob 编译 glob 规则
+func compileGlob(pattern string) (globPattern, error) {
+	var g globPattern
+
+	p := pattern
+	if strings.HasSuffix(p, "/") {
+		g.dirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+	if strings.HasPrefix(p, "/") {
+		g.anchored = true
+		p = strings.TrimLeft(p, "/")
+	}
+	p = strings.TrimPrefix(p, "./")
+	if p == "" {
+		return g, fmt.Errorf("无效的匹配规则: %q", pattern)
+	}
+
+	g.segments = strings.Split(p, "/")
+	if len(g.segments) > 1 {
+		g.anchored = true
+	}
+
+	// 提前校验每一段的语法，避免匹配时才发现错误
+	for i, seg := range g.segments {
+		if seg == "**" {
+			continue
+		}
+		seg = strings.ReplaceAll(seg, "[!", "[^")
+		g.segments[i] = seg
+		if _, err := path.Match(seg, ""); err != nil {
+			return g, fmt.Errorf("无效的匹配规则 %q: %w", pattern, err)
+		}
+	}
+
+	return g, nil
+}
+
+// match 判断相对路径（已按 / 切分）是否匹配规则
+func (g *globPattern) match(segments []string, isDir bool) bool {
+	if g.dirOnly && !isDir {
+		return false
+	}
+	if !g.anchored {
+		// 只匹配最后一级名称
+		ok, _ := path.Match(g.segments[0], segments[len(segments)-1])
+		return ok
+	}
+	return matchGlobSegments(g.segments, segments)
+}
+
+// matchGlobSegments 逐级匹配规则和路径，** 可以匹配零个或多个层级
+func matchGlobSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// 合并连续的 **
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			// 结尾的 ** 至少匹配一级，a/** 匹配 a 下的内容而不匹配 a 本身
+			if len(pattern) == 0 {
+				return len(segments) > 0
+			}
+			for i := 0; i <= len(segments); i++ {
+				if matchGlobSegments(pattern, segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		segments = segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// PathFilter 根据 --include / --exclude 规则过滤路径
+// 排除规则命中的目录会连同其子树一起被跳过；
+// 指定了包含规则时，只保留自身或某个上级目录命中包含规则的文件
+type PathFilter struct {
+	includes []globPattern
+	excludes []globPattern
+}
+
+// newPathFilter 根据包含和排除规则创建过滤器，没有任何规则时返回 nil
+func newPathFilter(includes, excludes []string) (*PathFilter, error) {
+	if len(includes) == 0 && len(excludes) == 0 {
+		return nil, nil
+	}
+
+	f := &PathFilter{}
+	for _, p := range includes {
+		g, err := compileGlob(p)
+		if err != nil {
+			return nil, err
+		}
+		f.includes = append(f.includes, g)
+	}
+	for _, p := range excludes {
+		g, err := compileGlob(p)
+		if err != nil {
+			return nil, err
+		}
+		f.excludes = append(f.excludes, g)
+	}
+	return f, nil
+}
+
+// readPatternFile 读取规则文件，每行一条规则，忽略空行和 # 开头的注释
+func readPatternFile(patternPath string) ([]string, error) {
+	file, err := os.Open(patternPath)
+	if err != nil {
+		return nil, fmt.Errorf("无法打开规则文件: %w", err)
+	}
+	defer file.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取规则文件时出错: %w", err)
+	}
+
+	return patterns, nil
+}
+
+// matchAny 判断路径是否命中任意一条规则
+func matchAny(patterns []globPattern, segments []string, isDir bool) bool {
+	for i := range patterns {
+		if patterns[i].match(segments, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludesDir 判断目录是否被排除（扫描时据此跳过整个子树）
+func (f *PathFilter) excludesDir(relPath string) bool {
+	if f == nil || len(f.excludes) == 0 {
+		return false
+	}
+	return matchAny(f.excludes, strings.Split(relPath, "/"), true)
+}
+
+// matchFile 判断文件是否应该保留
+// 会同时检查文件的所有上级目录，因此也适用于直接从 manifest 读取的路径列表
+func (f *PathFilter) matchFile(relPath string) bool {
+	if f == nil {
+		return true
+	}
+
+	segments := strings.Split(relPath, "/")
+
+	// 文件自身或任意上级目录命中排除规则都会被排除
+	if matchAny(f.excludes, segments, false) {
+		return false
+	}
+	for i := 1; i < len(segments); i++ {
+		if matchAny(f.excludes, segments[:i], true) {
+			return false
+		}
+	}
+
+	if len(f.includes) == 0 {
+		return true
+	}
+
+	// 文件自身或任意上级目录命中包含规则即可保留
+	if matchAny(f.includes, segments, false) {
+		return true
+	}
+	for i := 1; i < len(segments); i++ {
+		if matchAny(f.includes, segments[:i], true) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterManifestEntries 对直接从 manifest 读取的条目应用过滤规则、忽略文件和符号链接处理方式，返回保留的条目
+// dirPath: 源目录，用于读取其中的忽略文件
+func filterManifestEntries(dirPath string, fileList []ManifestEntry, opts ManifestOptions) ([]ManifestEntry, error) {
+	fileList = applySymlinkMode(dirPath, fileList, opts.Symlinks)
+
+	ignore, err := newIgnoreCache(dirPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Filter == nil && ignore == nil {
+		return fileList, nil
+	}
+
+	result := make([]ManifestEntry, 0, len(fileList))
+	for i := range fileList {
+		entry := &fileList[i]
+		if !opts.Filter.matchFile(entry.Path) {
+			continue
+		}
+		if ignore.ignoredPath(entry.Path, entry.Type == manifestTypeDir) {
+			continue
+		}
+		result = append(result, *entry)
+	}
+
+	// 硬链接指向的文件可能已被过滤掉
+	repairHardlinks(dirPath, result)
+	return result, nil
+}
+
+// addFilterFlags 为命令添加过滤相关参数：--include / --exclude / --exclude-from 以及忽略文件
+func addFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArray("include", nil, "只包含匹配的文件，支持 ** 通配符，可重复指定")
+	cmd.Flags().StringArray("exclude", nil, "排除匹配的文件或目录，支持 ** 通配符，可重复指定")
+	cmd.Flags().StringArray("exclude-from", nil, "从文件读取排除规则（每行一条），可重复指定")
+	cmd.Flags().StringArray("ignore-file", nil, "按 gitignore 语义读取每个目录中的忽略文件（如 .gitignore、.dockerignore），可重复指定")
+	cmd.Flags().Bool("respect-gitignore", false, "遵循 .gitignore 和 .git/info/exclude，并跳过 .git 目录")
+}
+
+// scanOptionsFromFlags 根据命令参数生成扫描选项（过滤规则和忽略文件）
+func scanOptionsFromFlags(cmd *cobra.Command) (ManifestOptions, error) {
+	var opts ManifestOptions
+
+	filter, err := pathFilterFromFlags(cmd)
+	if err != nil {
+		return opts, err
+	}
+	opts.Filter = filter
+	opts.IgnoreFiles, _ = cmd.Flags().GetStringArray("ignore-file")
+	opts.RespectGitignore, _ = cmd.Flags().GetBool("respect-gitignore")
+
+	// 只在显式指定时记录符号链接处理方式：扫描时为空等同于 follow，
+	// 使用 --manifest-file 时为空表示按 manifest 中记录的类型处理
+	if flag := cmd.Flags().Lookup("symlinks"); flag != nil && flag.Changed {
+		switch mode := flag.Value.String(); mode {
+		case symlinksFollow, symlinksPreserve, symlinksSkip:
+			opts.Symlinks = mode
+		default:
+			return opts, fmt.Errorf("无效的 --symlinks 参数: %s（可选 follow、preserve、skip）", mode)
+		}
+	}
+
+	return opts, nil
+}
+
+// pathFilterFromFlags 根据命令参数创建路径过滤器
+func pathFilterFromFlags(cmd *cobra.Command) (*PathFilter, error) {
+	includes, _ := cmd.Flags().GetStringArray("include")
+	excludes, _ := cmd.Flags().GetStringArray("exclude")
+	excludeFiles, _ := cmd.Flags().GetStringArray("exclude-from")
+
+	for _, excludeFile := range excludeFiles {
+		patterns, err := readPatternFile(excludeFile)
+		if err != nil {
+			return nil, err
+		}
+		excludes = append(excludes, patterns...)
+	}
+
+	return newPathFilter(includes, excludes)
+}
@@ -0,0 +1,197 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// 持久化方式（--fsync-mode）
+const (
+	fsyncNone = "none" // 不主动同步，由操作系统决定何时写回磁盘（默认）
+	fsyncFile = "file" // 每个文件写入完成后 fsync
+	fsyncEnd  = "end"  // 全部写入完成后对目标文件系统执行一次 syncfs
+	fsyncDir  = "dir"  // 在 file 的基础上，最后再 fsync 所有写入过条目的目录，保证新建的目录项也已落盘
+)
+
+// durability 持久化方式以及 fsync 的统计信息，可以在多个协程中并发使用
+// 为 nil 时等同于 none
+type durability struct {
+	mode        string
+	syncedFiles int64 // 已 fsync 的文件数
+	syncNanos   int64 // 文件 fsync 累计耗时
+}
+
+// addFsyncFlags 为命令添加 --fsync-mode 和 --sync 参数
+func addFsyncFlags(cmd *cobra.Command) {
+	cmd.Flags().String("fsync-mode", fsyncNone, "持久化方式：none（不同步）、file（每个文件 fsync）、end（结束时 syncfs）、dir（每个文件和目录都 fsync）")
+	cmd.Flags().Bool("sync", false, "结束时将数据同步到磁盘，等同于 --fsync-mode=end")
+}
+
+// durabilityFromFlags 根据命令参数生成持久化方式
+func durabilityFromFlags(cmd *cobra.Command) (*durability, error) {
+	mode, _ := cmd.Flags().GetString("fsync-mode")
+	syncAtEnd, _ := cmd.Flags().GetBool("sync")
+
+	switch mode {
+	case fsyncNone, fsyncFile, fsyncEnd, fsyncDir:
+	default:
+		return nil, fmt.Errorf("无效的 --fsync-mode 参数: %s（可选 none、file、end、dir）", mode)
+	}
+	if syncAtEnd {
+		if cmd.Flags().Lookup("fsync-mode").Changed && mode != fsyncEnd {
+			return nil, fmt.Errorf("--sync 等同于 --fsync-mode=end，不能与 --fsync-mode=%s 同时使用", mode)
+		}
+		mode = fsyncEnd
+	}
+	return &durability{mode: mode}, nil
+}
+
+// perFile 判断是否需要在每个文件写入完成后 fsync
+func (d *durability) perFile() bool {
+	return d != nil && (d.mode == fsyncFile || d.mode == fsyncDir)
+}
+
+// syncFile 需要时 fsync 刚写入的文件并记录耗时
+func (d *durability) syncFile(f *os.File) error {
+	if !d.perFile() {
+		return nil
+	}
+	start := time.Now()
+	err := f.Sync()
+	atomic.AddInt64(&d.syncNanos, int64(time.Since(start)))
+	atomic.AddInt64(&d.syncedFiles, 1)
+	return err
+}
+
+// syncFileAt 打开已写入完成的文件并 fsync（用于由其他代码负责关闭的文件，如 tar 包）
+func (d *durability) syncFileAt(path string) error {
+	if !d.perFile() {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return d.syncFile(file)
+}
+
+// finish 在全部写入完成后执行剩余的同步阶段，并单独输出每个阶段的统计
+// destDir 为写入的目标目录（用于 syncfs），dirs 为需要 fsync 的目录（只在 dir 模式下使用）
+func (d *durability) finish(destDir string, dirs []string, concurrency int) error {
+	if d == nil || d.mode == fsyncNone {
+		return nil
+	}
+
+	if d.perFile() {
+		fmt.Fprintf(os.Stdout, "\n文件同步: %d 个文件，fsync 累计耗时 %v\n",
+			atomic.LoadInt64(&d.syncedFiles), time.Duration(atomic.LoadInt64(&d.syncNanos)).Round(time.Millisecond))
+	}
+
+	switch d.mode {
+	case fsyncEnd:
+		fmt.Fprintf(os.Stdout, "\n同步文件系统中（syncfs）...\n")
+		start := time.Now()
+		if err := syncFilesystem(destDir); err != nil {
+			return fmt.Errorf("同步文件系统失败: %w", err)
+		}
+		fmt.Fprintf(os.Stdout, "文件系统同步完成，耗时 %v\n", time.Since(start).Round(time.Millisecond))
+
+	case fsyncDir:
+		if !dirSyncSupported {
+			fmt.Fprintf(os.Stdout, "当前系统不支持 fsync 目录，跳过目录同步\n")
+			return nil
+		}
+		fmt.Fprintf(os.Stdout, "同步 %d 个目录中...\n", len(dirs))
+		start := time.Now()
+		if err := syncDirs(dirs, concurrency); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "目录同步完成，耗时 %v\n", time.Since(start).Round(time.Millisecond))
+	}
+
+	return nil
+}
+
+// syncDirs 并行 fsync 目录
+func syncDirs(dirs []string, concurrency int) error {
+	var failed int64
+	taskChan := make(chan string, concurrency*2)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dir := range taskChan {
+				if err := syncPath(dir); err != nil {
+					mu.Lock()
+					fmt.Fprintf(os.Stderr, "警告: 同步目录失败 %s: %v\n", dir, err)
+					mu.Unlock()
+					atomic.AddInt64(&failed, 1)
+				}
+			}
+		}()
+	}
+
+	for _, dir := range dirs {
+		taskChan <- dir
+	}
+	close(taskChan)
+	wg.Wait()
+
+	if failed > 0 {
+		return fmt.Errorf("有 %d 个目录同步失败", failed)
+	}
+	return nil
+}
+
+// syncPath 打开文件或目录并 fsync
+func syncPath(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
+
+// dirsToSync 返回写入 relPaths 后需要 fsync 的目录：条目的所有上级目录直到目标目录，以及目标目录的上级目录
+// 按深度从深到浅排序
+func dirsToSync(destDir string, relPaths []string) []string {
+	dirSet := map[string]bool{".": true}
+	for _, relPath := range relPaths {
+		for dir := filepath.Dir(filepath.FromSlash(relPath)); dir != "." && !dirSet[dir]; dir = filepath.Dir(dir) {
+			dirSet[dir] = true
+		}
+	}
+
+	dirs := make([]string, 0, len(dirSet)+1)
+	for dir := range dirSet {
+		dirs = append(dirs, filepath.Join(destDir, dir))
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		di, dj := strings.Count(dirs[i], string(filepath.Separator)), strings.Count(dirs[j], string(filepath.Separator))
+		if di != dj {
+			return di > dj
+		}
+		return dirs[i] < dirs[j]
+	})
+	// 目标目录本身可能是新建的
+	if parent := filepath.Dir(destDir); parent != destDir {
+		dirs = append(dirs, parent)
+	}
+	return dirs
+}
@@ -0,0 +1,24 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// dirSyncSupported 当前系统是否支持 fsync 目录
+const dirSyncSupported = true
+
+// syncFilesystem 使用 syncfs 将目录所在文件系统的所有脏数据写回磁盘
+// 比逐个 fsync 文件快得多，也不会像 sync 那样等待其他文件系统
+func syncFilesystem(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return unix.Syncfs(int(file.Fd()))
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import "errors"
+
+// dirSyncSupported 当前系统是否支持 fsync 目录
+const dirSyncSupported = false
+
+// syncFilesystem 当前系统不支持同步整个文件系统
+func syncFilesystem(dir string) error {
+	return errors.New("当前系统不支持 syncfs，请使用 --fsync-mode=file")
+}
@@ -0,0 +1,17 @@
+//go:build unix && !linux
+
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import "syscall"
+
+// dirSyncSupported 当前系统是否支持 fsync 目录
+const dirSyncSupported = true
+
+// syncFilesystem 没有 syncfs 的系统上退回为 sync，同步所有文件系统
+func syncFilesystem(dir string) error {
+	syscall.Sync()
+	return nil
+}
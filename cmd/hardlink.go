@@ -0,0 +1,111 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fileID 唯一标识一个文件（设备号 + inode），用于识别硬链接
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// hardlinkCandidate 扫描时发现的链接数大于 1 的文件
+type hardlinkCandidate struct {
+	path string
+	id   fileID
+}
+
+// markHardlinks 将指向同一 inode 的条目标记为硬链接
+// fileList 需要已排序：每组中第一个路径保留为普通文件，其余改为 h 条目，LinkTarget 指向第一个路径
+func markHardlinks(fileList []ManifestEntry, candidates []hardlinkCandidate) {
+	if len(candidates) == 0 {
+		return
+	}
+
+	ids := make(map[string]fileID, len(candidates))
+	for _, c := range candidates {
+		ids[c.path] = c.id
+	}
+
+	first := make(map[fileID]string)
+	for i := range fileList {
+		entry := &fileList[i]
+		id, ok := ids[entry.Path]
+		if !ok {
+			continue
+		}
+		if target, seen := first[id]; seen {
+			entry.Type = manifestTypeHardlink
+			entry.LinkTarget = target
+			entry.Size = 0
+		} else {
+			first[id] = entry.Path
+		}
+	}
+}
+
+// repairHardlinks 修复过滤后目标已不在列表中的硬链接条目
+// 每组中第一个剩下的路径改为普通文件，其余指向它
+func repairHardlinks(dirPath string, fileList []ManifestEntry) {
+	present := make(map[string]bool, len(fileList))
+	hasLinks := false
+	for i := range fileList {
+		switch fileList[i].Type {
+		case manifestTypeFile:
+			present[fileList[i].Path] = true
+		case manifestTypeHardlink:
+			hasLinks = true
+		}
+	}
+	if !hasLinks {
+		return
+	}
+
+	promoted := make(map[string]string) // 原目标 -> 新的主条目
+	for i := range fileList {
+		entry := &fileList[i]
+		if entry.Type != manifestTypeHardlink || present[entry.LinkTarget] {
+			continue
+		}
+		if target, ok := promoted[entry.LinkTarget]; ok {
+			entry.LinkTarget = target
+			continue
+		}
+
+		promoted[entry.LinkTarget] = entry.Path
+		info, err := os.Stat(filepath.Join(dirPath, filepath.FromSlash(entry.Path)))
+		if err != nil {
+			// 无法获取文件信息时仍按普通文件处理，复制时会报告错误
+			entry.Type = manifestTypeFile
+			entry.LinkTarget = ""
+			continue
+		}
+		*entry = newManifestEntry(entry.Path, info)
+	}
+}
+
+// createHardlink 在目标目录中创建硬链接，目标位置已存在文件时先删除
+func createHardlink(destDir string, entry *ManifestEntry, dirCache *sync.Map) error {
+	destPath := filepath.Join(destDir, entry.Path)
+	if err := ensureDestDir(destPath, dirCache); err != nil {
+		return err
+	}
+
+	if info, err := os.Lstat(destPath); err == nil && !info.IsDir() {
+		if err := os.Remove(destPath); err != nil {
+			return fmt.Errorf("无法删除已存在的目标文件: %w", err)
+		}
+	}
+
+	if err := os.Link(filepath.Join(destDir, entry.LinkTarget), destPath); err != nil {
+		return fmt.Errorf("无法创建硬链接: %w", err)
+	}
+	return nil
+}
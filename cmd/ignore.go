@@ -0,0 +1,243 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreRule 是忽略文件中的一条规则
+type ignoreRule struct {
+	pattern globPattern
+	negate  bool   // 以 ! 开头的规则，重新包含之前被忽略的路径
+	base    string // 规则所在目录（相对扫描根目录，根目录为空字符串）
+}
+
+// ignoreMatcher 保存从扫描根目录到当前目录累积的忽略规则（gitignore 语义）
+// 规则按出现顺序排列，越深的目录越靠后，匹配时最后命中的规则生效。
+// matcher 创建后不再修改，子目录有新规则时会复制一份再追加，因此可以在多个协程间共享
+type ignoreMatcher struct {
+	names      []string // 每个目录中需要读取的忽略文件名
+	skipGitDir bool     // 是否跳过 .git 目录
+	rules      []ignoreRule
+}
+
+// newIgnoreMatcher 根据扫描选项创建根目录的忽略规则，没有配置忽略文件时返回 nil
+// 返回的 matcher 还未读取根目录中的忽略文件，需要再调用 enterDir(rootDir, "")
+func newIgnoreMatcher(rootDir string, opts ManifestOptions) (*ignoreMatcher, error) {
+	if len(opts.IgnoreFiles) == 0 && !opts.RespectGitignore {
+		return nil, nil
+	}
+
+	m := &ignoreMatcher{}
+	var fixedFiles []string
+
+	// 优先级最低的规则最先加入：.git/info/exclude，然后是直接指定路径的忽略文件
+	if opts.RespectGitignore {
+		m.skipGitDir = true
+		m.names = append(m.names, ".gitignore")
+		fixedFiles = append(fixedFiles, filepath.Join(rootDir, ".git", "info", "exclude"))
+	}
+
+	for _, name := range opts.IgnoreFiles {
+		// 不含路径分隔符的视为文件名，在每个目录中查找；否则视为作用于根目录的单个文件
+		if filepath.Base(name) == name {
+			if !containsString(m.names, name) {
+				m.names = append(m.names, name)
+			}
+			continue
+		}
+		if _, err := os.Stat(name); err != nil {
+			return nil, fmt.Errorf("无法访问忽略文件 %s: %w", name, err)
+		}
+		fixedFiles = append(fixedFiles, name)
+	}
+
+	for _, file := range fixedFiles {
+		rules, err := parseIgnoreFile(file, "")
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		m.rules = append(m.rules, rules...)
+	}
+
+	return m, nil
+}
+
+// enterDir 读取目录中的忽略文件，返回适用于该目录下路径的 matcher
+// absDir: 目录的真实路径；relDir: 目录相对扫描根目录的路径（根目录为空字符串）
+func (m *ignoreMatcher) enterDir(absDir, relDir string) *ignoreMatcher {
+	if m == nil {
+		return nil
+	}
+
+	var added []ignoreRule
+	for _, name := range m.names {
+		rules, err := parseIgnoreFile(filepath.Join(absDir, name), relDir)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "警告: 读取忽略文件失败 %s: %v\n", filepath.Join(absDir, name), err)
+			}
+			continue
+		}
+		added = append(added, rules...)
+	}
+	if len(added) == 0 {
+		return m
+	}
+
+	child := &ignoreMatcher{
+		names:      m.names,
+		skipGitDir: m.skipGitDir,
+		rules:      make([]ignoreRule, 0, len(m.rules)+len(added)),
+	}
+	child.rules = append(child.rules, m.rules...)
+	child.rules = append(child.rules, added...)
+	return child
+}
+
+// ignored 判断路径是否被忽略，relPath 为相对扫描根目录的路径
+// 调用方需要保证上级目录没有被忽略（与 git 一样，被忽略的目录不会再进入）
+func (m *ignoreMatcher) ignored(relPath string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+	if m.skipGitDir && isDir && path.Base(relPath) == ".git" {
+		return true
+	}
+
+	// 从后往前找第一条命中的规则，即最后出现的规则生效
+	for i := len(m.rules) - 1; i >= 0; i-- {
+		rule := &m.rules[i]
+		sub := relPath
+		if rule.base != "" {
+			if !strings.HasPrefix(relPath, rule.base+"/") {
+				continue
+			}
+			sub = relPath[len(rule.base)+1:]
+		}
+		if rule.pattern.match(strings.Split(sub, "/"), isDir) {
+			return !rule.negate
+		}
+	}
+	return false
+}
+
+// parseIgnoreFile 解析 gitignore 格式的忽略文件
+// - 空行和 # 开头的行被忽略，\# 和 \! 表示字面量
+// - ! 开头的规则表示重新包含
+// - 行尾未转义的空格会被去掉
+// - 无效的规则会被跳过
+func parseIgnoreFile(ignorePath, base string) ([]ignoreRule, error) {
+	file, err := os.Open(ignorePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		// 去掉行尾未转义的空格
+		for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+			line = line[:len(line)-1]
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+			line = line[1:]
+		}
+
+		pattern, err := compileGlob(line)
+		if err != nil {
+			continue
+		}
+		rule.pattern = pattern
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取忽略文件 %s 时出错: %w", ignorePath, err)
+	}
+
+	return rules, nil
+}
+
+// ignoreCache 按目录缓存忽略规则，用于过滤直接从 manifest 读取的路径
+type ignoreCache struct {
+	rootDir string
+	dirs    map[string]*ignoreMatcher
+}
+
+// newIgnoreCache 创建忽略规则缓存，没有配置忽略文件时返回 nil
+func newIgnoreCache(rootDir string, opts ManifestOptions) (*ignoreCache, error) {
+	root, err := newIgnoreMatcher(rootDir, opts)
+	if err != nil || root == nil {
+		return nil, err
+	}
+	return &ignoreCache{
+		rootDir: rootDir,
+		dirs:    map[string]*ignoreMatcher{"": root.enterDir(rootDir, "")},
+	}, nil
+}
+
+// matcherFor 返回适用于目录 relDir 下路径的 matcher
+func (c *ignoreCache) matcherFor(relDir string) *ignoreMatcher {
+	if m, ok := c.dirs[relDir]; ok {
+		return m
+	}
+	m := c.matcherFor(parentRelDir(relDir)).enterDir(filepath.Join(c.rootDir, filepath.FromSlash(relDir)), relDir)
+	c.dirs[relDir] = m
+	return m
+}
+
+// ignoredPath 判断路径是否被忽略，任意上级目录被忽略时其下的路径也被忽略
+func (c *ignoreCache) ignoredPath(relPath string, isDir bool) bool {
+	if c == nil {
+		return false
+	}
+
+	segments := strings.Split(relPath, "/")
+	for i := 1; i < len(segments); i++ {
+		dir := strings.Join(segments[:i], "/")
+		if c.matcherFor(parentRelDir(dir)).ignored(dir, true) {
+			return true
+		}
+	}
+	return c.matcherFor(parentRelDir(relPath)).ignored(relPath, isDir)
+}
+
+// parentRelDir 返回相对路径的上级目录，根目录为空字符串
+func parentRelDir(relPath string) string {
+	dir := path.Dir(relPath)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// containsString 判断字符串切片中是否包含指定字符串
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
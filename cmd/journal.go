@@ -0,0 +1,271 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// journal 文件格式：
+//
+//	#p-tool-journal v1	<源目录绝对路径>	<目标目录绝对路径>
+//	<已完成的条目路径>
+//	...
+//	#batch
+//
+// 已完成的条目按批次追加写入，每批以 #batch 结尾并 fsync。
+// 进程被中断时最后一批可能只写入了一部分，没有 #batch 结尾的条目会被丢弃并重新复制。
+const (
+	journalHeader      = "#p-tool-journal v1"
+	journalBatchMarker = "#batch"
+
+	journalBatchSize     = 1000        // 每批最多记录的条目数
+	journalFlushInterval = time.Second // 距上次写入超过该时间时提前写入一批
+)
+
+// copyJournal 记录 cp 已完成的条目，用于中断后继续复制（--resume）
+// 方法可以在多个协程中并发调用；为 nil 时所有方法都不做任何事
+type copyJournal struct {
+	mu        sync.Mutex
+	path      string
+	file      *os.File
+	pending   []string
+	lastFlush time.Time
+	err       error // 第一次写入失败的错误，之后不再写入
+}
+
+// defaultJournalPath 返回默认的 journal 路径：目标目录旁边的隐藏文件
+func defaultJournalPath(destDir string) string {
+	return filepath.Join(filepath.Dir(destDir), "."+filepath.Base(destDir)+".ptool-journal")
+}
+
+// openJournal 打开 journal 文件
+// resume 为 true 时在原有内容后追加，否则创建新的 journal 并写入文件头
+func openJournal(journalPath, sourceDir, destDir string, resume bool) (*copyJournal, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if resume {
+		flags = os.O_RDWR | os.O_CREATE
+	}
+	file, err := os.OpenFile(journalPath, flags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("无法打开 journal 文件: %w", err)
+	}
+
+	// 中断时最后一批可能只写入了一部分（甚至半行）：截断到最后一个 #batch 之后再追加，
+	// 否则残留的半行会与下一批的第一条记录拼成一行
+	var size int64
+	if resume {
+		size, err = journalCommittedSize(file)
+		if err == nil {
+			err = file.Truncate(size)
+		}
+		if err == nil {
+			_, err = file.Seek(size, io.SeekStart)
+		}
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("无法打开 journal 文件: %w", err)
+		}
+	}
+	if size == 0 {
+		header := fmt.Sprintf("%s\t%s\t%s\n", journalHeader, manifestPathEscaper.Replace(sourceDir), manifestPathEscaper.Replace(destDir))
+		if _, err := file.WriteString(header); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("写入 journal 文件失败: %w", err)
+		}
+	}
+
+	return &copyJournal{path: journalPath, file: file, lastFlush: time.Now()}, nil
+}
+
+// journalCommittedSize 返回 journal 中已提交部分的长度：文件头以及最后一个完整的 #batch 行之后的位置
+// 文件头不完整时返回 0
+func journalCommittedSize(file *os.File) (int64, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	reader := bufio.NewReaderSize(file, 256*1024)
+	var offset, committed int64
+	first := true
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return committed, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		offset += int64(len(line))
+		if first || line == journalBatchMarker+"\n" {
+			committed = offset
+		}
+		first = false
+	}
+}
+
+// record 记录一个已完成的条目，攒够一批或距上次写入超过一定时间时写入文件
+func (j *copyJournal) record(relPath string) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.pending = append(j.pending, relPath)
+	if len(j.pending) >= journalBatchSize || time.Since(j.lastFlush) >= journalFlushInterval {
+		j.flushLocked()
+	}
+}
+
+// flushLocked 将待写入的条目作为一批写入文件并 fsync，调用方需要持有锁
+func (j *copyJournal) flushLocked() {
+	if len(j.pending) == 0 || j.err != nil {
+		return
+	}
+
+	var sb strings.Builder
+	for _, relPath := range j.pending {
+		sb.WriteString(manifestPathEscaper.Replace(relPath))
+		sb.WriteByte('\n')
+	}
+	sb.WriteString(journalBatchMarker)
+	sb.WriteByte('\n')
+
+	if _, err := j.file.WriteString(sb.String()); err != nil {
+		j.err = err
+	} else if err := j.file.Sync(); err != nil {
+		j.err = err
+	}
+	if j.err != nil {
+		fmt.Fprintf(os.Stderr, "\n警告: 写入 journal 文件失败，之后的进度将不会被记录: %v\n", j.err)
+	}
+
+	j.pending = j.pending[:0]
+	j.lastFlush = time.Now()
+}
+
+// close 写入剩余的条目并关闭文件
+func (j *copyJournal) close() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.flushLocked()
+	if err := j.file.Close(); err != nil && j.err == nil {
+		j.err = err
+	}
+	return j.err
+}
+
+// remove 关闭并删除 journal 文件（全部复制成功后调用）
+func (j *copyJournal) remove() {
+	if j == nil {
+		return
+	}
+	j.close()
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "警告: 删除 journal 文件失败 %s: %v\n", j.path, err)
+	}
+}
+
+// journalState 从 journal 中读取的复制进度
+type journalState struct {
+	done      map[string]bool // 已完成的条目
+	lastBatch []string        // 最后一批完成的条目，中断时数据可能还未落盘，需要重新校验
+}
+
+// readJournal 读取 journal 文件，源目录或目标目录与记录的不一致时返回错误
+func readJournal(journalPath, sourceDir, destDir string) (*journalState, error) {
+	file, err := os.Open(journalPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	state := &journalState{done: make(map[string]bool)}
+	var batch []string
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	first := true
+	for scanner.Scan() {
+		line := scanner.Text()
+		if first {
+			first = false
+			fields := strings.Split(line, "\t")
+			if len(fields) != 3 || fields[0] != journalHeader {
+				return nil, fmt.Errorf("%s 不是有效的 journal 文件", journalPath)
+			}
+			if manifestPathUnescaper.Replace(fields[1]) != sourceDir || manifestPathUnescaper.Replace(fields[2]) != destDir {
+				return nil, fmt.Errorf("journal 文件 %s 记录的是 %s -> %s 的复制进度，与当前的源目录和目标目录不一致",
+					journalPath, manifestPathUnescaper.Replace(fields[1]), manifestPathUnescaper.Replace(fields[2]))
+			}
+			continue
+		}
+
+		if line == journalBatchMarker {
+			for _, relPath := range batch {
+				state.done[relPath] = true
+			}
+			state.lastBatch = batch
+			batch = nil
+			continue
+		}
+		batch = append(batch, manifestPathUnescaper.Replace(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取 journal 文件时出错: %w", err)
+	}
+	if first {
+		return nil, fmt.Errorf("%s 不是有效的 journal 文件", journalPath)
+	}
+
+	return state, nil
+}
+
+// skipCompletedEntries 去掉 journal 中已完成的条目，返回剩余需要复制的条目
+// 最后一批完成的条目会重新检查目标文件，不完整的重新复制
+func skipCompletedEntries(destDir string, fileList []ManifestEntry, state *journalState) (remaining []ManifestEntry, recheck int) {
+	lastBatch := make(map[string]bool, len(state.lastBatch))
+	for _, relPath := range state.lastBatch {
+		lastBatch[relPath] = true
+	}
+
+	remaining = make([]ManifestEntry, 0, len(fileList))
+	for i := range fileList {
+		entry := &fileList[i]
+		if !state.done[entry.Path] {
+			remaining = append(remaining, *entry)
+			continue
+		}
+		if lastBatch[entry.Path] && !journalEntryComplete(destDir, entry) {
+			recheck++
+			remaining = append(remaining, *entry)
+		}
+	}
+	return remaining, recheck
+}
+
+// journalEntryComplete 检查目标目录中的条目是否完整：普通文件比较大小，其他类型与增量复制的规则相同
+func journalEntryComplete(destDir string, entry *ManifestEntry) bool {
+	if entry.Type != manifestTypeFile {
+		same, _ := entryUpToDate("", destDir, entry, "", "")
+		return same
+	}
+
+	info, err := os.Lstat(filepath.Join(destDir, entry.Path))
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	return !entry.hasMetadata() || info.Size() == entry.Size
+}
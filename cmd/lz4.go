@@ -0,0 +1,520 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"sync"
+)
+
+// lz4 帧格式（https://github.com/lz4/lz4/blob/dev/doc/lz4_Frame_format.md），与 lz4 命令兼容
+const (
+	lz4FrameMagic     = 0x184D2204
+	lz4LegacyMagic    = 0x184C2102
+	lz4SkippableMagic = 0x184D2A50 // 0x184D2A50 - 0x184D2A5F，可跳过的帧
+	lz4BlockMaxSize   = 4 << 20    // 写入时每个块的最大输入（BD = 7）
+	lz4MinMatch       = 4
+	lz4MaxOffset      = 65535
+	lz4MFLimit        = 12 // 最后一个匹配必须在块结束前至少 12 字节开始
+	lz4LastLiterals   = 5  // 块的最后 5 个字节必须是字面量
+	lz4HashLog        = 16
+
+	lz4FlagVersion       = 0x40
+	lz4FlagBlockIndep    = 0x20
+	lz4FlagBlockChecksum = 0x10
+	lz4FlagContentSize   = 0x08
+	lz4FlagContentCheck  = 0x04
+	lz4FlagDictID        = 0x01
+)
+
+var errLZ4Corrupt = errors.New("lz4 数据损坏")
+
+// lz4HashTable 压缩时的哈希表，记录每个 4 字节序列最近一次出现的位置 + 1（0 表示没有）
+type lz4HashTable [1 << lz4HashLog]uint32
+
+var lz4TablePool = sync.Pool{
+	New: func() interface{} { return new(lz4HashTable) },
+}
+
+func lz4Hash(v uint32) uint32 {
+	return (v * 2654435761) >> (32 - lz4HashLog)
+}
+
+// lz4CompressBlock 将 src 压缩为一个 lz4 块追加到 dst（贪心匹配，与 lz4 默认级别相当）
+func lz4CompressBlock(dst, src []byte, table *lz4HashTable) []byte {
+	clear(table[:])
+	anchor := 0
+	if len(src) > lz4MFLimit {
+		limit := len(src) - lz4MFLimit
+		maxEnd := len(src) - lz4LastLiterals
+		for i := 0; i < limit; {
+			seq := binary.LittleEndian.Uint32(src[i:])
+			h := lz4Hash(seq)
+			ref := int(table[h]) - 1
+			table[h] = uint32(i + 1)
+			if ref < 0 || i-ref > lz4MaxOffset || binary.LittleEndian.Uint32(src[ref:]) != seq {
+				// 连续找不到匹配时加大步长，快速跳过不可压缩的数据
+				i += 1 + (i-anchor)>>6
+				continue
+			}
+			// 向前扩展匹配
+			for i > anchor && ref > 0 && src[i-1] == src[ref-1] {
+				i--
+				ref--
+			}
+			// 向后扩展匹配
+			end := i + lz4MinMatch
+			for end < maxEnd && src[end] == src[ref+end-i] {
+				end++
+			}
+			dst = lz4AppendSequence(dst, src[anchor:i], i-ref, end-i)
+			i, anchor = end, end
+			if i-2 < limit {
+				table[lz4Hash(binary.LittleEndian.Uint32(src[i-2:]))] = uint32(i - 1)
+			}
+		}
+	}
+	return lz4AppendLiterals(dst, src[anchor:], 0)
+}
+
+// lz4AppendSequence 追加一个序列：字面量、匹配偏移和匹配长度
+func lz4AppendSequence(dst, literals []byte, offset, matchLen int) []byte {
+	ml := matchLen - lz4MinMatch
+	token := byte(15)
+	if ml < 15 {
+		token = byte(ml)
+	}
+	dst = lz4AppendLiterals(dst, literals, token)
+	dst = append(dst, byte(offset), byte(offset>>8))
+	if ml >= 15 {
+		dst = lz4AppendLength(dst, ml-15)
+	}
+	return dst
+}
+
+// lz4AppendLiterals 追加 token（高 4 位为字面量长度，低 4 位为 matchToken）和字面量
+func lz4AppendLiterals(dst, literals []byte, matchToken byte) []byte {
+	if len(literals) < 15 {
+		dst = append(dst, byte(len(literals))<<4|matchToken)
+	} else {
+		dst = append(dst, 15<<4|matchToken)
+		dst = lz4AppendLength(dst, len(literals)-15)
+	}
+	return append(dst, literals...)
+}
+
+// lz4AppendLength 追加长度的扩展字节：若干个 255 加上余数
+func lz4AppendLength(dst []byte, n int) []byte {
+	for ; n >= 255; n -= 255 {
+		dst = append(dst, 255)
+	}
+	return append(dst, byte(n))
+}
+
+// lz4DecompressBlock 解压一个 lz4 块并追加到 dst；dst 中已有的数据可作为匹配的历史数据（块之间有依赖时）
+// 解压出的数据超过 maxSize 时返回错误
+func lz4DecompressBlock(dst, src []byte, maxSize int) ([]byte, error) {
+	limit := len(dst) + maxSize
+	for i := 0; ; {
+		if i >= len(src) {
+			return nil, errLZ4Corrupt
+		}
+		token := src[i]
+		i++
+
+		litLen := int(token >> 4)
+		if litLen == 15 {
+			n, next, err := lz4ReadLength(src, i)
+			if err != nil {
+				return nil, err
+			}
+			litLen += n
+			i = next
+		}
+		if litLen > len(src)-i || litLen > limit-len(dst) {
+			return nil, errLZ4Corrupt
+		}
+		dst = append(dst, src[i:i+litLen]...)
+		i += litLen
+		if i == len(src) {
+			return dst, nil
+		}
+
+		if i+2 > len(src) {
+			return nil, errLZ4Corrupt
+		}
+		offset := int(src[i]) | int(src[i+1])<<8
+		i += 2
+		matchLen := int(token & 15)
+		if matchLen == 15 {
+			n, next, err := lz4ReadLength(src, i)
+			if err != nil {
+				return nil, err
+			}
+			matchLen += n
+			i = next
+		}
+		matchLen += lz4MinMatch
+		if offset == 0 || offset > len(dst) || matchLen > limit-len(dst) {
+			return nil, errLZ4Corrupt
+		}
+		start := len(dst) - offset
+		if offset >= matchLen {
+			dst = append(dst, dst[start:start+matchLen]...)
+		} else {
+			// 匹配与输出重叠（重复的短模式），逐段复制
+			for matchLen > 0 {
+				n := matchLen
+				if n > offset {
+					n = offset
+				}
+				dst = append(dst, dst[start:start+n]...)
+				start += n
+				matchLen -= n
+			}
+		}
+	}
+}
+
+// lz4ReadLength 读取长度的扩展字节
+func lz4ReadLength(src []byte, i int) (int, int, error) {
+	n := 0
+	for {
+		if i >= len(src) {
+			return 0, 0, errLZ4Corrupt
+		}
+		b := src[i]
+		i++
+		n += int(b)
+		if b != 255 {
+			return n, i, nil
+		}
+	}
+}
+
+// lz4Writer 写入 lz4 帧：输入按 4MB 切分为互相独立的块，由多个协程并行压缩后按顺序写入
+type lz4Writer struct {
+	w       io.Writer
+	blocks  *parallelWriter
+	content xxh32 // 整个帧内容的校验和
+}
+
+// newLZ4Writer 创建写入 w 的 lz4 压缩器，threads 为压缩协程数
+func newLZ4Writer(w io.Writer, threads int) (*lz4Writer, error) {
+	descriptor := []byte{lz4FlagVersion | lz4FlagBlockIndep | lz4FlagBlockChecksum | lz4FlagContentCheck, 7 << 4}
+	header := binary.LittleEndian.AppendUint32(nil, lz4FrameMagic)
+	header = append(header, descriptor...)
+	header = append(header, byte(xxh32Sum(descriptor)>>8))
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	lw := &lz4Writer{w: w}
+	lw.content.reset()
+	lw.blocks = newParallelWriter(w, lz4BlockMaxSize, threads, func(dst, src []byte) ([]byte, error) {
+		table := lz4TablePool.Get().(*lz4HashTable)
+		defer lz4TablePool.Put(table)
+
+		// 块格式：4 字节大小（最高位表示未压缩），数据，4 字节块校验和
+		dst = append(dst, 0, 0, 0, 0)
+		dst = lz4CompressBlock(dst, src, table)
+		size := uint32(len(dst) - 4)
+		if int(size) >= len(src) {
+			// 压缩后没有变小，按原样存储
+			dst = append(dst[:4], src...)
+			size = uint32(len(src)) | 1<<31
+		}
+		binary.LittleEndian.PutUint32(dst, size)
+		return binary.LittleEndian.AppendUint32(dst, xxh32Sum(dst[4:])), nil
+	})
+	return lw, nil
+}
+
+func (lw *lz4Writer) Write(p []byte) (int, error) {
+	n, err := lw.blocks.Write(p)
+	lw.content.Write(p[:n])
+	return n, err
+}
+
+// Close 写入剩余的块、结束标记和内容校验和
+func (lw *lz4Writer) Close() error {
+	if err := lw.blocks.Close(); err != nil {
+		return err
+	}
+	trailer := binary.LittleEndian.AppendUint32(nil, 0)
+	trailer = binary.LittleEndian.AppendUint32(trailer, lw.content.Sum32())
+	_, err := lw.w.Write(trailer)
+	return err
+}
+
+// lz4Reader 读取 lz4 帧（支持多个帧拼接、块之间有依赖的帧以及可跳过的帧）
+type lz4Reader struct {
+	r *bufio.Reader
+
+	flags        byte
+	blockMaxSize int
+	content      xxh32
+
+	compressed []byte
+	buf        []byte // 解压缓冲区，块之间有依赖时开头保留上一个块的最后 64KB
+	pending    []byte // 尚未被读取的解压数据
+	eof        bool
+}
+
+// newLZ4Reader 创建 lz4 解压器，读取并校验第一个帧头
+func newLZ4Reader(r io.Reader) (*lz4Reader, error) {
+	lr := &lz4Reader{r: bufio.NewReaderSize(r, 256*1024)}
+	ok, err := lr.readFrameHeader()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("不是 lz4 格式的数据")
+	}
+	return lr, nil
+}
+
+// readFrameHeader 读取下一个帧头，跳过可跳过的帧；没有更多帧时返回 false
+func (lr *lz4Reader) readFrameHeader() (bool, error) {
+	var word [4]byte
+	for {
+		if _, err := io.ReadFull(lr.r, word[:]); err != nil {
+			if err == io.EOF {
+				return false, nil
+			}
+			return false, errLZ4Corrupt
+		}
+		magic := binary.LittleEndian.Uint32(word[:])
+		switch {
+		case magic == lz4FrameMagic:
+		case magic&0xFFFFFFF0 == lz4SkippableMagic:
+			if _, err := io.ReadFull(lr.r, word[:]); err != nil {
+				return false, errLZ4Corrupt
+			}
+			if _, err := lr.r.Discard(int(binary.LittleEndian.Uint32(word[:]))); err != nil {
+				return false, errLZ4Corrupt
+			}
+			continue
+		case magic == lz4LegacyMagic:
+			return false, fmt.Errorf("不支持旧版 lz4 格式（lz4 -l）")
+		default:
+			return false, fmt.Errorf("lz4 帧头无效: %#x", magic)
+		}
+		break
+	}
+
+	descriptor := make([]byte, 2, 15)
+	if _, err := io.ReadFull(lr.r, descriptor); err != nil {
+		return false, errLZ4Corrupt
+	}
+	flags, bd := descriptor[0], descriptor[1]
+	if flags&0xC0 != lz4FlagVersion {
+		return false, fmt.Errorf("不支持的 lz4 帧版本")
+	}
+	if flags&lz4FlagDictID != 0 {
+		return false, fmt.Errorf("不支持使用字典的 lz4 帧")
+	}
+	sizeID := bd >> 4 & 7
+	if sizeID < 4 {
+		return false, errLZ4Corrupt
+	}
+	extra := 0
+	if flags&lz4FlagContentSize != 0 {
+		extra = 8
+	}
+	descriptor = descriptor[:2+extra+1]
+	if _, err := io.ReadFull(lr.r, descriptor[2:]); err != nil {
+		return false, errLZ4Corrupt
+	}
+	if byte(xxh32Sum(descriptor[:2+extra])>>8) != descriptor[2+extra] {
+		return false, fmt.Errorf("lz4 帧头校验和不匹配")
+	}
+
+	lr.flags = flags
+	lr.blockMaxSize = 1 << (8 + 2*sizeID)
+	lr.content.reset()
+	lr.buf = lr.buf[:0]
+	return true, nil
+}
+
+func (lr *lz4Reader) Read(p []byte) (int, error) {
+	for len(lr.pending) == 0 {
+		if lr.eof {
+			return 0, io.EOF
+		}
+		if err := lr.readBlock(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, lr.pending)
+	lr.pending = lr.pending[n:]
+	return n, nil
+}
+
+// readBlock 读取并解压下一个块；遇到帧结束时校验内容并继续读取下一个帧
+func (lr *lz4Reader) readBlock() error {
+	var word [4]byte
+	if _, err := io.ReadFull(lr.r, word[:]); err != nil {
+		return errLZ4Corrupt
+	}
+	size := binary.LittleEndian.Uint32(word[:])
+
+	if size == 0 {
+		// 帧结束
+		if lr.flags&lz4FlagContentCheck != 0 {
+			if _, err := io.ReadFull(lr.r, word[:]); err != nil {
+				return errLZ4Corrupt
+			}
+			if binary.LittleEndian.Uint32(word[:]) != lr.content.Sum32() {
+				return fmt.Errorf("lz4 内容校验和不匹配")
+			}
+		}
+		ok, err := lr.readFrameHeader()
+		if err != nil {
+			return err
+		}
+		lr.eof = !ok
+		return nil
+	}
+
+	stored := size&(1<<31) != 0
+	size &^= 1 << 31
+	if int(size) > lr.blockMaxSize {
+		return errLZ4Corrupt
+	}
+	if cap(lr.compressed) < int(size) {
+		lr.compressed = make([]byte, size)
+	}
+	data := lr.compressed[:size]
+	if _, err := io.ReadFull(lr.r, data); err != nil {
+		return errLZ4Corrupt
+	}
+	if lr.flags&lz4FlagBlockChecksum != 0 {
+		if _, err := io.ReadFull(lr.r, word[:]); err != nil {
+			return errLZ4Corrupt
+		}
+		if binary.LittleEndian.Uint32(word[:]) != xxh32Sum(data) {
+			return fmt.Errorf("lz4 块校验和不匹配")
+		}
+	}
+
+	// 块之间有依赖时保留最后 64KB 作为下一个块的历史数据
+	keep := 0
+	if lr.flags&lz4FlagBlockIndep == 0 {
+		keep = len(lr.buf)
+		if keep > lz4MaxOffset {
+			keep = lz4MaxOffset
+		}
+		copy(lr.buf, lr.buf[len(lr.buf)-keep:])
+	}
+	lr.buf = lr.buf[:keep]
+	if stored {
+		lr.buf = append(lr.buf, data...)
+	} else {
+		out, err := lz4DecompressBlock(lr.buf, data, lr.blockMaxSize)
+		if err != nil {
+			return err
+		}
+		lr.buf = out
+	}
+	lr.pending = lr.buf[keep:]
+	if lr.flags&lz4FlagContentCheck != 0 {
+		lr.content.Write(lr.pending)
+	}
+	return nil
+}
+
+// xxh32 流式计算 xxHash32（种子为 0），lz4 帧格式的校验和算法
+type xxh32 struct {
+	v     [4]uint32
+	total uint64
+	mem   [16]byte
+	n     int
+}
+
+const (
+	xxhPrime1 uint32 = 2654435761
+	xxhPrime2 uint32 = 2246822519
+	xxhPrime3 uint32 = 3266489917
+	xxhPrime4 uint32 = 668265263
+	xxhPrime5 uint32 = 374761393
+)
+
+func (x *xxh32) reset() {
+	// 常量运算会溢出 uint32，用变量按模 2^32 计算
+	p1, p2 := xxhPrime1, xxhPrime2
+	*x = xxh32{}
+	x.v = [4]uint32{p1 + p2, p2, 0, -p1}
+}
+
+func xxh32Round(acc, input uint32) uint32 {
+	return bits.RotateLeft32(acc+input*xxhPrime2, 13) * xxhPrime1
+}
+
+func (x *xxh32) Write(p []byte) {
+	x.total += uint64(len(p))
+	if x.n > 0 {
+		n := copy(x.mem[x.n:], p)
+		x.n += n
+		p = p[n:]
+		if x.n < 16 {
+			return
+		}
+		x.stripe(x.mem[:])
+		x.n = 0
+	}
+	for len(p) >= 16 {
+		x.stripe(p)
+		p = p[16:]
+	}
+	x.n = copy(x.mem[:], p)
+}
+
+func (x *xxh32) stripe(p []byte) {
+	x.v[0] = xxh32Round(x.v[0], binary.LittleEndian.Uint32(p[0:]))
+	x.v[1] = xxh32Round(x.v[1], binary.LittleEndian.Uint32(p[4:]))
+	x.v[2] = xxh32Round(x.v[2], binary.LittleEndian.Uint32(p[8:]))
+	x.v[3] = xxh32Round(x.v[3], binary.LittleEndian.Uint32(p[12:]))
+}
+
+func (x *xxh32) Sum32() uint32 {
+	var h uint32
+	if x.total >= 16 {
+		h = bits.RotateLeft32(x.v[0], 1) + bits.RotateLeft32(x.v[1], 7) +
+			bits.RotateLeft32(x.v[2], 12) + bits.RotateLeft32(x.v[3], 18)
+	} else {
+		h = xxhPrime5
+	}
+	h += uint32(x.total)
+
+	p := x.mem[:x.n]
+	for ; len(p) >= 4; p = p[4:] {
+		h += binary.LittleEndian.Uint32(p) * xxhPrime3
+		h = bits.RotateLeft32(h, 17) * xxhPrime4
+	}
+	for _, b := range p {
+		h += uint32(b) * xxhPrime5
+		h = bits.RotateLeft32(h, 11) * xxhPrime1
+	}
+
+	h ^= h >> 15
+	h *= xxhPrime2
+	h ^= h >> 13
+	h *= xxhPrime3
+	h ^= h >> 16
+	return h
+}
+
+// xxh32Sum 计算 p 的 xxHash32
+func xxh32Sum(p []byte) uint32 {
+	var x xxh32
+	x.reset()
+	x.Write(p)
+	return x.Sum32()
+}
@@ -0,0 +1,179 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// lz4Compress 用 lz4Writer 压缩 data，返回完整的 lz4 帧
+func lz4Compress(t testing.TB, data []byte, threads int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := newLZ4Writer(&buf, threads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// lz4Decompress 用 lz4Reader 解压 data
+func lz4Decompress(data []byte) ([]byte, error) {
+	r, err := newLZ4Reader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestLZ4BlockRoundTrip(t *testing.T) {
+	table := new(lz4HashTable)
+	for _, in := range compressTestInputs(false) {
+		t.Run(in.name, func(t *testing.T) {
+			block := lz4CompressBlock(nil, in.data, table)
+			out, err := lz4DecompressBlock(nil, block, len(in.data))
+			if err != nil {
+				t.Fatalf("解压失败: %v", err)
+			}
+			if !bytes.Equal(out, in.data) {
+				t.Fatalf("解压结果不一致：长度 %d，应为 %d", len(out), len(in.data))
+			}
+			// 解压出的数据超过上限时必须报错
+			if len(in.data) > 0 {
+				if _, err := lz4DecompressBlock(nil, block, len(in.data)-1); err == nil {
+					t.Fatalf("超过 maxSize 时没有报错")
+				}
+			}
+		})
+	}
+}
+
+func TestLZ4DependentBlocks(t *testing.T) {
+	// 手工构造块之间有依赖的帧：第二个块的匹配引用第一个块的数据
+	first := []byte("0123456789abcdef")
+	second := lz4AppendSequence(nil, nil, len(first), len(first))
+	second = lz4AppendLiterals(second, []byte("tail!"), 0)
+
+	descriptor := []byte{lz4FlagVersion, 4 << 4}
+	frame := binary.LittleEndian.AppendUint32(nil, lz4FrameMagic)
+	frame = append(frame, descriptor...)
+	frame = append(frame, byte(xxh32Sum(descriptor)>>8))
+	frame = binary.LittleEndian.AppendUint32(frame, uint32(len(first))|1<<31)
+	frame = append(frame, first...)
+	frame = binary.LittleEndian.AppendUint32(frame, uint32(len(second)))
+	frame = append(frame, second...)
+	frame = binary.LittleEndian.AppendUint32(frame, 0)
+
+	out, err := lz4Decompress(frame)
+	if err != nil {
+		t.Fatalf("解压失败: %v", err)
+	}
+	want := string(first) + string(first) + "tail!"
+	if string(out) != want {
+		t.Fatalf("解压结果为 %q，应为 %q", out, want)
+	}
+}
+
+func TestLZ4ConcatenatedFrames(t *testing.T) {
+	// 多个帧和可跳过的帧直接拼接
+	skippable := binary.LittleEndian.AppendUint32(nil, lz4SkippableMagic+3)
+	skippable = binary.LittleEndian.AppendUint32(skippable, 3)
+	skippable = append(skippable, 1, 2, 3)
+
+	var data []byte
+	data = append(data, lz4Compress(t, []byte("first frame "), 1)...)
+	data = append(data, skippable...)
+	data = append(data, lz4Compress(t, nil, 1)...)
+	data = append(data, lz4Compress(t, bytes.Repeat([]byte("second "), 1000), 2)...)
+
+	out, err := lz4Decompress(data)
+	if err != nil {
+		t.Fatalf("解压失败: %v", err)
+	}
+	want := "first frame " + string(bytes.Repeat([]byte("second "), 1000))
+	if string(out) != want {
+		t.Fatalf("解压结果不一致：长度 %d，应为 %d", len(out), len(want))
+	}
+}
+
+func TestLZ4Corrupt(t *testing.T) {
+	data := lz4Compress(t, bytes.Repeat([]byte("corrupt me "), 100), 1)
+	// 逐个修改帧头之后的字节，校验和或格式检查必须报错
+	for i := 7; i < len(data); i++ {
+		corrupted := bytes.Clone(data)
+		corrupted[i] ^= 0x55
+		if _, err := lz4Decompress(corrupted); err == nil {
+			t.Fatalf("修改第 %d 个字节后没有报错", i)
+		}
+	}
+	// 截断的数据必须报错
+	for i := 0; i < len(data); i++ {
+		if _, err := lz4Decompress(data[:i]); err == nil {
+			t.Fatalf("截断到 %d 字节后没有报错", i)
+		}
+	}
+}
+
+func TestXXH32(t *testing.T) {
+	// 参考值来自 xxHash 的实现（种子为 0）
+	tests := []struct {
+		input string
+		want  uint32
+	}{
+		{"", 0x02cc5d05},
+		{"a", 0x550d7456},
+		{"abc", 0x32d153ff},
+		{"Nobody inspects the spammish repetition", 0xe2293b2f},
+	}
+	for _, tt := range tests {
+		if got := xxh32Sum([]byte(tt.input)); got != tt.want {
+			t.Errorf("xxh32(%q) = %#x，应为 %#x", tt.input, got, tt.want)
+		}
+		// 分多次写入的结果必须相同
+		var x xxh32
+		x.reset()
+		for i := 0; i < len(tt.input); i++ {
+			x.Write([]byte{tt.input[i]})
+		}
+		if got := x.Sum32(); got != tt.want {
+			t.Errorf("逐字节写入 xxh32(%q) = %#x，应为 %#x", tt.input, got, tt.want)
+		}
+	}
+}
+
+// FuzzLZ4Reader 任意输入都不能让解压器崩溃或无限读取；能压缩的数据必须原样还原
+func FuzzLZ4Reader(f *testing.F) {
+	for _, in := range compressTestInputs(false) {
+		if len(in.data) <= 4096 {
+			f.Add(lz4Compress(f, in.data, 1))
+		}
+	}
+	f.Add([]byte{})
+	f.Add(binary.LittleEndian.AppendUint32(nil, lz4FrameMagic))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if r, err := newLZ4Reader(bytes.NewReader(data)); err == nil {
+			// 每个块最多解压出 4MB，不会超过输入块数 × 4MB
+			io.Copy(io.Discard, r)
+		}
+		lz4DecompressBlock(nil, data, 1<<16)
+
+		out, err := lz4Decompress(lz4Compress(t, data, 2))
+		if err != nil {
+			t.Fatalf("解压失败: %v", err)
+		}
+		if !bytes.Equal(out, data) {
+			t.Fatalf("解压结果不一致：长度 %d，应为 %d", len(out), len(data))
+		}
+	})
+}
@@ -4,122 +4,329 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
-// scanDirectory 扫描指定目录并收集文件相对路径列表（内部函数）
-// dirPath: 要扫描的目录路径（可以是相对路径或绝对路径）
-// 返回文件相对路径列表（使用 ./ 前缀格式）
-func scanDirectory(dirPath string) ([]string, error) {
-	// 获取目录的绝对路径，用于计算相对路径
-	absDirPath, err := filepath.Abs(dirPath)
-	if err != nil {
-		return nil, fmt.Errorf("无法获取目录绝对路径: %w", err)
-	}
+// manifestHeaderV2 是 v2 格式 manifest 的首行
+// v2 格式每行一个条目，字段以制表符分隔：
+//
+//	类型	权限(八进制)	大小	修改时间(秒.纳秒)	路径	[链接目标	[校验和]]
+//
+// 硬链接（h）条目的链接目标是同一 inode 在 manifest 中第一次出现的路径
+//
+// 记录了校验和时首行追加 checksum=<算法>，例如 "#p-tool-manifest v2 checksum=sha256"
+// 旧格式（v1）每行只有一个 ./relative/path，没有首行
+const manifestHeaderV2 = "#p-tool-manifest v2"
 
-	// 用于存储文件列表
-	var fileList []string
+// manifest 条目类型
+const (
+	manifestTypeFile     byte = 'f' // 普通文件
+	manifestTypeDir      byte = 'd' // 目录
+	manifestTypeSymlink  byte = 'l' // 符号链接
+	manifestTypeHardlink byte = 'h' // 硬链接（指向 manifest 中另一个普通文件）
+)
 
-	// 用于跟踪已访问的路径（解析后的真实路径），防止无限递归
-	visited := make(map[string]bool)
+// ManifestEntry 表示 manifest 中的一个条目
+type ManifestEntry struct {
+	Path       string      // 相对路径（不带 ./ 前缀，使用斜杠分隔）
+	Type       byte        // 条目类型（manifestType*）
+	Mode       os.FileMode // 权限位（含 setuid/setgid/sticky）
+	Size       int64       // 文件大小，旧格式 manifest 中为 -1 表示未知
+	ModTime    time.Time   // 修改时间
+	LinkTarget string      // 符号链接目标，或硬链接指向的条目路径
+	Checksum   string      // 文件内容校验和（十六进制），未计算时为空
+}
 
-	// 自定义的 walk 函数，支持跟随符号链接
-	var walkDir func(string, string) error
-	walkDir = func(currentPath, realPath string) error {
-		// 获取当前路径的绝对路径（未解析符号链接的路径）
-		absCurrentPath, err := filepath.Abs(currentPath)
-		if err != nil {
-			// 如果无法获取绝对路径，跳过
-			return nil
+// hasMetadata 判断条目是否带有元数据（旧格式 manifest 只有路径）
+func (e *ManifestEntry) hasMetadata() bool {
+	return e.Size >= 0
+}
+
+// newManifestEntry 根据文件信息创建 manifest 条目
+func newManifestEntry(relPath string, info os.FileInfo) ManifestEntry {
+	entry := ManifestEntry{
+		Path:    relPath,
+		Type:    manifestTypeFile,
+		Mode:    info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+	switch {
+	case info.IsDir():
+		entry.Type = manifestTypeDir
+		entry.Size = 0
+	case info.Mode()&os.ModeSymlink != 0:
+		entry.Type = manifestTypeSymlink
+		entry.Size = 0
+	}
+	return entry
+}
+
+// manifestPaths 返回条目的相对路径列表
+func manifestPaths(entries []ManifestEntry) []string {
+	paths := make([]string, len(entries))
+	for i := range entries {
+		paths[i] = entries[i].Path
+	}
+	return paths
+}
+
+// manifestTotalSize 返回所有条目的总大小，存在未知大小的条目时返回 -1
+func manifestTotalSize(entries []ManifestEntry) int64 {
+	var total int64
+	for i := range entries {
+		if !entries[i].hasMetadata() {
+			return -1
 		}
+		total += entries[i].Size
+	}
+	return total
+}
+
+// fileModeToUnix 将 os.FileMode 的权限位转换为 Unix 权限位
+func fileModeToUnix(mode os.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		m |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		m |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		m |= 01000
+	}
+	return m
+}
+
+// unixToFileMode 将 Unix 权限位转换为 os.FileMode
+func unixToFileMode(m uint32) os.FileMode {
+	mode := os.FileMode(m & 0777)
+	if m&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if m&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if m&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// manifestPathEscaper 转义路径中的反斜杠、制表符和换行符
+var manifestPathEscaper = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
 
-		// 解析符号链接获取真实路径
-		absRealPath, err := filepath.EvalSymlinks(realPath)
+// manifestPathUnescaper 还原被转义的路径
+var manifestPathUnescaper = strings.NewReplacer("\\\\", "\\", "\\t", "\t", "\\n", "\n", "\\r", "\r")
+
+// formatManifestPath 将相对路径格式化为 ./relative/path
+func formatManifestPath(relPath string) string {
+	formattedPath := filepath.ToSlash(relPath)
+	if !strings.HasPrefix(formattedPath, "./") {
+		formattedPath = "./" + formattedPath
+	}
+	return formattedPath
+}
+
+// writeManifestEntries 以 v2 格式写入 manifest 条目
+// checksumAlgo 为空表示不记录校验和
+func writeManifestEntries(w io.Writer, entries []ManifestEntry, checksumAlgo string) error {
+	bufferedWriter := bufio.NewWriterSize(w, 256*1024)
+
+	header := manifestHeaderV2
+	if checksumAlgo != "" {
+		header += " checksum=" + checksumAlgo
+	}
+	if _, err := fmt.Fprintf(bufferedWriter, "%s\n", header); err != nil {
+		return err
+	}
+
+	for i := range entries {
+		entry := &entries[i]
+		_, err := fmt.Fprintf(bufferedWriter, "%c\t%04o\t%d\t%d.%09d\t%s",
+			entry.Type,
+			fileModeToUnix(entry.Mode),
+			entry.Size,
+			entry.ModTime.Unix(), entry.ModTime.Nanosecond(),
+			manifestPathEscaper.Replace(formatManifestPath(entry.Path)))
 		if err != nil {
-			// 如果无法解析符号链接，尝试使用原始路径
-			absRealPath, err = filepath.Abs(realPath)
-			if err != nil {
-				// 如果无法获取绝对路径，跳过
-				return nil
+			return err
+		}
+		if entry.LinkTarget != "" || entry.Checksum != "" {
+			if _, err := fmt.Fprintf(bufferedWriter, "\t%s", manifestPathEscaper.Replace(entry.LinkTarget)); err != nil {
+				return err
 			}
 		}
-
-		// 检查是否已访问过（防止无限递归）
-		if visited[absRealPath] {
-			return nil
+		if entry.Checksum != "" {
+			if _, err := fmt.Fprintf(bufferedWriter, "\t%s", entry.Checksum); err != nil {
+				return err
+			}
 		}
+		if err := bufferedWriter.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
 
-		// 标记为已访问
-		visited[absRealPath] = true
+	return bufferedWriter.Flush()
+}
 
-		// 获取文件信息
-		info, err := os.Stat(absRealPath)
-		if err != nil {
-			// 如果文件不存在或无法访问（如断开的符号链接），跳过
-			return nil
+// parseManifest 解析 manifest 内容，同时支持 v2 格式和旧的每行一个路径的格式
+// 返回条目列表以及记录校验和所用的算法（未记录时为空）
+func parseManifest(r io.Reader) ([]ManifestEntry, string, error) {
+	var entries []ManifestEntry
+	var checksumAlgo string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	isV2 := false
+	firstLine := true
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+
+		// 首行决定格式
+		if firstLine {
+			firstLine = false
+			if strings.HasPrefix(line, manifestHeaderV2) {
+				isV2 = true
+				for _, attr := range strings.Fields(line[len(manifestHeaderV2):]) {
+					if algo, ok := strings.CutPrefix(attr, "checksum="); ok {
+						checksumAlgo = algo
+					}
+				}
+				continue
+			}
 		}
 
-		// 如果是文件（非目录），记录到列表
-		if !info.IsDir() {
-			// 计算相对路径（使用原始路径，保持符号链接的结构）
-			relPath, err := filepath.Rel(absDirPath, absCurrentPath)
-			if err != nil {
-				// 如果无法计算相对路径，跳过
-				return nil
+		if !isV2 {
+			// 旧格式：每行一个路径
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
 			}
-			// 转换为斜杠格式，格式为 ./relative/path
-			relPath = filepath.ToSlash(relPath)
-			fileList = append(fileList, "./"+relPath)
-			return nil
+			entries = append(entries, ManifestEntry{
+				Path: normalizeManifestPath(line),
+				Type: manifestTypeFile,
+				Size: -1,
+			})
+			continue
 		}
 
-		// 如果是目录，继续遍历
-		entries, err := os.ReadDir(absRealPath)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entry, err := parseManifestLine(line)
 		if err != nil {
-			// 如果无法读取目录（如权限问题），跳过
-			return nil
+			return nil, "", fmt.Errorf("第 %d 行格式错误: %w", lineNum, err)
 		}
+		entries = append(entries, entry)
+	}
 
-		for _, entry := range entries {
-			// 构建子路径
-			entryCurrentPath := filepath.Join(currentPath, entry.Name())
-			entryRealPath := filepath.Join(absRealPath, entry.Name())
+	if err := scanner.Err(); err != nil {
+		return nil, "", err
+	}
 
-			// 递归遍历
-			if err := walkDir(entryCurrentPath, entryRealPath); err != nil {
-				// 如果递归过程中出现错误，继续处理其他文件
-				// 不中断整个遍历过程
-				continue
-			}
-		}
+	return entries, checksumAlgo, nil
+}
+
+// parseManifestLine 解析 v2 格式的一行
+func parseManifestLine(line string) (ManifestEntry, error) {
+	var entry ManifestEntry
+
+	fields := strings.Split(line, "\t")
+	if len(fields) < 5 {
+		return entry, fmt.Errorf("字段数量不足: %q", line)
+	}
+	if len(fields[0]) != 1 {
+		return entry, fmt.Errorf("无效的条目类型: %q", fields[0])
+	}
+	entry.Type = fields[0][0]
 
-		return nil
+	mode, err := strconv.ParseUint(fields[1], 8, 32)
+	if err != nil {
+		return entry, fmt.Errorf("无效的权限: %q", fields[1])
+	}
+	entry.Mode = unixToFileMode(uint32(mode))
+
+	entry.Size, err = strconv.ParseInt(fields[2], 10, 64)
+	if err != nil || entry.Size < 0 {
+		return entry, fmt.Errorf("无效的大小: %q", fields[2])
 	}
 
-	// 开始遍历
-	err = walkDir(dirPath, dirPath)
+	secStr, nsecStr, _ := strings.Cut(fields[3], ".")
+	sec, err := strconv.ParseInt(secStr, 10, 64)
 	if err != nil {
-		return nil, fmt.Errorf("扫描目录时出错: %w", err)
+		return entry, fmt.Errorf("无效的修改时间: %q", fields[3])
+	}
+	var nsec int64
+	if nsecStr != "" {
+		nsec, err = strconv.ParseInt(nsecStr, 10, 64)
+		if err != nil {
+			return entry, fmt.Errorf("无效的修改时间: %q", fields[3])
+		}
+	}
+	entry.ModTime = time.Unix(sec, nsec)
+
+	entry.Path = normalizeManifestPath(manifestPathUnescaper.Replace(fields[4]))
+	if len(fields) > 5 {
+		entry.LinkTarget = manifestPathUnescaper.Replace(fields[5])
+	}
+	if len(fields) > 6 {
+		entry.Checksum = fields[6]
 	}
 
-	return fileList, nil
+	return entry, nil
+}
+
+// normalizeManifestPath 移除开头的 ./ 并统一使用斜杠
+func normalizeManifestPath(p string) string {
+	p = strings.TrimPrefix(p, "./")
+	if filepath.Separator != '/' {
+		p = filepath.ToSlash(p)
+	}
+	return p
+}
+
+// ManifestOptions 生成 manifest 文件时的选项
+type ManifestOptions struct {
+	ChecksumAlgo string      // 校验和算法（xxh3、sha256、blake3），为空表示不计算
+	Concurrency  int         // 扫描目录和计算校验和的并发数量，<= 0 时使用 CPU 核数
+	Filter       *PathFilter // 包含/排除规则，为 nil 表示不过滤
+
+	IgnoreFiles      []string // 按 gitignore 语义读取的忽略文件名（每个目录中查找）或路径
+	RespectGitignore bool     // 是否遵循 .gitignore 和 .git/info/exclude
+	Symlinks         string   // 符号链接处理方式（follow、preserve、skip），为空等同于 follow
+	IncludeDirs      bool     // 是否同时记录目录条目（镜像模式查找多余的空目录时使用）
 }
 
 // GenerateManifest 扫描指定目录并生成 manifest 文件
 // dirPath: 要扫描的目录路径（可以是相对路径或绝对路径）
 // manifestPath: manifest 文件的输出路径
-func GenerateManifest(dirPath, manifestPath string) error {
+func GenerateManifest(dirPath, manifestPath string, opts ManifestOptions) error {
 	// 扫描目录获取文件列表
-	fileList, err := scanDirectory(dirPath)
-	if err != nil {
+	fileList, err := scanDirectory(dirPath, opts)
+	if err = warnScanIncomplete(err); err != nil {
 		return err
 	}
 
+	// 并行计算每个文件的校验和
+	if opts.ChecksumAlgo != "" {
+		if err := computeChecksums(dirPath, fileList, opts.ChecksumAlgo, opts.Concurrency); err != nil {
+			return err
+		}
+	}
+
 	// 创建 manifest 文件
 	manifestFile, err := os.Create(manifestPath)
 	if err != nil {
@@ -127,12 +334,9 @@ func GenerateManifest(dirPath, manifestPath string) error {
 	}
 	defer manifestFile.Close()
 
-	// 写入文件列表
-	for _, relPath := range fileList {
-		_, err = fmt.Fprintf(manifestFile, "%s\n", relPath)
-		if err != nil {
-			return err
-		}
+	// 以 v2 格式写入文件列表（包含大小、权限、修改时间等元数据）
+	if err := writeManifestEntries(manifestFile, fileList, opts.ChecksumAlgo); err != nil {
+		return fmt.Errorf("写入 manifest 文件失败: %w", err)
 	}
 
 	return nil
@@ -140,34 +344,78 @@ func GenerateManifest(dirPath, manifestPath string) error {
 
 // GenerateManifestInMemory 扫描指定目录并在内存中生成 manifest 列表
 // dirPath: 要扫描的目录路径（可以是相对路径或绝对路径）
-// 返回文件相对路径列表（已移除 ./ 前缀）
-func GenerateManifestInMemory(dirPath string) ([]string, error) {
-	// 扫描目录获取文件列表
-	fileList, err := scanDirectory(dirPath)
-	if err != nil {
-		return nil, err
-	}
-
-	// 移除 ./ 前缀
-	result := make([]string, len(fileList))
-	for i, path := range fileList {
-		result[i] = strings.TrimPrefix(path, "./")
-	}
-
-	return result, nil
+// opts: 扫描选项（只使用其中的过滤规则）
+// 返回文件条目列表（路径已移除 ./ 前缀）；有目录无法读取时同时返回 *scanIncompleteError，见 scanDirectory
+func GenerateManifestInMemory(dirPath string, opts ManifestOptions) ([]ManifestEntry, error) {
+	return scanDirectory(dirPath, opts)
 }
 
 // manifestCmd represents the manifest command
 var manifestCmd = &cobra.Command{
 	Use:   "manifest <目录路径> <manifest文件路径>",
 	Short: "生成用于加速并行命令的 manifest 文件",
-	Long: `扫描指定目录并生成一个 manifest 文件，文件中每一行都是该目录下文件的相对路径。
-例如：manifest /root /tmp/manifest.txt`,
+	Long: `扫描指定目录并生成一个 manifest 文件，文件中每一行描述该目录下的一个文件。
+
+manifest 使用 v2 格式，首行为版本标识，之后每行记录文件的类型、权限、大小、
+修改时间和相对路径，cp、tar 等命令可以直接使用这些元数据而无需重新 stat。
+读取时同样兼容旧的每行一个路径的格式。
+
+使用 --checksum 可以为每个文件记录内容校验和，之后可通过 verify 命令校验目录内容。
+
+使用 --include / --exclude 可以按 glob 规则过滤文件（可重复指定，支持 **）：
+- 不含 / 的规则匹配任意层级的文件或目录名，例如 *.tmp
+- 含 / 的规则从扫描目录开始匹配，例如 node_modules/.cache、src/**/*.go
+- 以 / 结尾的规则只匹配目录，被排除的目录会连同子树一起跳过
+- 指定了 --include 时，只保留命中包含规则的文件（或位于命中目录下的文件）
+--exclude-from 从文件读取排除规则，每行一条，忽略空行和 # 开头的注释。
+
+使用 --ignore-file <文件名> 可以按 gitignore 语义读取每个目录中的忽略文件
+（如 .gitignore、.dockerignore），支持嵌套的忽略文件、! 取反和只匹配目录的规则；
+--respect-gitignore 等价于遵循 .gitignore 和 .git/info/exclude 并跳过 .git 目录，
+生成的 manifest 与 git 会跟踪的文件一致。
+
+使用 --symlinks 指定符号链接的处理方式：
+- follow（默认）：跟随符号链接，按链接目标记录为文件，指向目录的链接会继续遍历
+- preserve：将符号链接本身记录为 l 条目，cp、tar 会保留为链接而不复制目标内容
+- skip：跳过所有符号链接
+
+指向同一 inode 的多个路径（硬链接）中，第一个路径记录为普通文件，其余记录为 h 条目，
+tar 会为它们写入硬链接条目，cp 会在目标目录重建硬链接。
+
+例如：
+  p-tool manifest /root /tmp/manifest.txt
+  p-tool manifest /root /tmp/manifest.txt --checksum xxh3
+  p-tool manifest /root /tmp/manifest.txt --exclude node_modules/.cache --exclude '*.tmp'
+  p-tool manifest /repo /tmp/manifest.txt --respect-gitignore
+  p-tool manifest /root /tmp/manifest.txt --symlinks preserve`,
 	Args: cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		dirPath := args[0]
 		manifestPath := args[1]
 
+		checksumAlgo, _ := cmd.Flags().GetString("checksum")
+		concurrency, _ := cmd.Flags().GetInt("concurrency")
+
+		// 验证校验和算法
+		if checksumAlgo != "" {
+			if _, err := newChecksumHash(checksumAlgo); err != nil {
+				fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		// 设置并发数
+		if concurrency <= 0 {
+			concurrency = runtime.NumCPU()
+		}
+
+		// 解析过滤规则和忽略文件
+		opts, err := scanOptionsFromFlags(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+			os.Exit(1)
+		}
+
 		// 验证目录是否存在
 		dirInfo, err := os.Stat(dirPath)
 		if err != nil {
@@ -180,7 +428,9 @@ var manifestCmd = &cobra.Command{
 		}
 
 		// 使用共享函数生成 manifest
-		if err := GenerateManifest(dirPath, manifestPath); err != nil {
+		opts.ChecksumAlgo = checksumAlgo
+		opts.Concurrency = concurrency
+		if err := GenerateManifest(dirPath, manifestPath, opts); err != nil {
 			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
 			os.Exit(1)
 		}
@@ -191,4 +441,9 @@ var manifestCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(manifestCmd)
+
+	manifestCmd.Flags().String("checksum", "", "为每个文件记录内容校验和，可选 xxh3、sha256、blake3")
+	manifestCmd.Flags().Int("concurrency", 0, "指定并发数量，默认为 CPU 核数")
+	addFilterFlags(manifestCmd)
+	addSymlinksFlag(manifestCmd)
 }
@@ -0,0 +1,20 @@
+//go:build !unix
+
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+)
+
+// openNoFollow 打开文件，path 的最后一级是符号链接时返回错误而不是跟随链接
+// 没有 O_NOFOLLOW 的平台上先用 Lstat 检查（检查和打开之间不是原子的）
+func openNoFollow(path string, flag int, perm os.FileMode) (*os.File, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return nil, &os.PathError{Op: "open", Path: path, Err: fmt.Errorf("是符号链接")}
+	}
+	return os.OpenFile(path, flag, perm)
+}
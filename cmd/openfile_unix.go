@@ -0,0 +1,16 @@
+//go:build unix
+
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+	"syscall"
+)
+
+// openNoFollow 打开文件，path 的最后一级是符号链接时返回错误而不是跟随链接
+func openNoFollow(path string, flag int, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(path, flag|syscall.O_NOFOLLOW, perm)
+}
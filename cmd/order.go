@@ -0,0 +1,234 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"container/heap"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+// 任务调度顺序（--order）
+const (
+	orderManifest     = "manifest"      // 按 manifest（或 tar 包）中的顺序（默认）
+	orderLargestFirst = "largest-first" // 大文件优先，避免最后只剩一个大文件在处理、其他协程空闲的长尾
+	orderLocality     = "locality"      // 按文件在磁盘上的位置（设备号、inode）顺序读取，减少机械硬盘的寻道
+)
+
+// untarOrderWindow largest-first 顺序下解压队列最多缓存的条目数（同时受 --max-buffer 限制）
+const untarOrderWindow = 1024
+
+// addOrderFlag 为命令添加 --order 参数
+func addOrderFlag(cmd *cobra.Command) {
+	cmd.Flags().String("order", orderManifest, "任务调度顺序：manifest（按 manifest 顺序）、largest-first（大文件优先）、locality（按磁盘位置，适合机械硬盘）")
+}
+
+// orderFromFlags 读取并校验 --order 参数
+func orderFromFlags(cmd *cobra.Command) (string, error) {
+	order, _ := cmd.Flags().GetString("order")
+	switch order {
+	case orderManifest, orderLargestFirst, orderLocality:
+		return order, nil
+	}
+	return "", fmt.Errorf("无效的 --order 参数: %s（可选 manifest、largest-first、locality）", order)
+}
+
+// orderEntries 返回按调度顺序排列的 fileList 副本，不修改 fileList
+// largest-first 优先使用 manifest 中的大小，旧格式 manifest 没有大小时先并行 stat 源文件；
+// locality 需要 stat 所有源文件获取 inode，不支持 inode 的平台上按路径排序
+func orderEntries(sourceDir string, fileList []ManifestEntry, order string, concurrency int) []ManifestEntry {
+	if order == orderManifest || len(fileList) < 2 {
+		return fileList
+	}
+
+	index := make([]int, len(fileList))
+	for i := range index {
+		index[i] = i
+	}
+
+	switch order {
+	case orderLargestFirst:
+		sizes := make([]int64, len(fileList))
+		var missing []int
+		for i := range fileList {
+			if fileList[i].hasMetadata() {
+				sizes[i] = fileList[i].Size
+			} else {
+				missing = append(missing, i)
+			}
+		}
+		statEntries(sourceDir, fileList, missing, concurrency, func(i int, info os.FileInfo) {
+			sizes[i] = info.Size()
+		})
+		sort.SliceStable(index, func(a, b int) bool {
+			return sizes[index[a]] > sizes[index[b]]
+		})
+
+	case orderLocality:
+		ids := make([]fileID, len(fileList))
+		known := make([]bool, len(fileList))
+		statEntries(sourceDir, fileList, index, concurrency, func(i int, info os.FileInfo) {
+			ids[i], known[i] = inodeID(info)
+		})
+		// 无法获取 inode 的条目排在最后，按路径排序
+		sort.SliceStable(index, func(a, b int) bool {
+			i, j := index[a], index[b]
+			if known[i] != known[j] {
+				return known[i]
+			}
+			if !known[i] {
+				return fileList[i].Path < fileList[j].Path
+			}
+			if ids[i].dev != ids[j].dev {
+				return ids[i].dev < ids[j].dev
+			}
+			return ids[i].ino < ids[j].ino
+		})
+	}
+
+	ordered := make([]ManifestEntry, len(fileList))
+	for i, j := range index {
+		ordered[i] = fileList[j]
+	}
+	return ordered
+}
+
+// statEntries 并行 stat indices 中的条目，对成功的条目调用 fn（fn 需要可以并发调用）
+// 失败的条目直接忽略，真正处理时会报告错误
+func statEntries(sourceDir string, fileList []ManifestEntry, indices []int, concurrency int, fn func(i int, info os.FileInfo)) {
+	if len(indices) == 0 {
+		return
+	}
+
+	taskChan := make(chan int, concurrency*2)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range taskChan {
+				entry := &fileList[i]
+				fullPath := filepath.Join(sourceDir, entry.Path)
+				var info os.FileInfo
+				var err error
+				if entry.Type == manifestTypeSymlink {
+					info, err = os.Lstat(fullPath)
+				} else {
+					info, err = os.Stat(fullPath)
+				}
+				if err == nil {
+					fn(i, info)
+				}
+			}
+		}()
+	}
+
+	for _, i := range indices {
+		taskChan <- i
+	}
+	close(taskChan)
+	wg.Wait()
+}
+
+// fileEntryQueue 解压时读取协程与写入协程之间的任务队列
+// manifest 和 locality 顺序下先进先出（tar 包中的顺序就是读取顺序）；
+// largest-first 顺序下优先取出已缓存的最大文件，避免大文件排在最后成为长尾。
+// 读取协程保证队列中不会同时有两个相同路径的条目，并在直接写入条目前等待队列写完，
+// 因此重新排列不会改变同一路径的多个条目的写入顺序
+type fileEntryQueue struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	items    queuedEntries
+	capacity int
+	seq      int64
+	closed   bool
+}
+
+// queuedEntry 队列中的条目，seq 为入队顺序
+type queuedEntry struct {
+	entry *fileEntry
+	seq   int64
+}
+
+// queuedEntries 实现 heap.Interface
+type queuedEntries struct {
+	entries      []queuedEntry
+	largestFirst bool
+}
+
+func (q *queuedEntries) Len() int { return len(q.entries) }
+
+func (q *queuedEntries) Less(i, j int) bool {
+	a, b := q.entries[i], q.entries[j]
+	if q.largestFirst && a.entry.header.Size != b.entry.header.Size {
+		return a.entry.header.Size > b.entry.header.Size
+	}
+	return a.seq < b.seq
+}
+
+func (q *queuedEntries) Swap(i, j int) { q.entries[i], q.entries[j] = q.entries[j], q.entries[i] }
+
+func (q *queuedEntries) Push(x interface{}) { q.entries = append(q.entries, x.(queuedEntry)) }
+
+func (q *queuedEntries) Pop() interface{} {
+	n := len(q.entries)
+	item := q.entries[n-1]
+	q.entries = q.entries[:n-1]
+	return item
+}
+
+// newFileEntryQueue 创建最多缓存 capacity 个条目的解压任务队列
+func newFileEntryQueue(capacity int, order string) *fileEntryQueue {
+	largestFirst := order == orderLargestFirst
+	if largestFirst && capacity < untarOrderWindow {
+		// 队列越长，可供挑选的文件越多
+		capacity = untarOrderWindow
+	}
+	q := &fileEntryQueue{capacity: capacity, items: queuedEntries{largestFirst: largestFirst}}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+// push 将条目加入队列，队列已满时阻塞等待
+func (q *fileEntryQueue) push(entry *fileEntry) {
+	q.mu.Lock()
+	for q.items.Len() >= q.capacity {
+		q.notFull.Wait()
+	}
+	heap.Push(&q.items, queuedEntry{entry: entry, seq: q.seq})
+	q.seq++
+	q.mu.Unlock()
+	q.notEmpty.Signal()
+}
+
+// pop 按调度顺序取出一个条目，队列已关闭且为空时返回 false
+func (q *fileEntryQueue) pop() (*fileEntry, bool) {
+	q.mu.Lock()
+	for q.items.Len() == 0 && !q.closed {
+		q.notEmpty.Wait()
+	}
+	if q.items.Len() == 0 {
+		q.mu.Unlock()
+		return nil, false
+	}
+	item := heap.Pop(&q.items).(queuedEntry)
+	q.mu.Unlock()
+	q.notFull.Signal()
+	return item.entry, true
+}
+
+// close 关闭队列，写入协程取完剩余条目后退出
+func (q *fileEntryQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.notEmpty.Broadcast()
+}
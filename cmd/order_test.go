@@ -0,0 +1,66 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUntarDuplicatePathOrder(t *testing.T) {
+	// 内存预算为 256KB 时超过 256KB 的文件由读取协程直接写入，其余文件进入队列
+	const maxBuffer = 256 * 1024
+	large := strings.Repeat("L", maxBuffer+1)
+
+	var entries []testTarEntry
+	want := make(map[string]string)
+	for i := 0; i < 50; i++ {
+		queuedTwice := fmt.Sprintf("queued%d", i)
+		queuedThenStreamed := fmt.Sprintf("q-then-s%d", i)
+		streamedThenQueued := fmt.Sprintf("s-then-q%d", i)
+		entries = append(entries,
+			testFile(queuedTwice, "first"),
+			testFile(queuedThenStreamed, "first"),
+			// 更大的文件在 largest-first 下会先于前面的小文件写入
+			testFile(fmt.Sprintf("filler%d", i), strings.Repeat("f", 64*1024)),
+			testFile(queuedTwice, strings.Repeat("second", 100)),
+			testFile(queuedThenStreamed, large),
+			testFile(streamedThenQueued, large),
+			testFile(streamedThenQueued, "second"),
+		)
+		want[queuedTwice] = strings.Repeat("second", 100)
+		want[queuedThenStreamed] = large
+		want[streamedThenQueued] = "second"
+	}
+
+	for _, concurrency := range []int{1, 4, 8} {
+		for _, order := range []string{orderManifest, orderLargestFirst, orderLocality} {
+			t.Run(fmt.Sprintf("并发%d/%s", concurrency, order), func(t *testing.T) {
+				root := t.TempDir()
+				tarPath := filepath.Join(root, "dup.tar")
+				writeTestTar(t, tarPath, entries)
+				destDir := filepath.Join(root, "dest")
+				if err := os.MkdirAll(destDir, 0755); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := extractTarParallel(tarPath, destDir, concurrency, compressAuto, maxBuffer, false, false, nil, order); err != nil {
+					t.Fatal(err)
+				}
+				for name, content := range want {
+					data, err := os.ReadFile(filepath.Join(destDir, name))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !bytes.Equal(data, []byte(content)) {
+						t.Errorf("%s 不是 tar 包中最后一个同名条目的内容（长度 %d，应为 %d）", name, len(data), len(content))
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// preserveOptions cp 需要保留的元数据（--preserve）
+type preserveOptions struct {
+	mode       bool // 权限位（含 setuid/setgid/sticky）
+	timestamps bool // 修改时间
+	ownership  bool // 属主和属组
+	xattr      bool // 扩展属性
+}
+
+// any 判断是否需要保留任何元数据
+func (p preserveOptions) any() bool {
+	return p.mode || p.timestamps || p.ownership || p.xattr
+}
+
+// parsePreserve 解析 --preserve 参数，多个属性以逗号分隔，all 表示全部
+func parsePreserve(value string) (preserveOptions, error) {
+	var p preserveOptions
+	for _, item := range strings.Split(value, ",") {
+		switch strings.TrimSpace(item) {
+		case "":
+		case "mode":
+			p.mode = true
+		case "timestamps":
+			p.timestamps = true
+		case "ownership":
+			p.ownership = true
+		case "xattr":
+			p.xattr = true
+		case "all":
+			p = preserveOptions{mode: true, timestamps: true, ownership: true, xattr: true}
+		default:
+			return p, fmt.Errorf("无效的 --preserve 参数: %s（可选 mode、timestamps、ownership、xattr、all）", item)
+		}
+	}
+	return p, nil
+}
+
+// addPreserveFlags 为命令添加 --preserve 和 -a/--archive 参数
+func addPreserveFlags(cmd *cobra.Command) {
+	cmd.Flags().String("preserve", "", "保留的元数据，逗号分隔：mode、timestamps、ownership、xattr，或 all")
+	cmd.Flags().BoolP("archive", "a", false, "归档模式，等同于 --preserve=all")
+}
+
+// preserveFromFlags 根据命令参数生成需要保留的元数据
+func preserveFromFlags(cmd *cobra.Command) (preserveOptions, error) {
+	value, _ := cmd.Flags().GetString("preserve")
+	archive, _ := cmd.Flags().GetBool("archive")
+	if archive {
+		value = "all"
+	}
+	return parsePreserve(value)
+}
+
+// applyPreservedMetadata 将源路径的元数据应用到目标路径（内容已写入完成后调用）
+// isSymlink 表示目标是保留下来的符号链接，此时读取和设置的都是链接本身的元数据，否则跟随源路径的符号链接。
+// 顺序：属主 -> 权限 -> 扩展属性 -> 修改时间（chown 会清除 setuid 位，写扩展属性可能更新时间）
+func applyPreservedMetadata(sourcePath, destPath string, isSymlink bool, opts preserveOptions) error {
+	var info os.FileInfo
+	var err error
+	if isSymlink {
+		info, err = os.Lstat(sourcePath)
+	} else {
+		info, err = os.Stat(sourcePath)
+	}
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	if opts.ownership {
+		if uid, gid, ok := fileOwner(info); ok {
+			// 非 root 用户通常无权修改属主，与 cp -p 一样忽略权限错误
+			if err := os.Lchown(destPath, uid, gid); err != nil && !errors.Is(err, os.ErrPermission) {
+				errs = append(errs, fmt.Errorf("设置属主失败: %w", err))
+			}
+		}
+	}
+
+	if opts.mode && !isSymlink {
+		if err := os.Chmod(destPath, info.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+			errs = append(errs, fmt.Errorf("设置权限失败: %w", err))
+		}
+	}
+
+	if opts.xattr && !isSymlink {
+		if err := copyXattrs(sourcePath, destPath); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if opts.timestamps {
+		// 访问时间保持不变，只保留修改时间
+		if isSymlink {
+			err = lchtimes(destPath, info.ModTime())
+		} else {
+			err = os.Chtimes(destPath, time.Time{}, info.ModTime())
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("设置修改时间失败: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// preserveDirectories 最后为所有目录（包括目标根目录）应用元数据
+// 从深到浅处理，避免在子目录中创建文件时修改已恢复的父目录修改时间
+func preserveDirectories(sourceDir, destDir string, fileList []ManifestEntry, opts preserveOptions) {
+	dirSet := map[string]bool{".": true}
+	for i := range fileList {
+		if fileList[i].Type == manifestTypeDir {
+			dirSet[filepath.FromSlash(fileList[i].Path)] = true
+		}
+		for dir := filepath.Dir(filepath.FromSlash(fileList[i].Path)); dir != "." && !dirSet[dir]; dir = filepath.Dir(dir) {
+			dirSet[dir] = true
+		}
+	}
+
+	// 按深度从深到浅排序，根目录最后
+	depth := func(dir string) int {
+		if dir == "." {
+			return -1
+		}
+		return strings.Count(dir, string(filepath.Separator))
+	}
+	dirs := make([]string, 0, len(dirSet))
+	for dir := range dirSet {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if di, dj := depth(dirs[i]), depth(dirs[j]); di != dj {
+			return di > dj
+		}
+		return dirs[i] < dirs[j]
+	})
+
+	for _, dir := range dirs {
+		if err := applyPreservedMetadata(filepath.Join(sourceDir, dir), filepath.Join(destDir, dir), false, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "警告: 保留目录元数据失败 %s: %v\n", filepath.Join(destDir, dir), err)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import "os"
+
+// fileOwner 在不支持 uid/gid 的平台上不保留属主
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
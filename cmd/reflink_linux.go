@@ -0,0 +1,46 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile 使用 FICLONE ioctl 让目标文件与源文件共享数据块（btrfs、XFS 等支持 reflink 的文件系统）
+// 文件系统不支持或跨文件系统时返回的错误满足 errors.Is(err, errors.ErrUnsupported)
+func cloneFile(dst, src *os.File) error {
+	err := unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+	switch err {
+	case nil:
+		return nil
+	case unix.EOPNOTSUPP, unix.ENOTTY, unix.EXDEV, unix.EINVAL, unix.ENOSYS:
+		return fmt.Errorf("%w: %v", errors.ErrUnsupported, err)
+	}
+	return err
+}
+
+// copyFileRange 使用 copy_file_range 在内核中复制文件内容，数据不经过用户态
+// 内核或文件系统不支持时（且尚未复制任何数据）返回的错误满足 errors.Is(err, errors.ErrUnsupported)
+func copyFileRange(dst, src *os.File) (int64, error) {
+	var total int64
+	for {
+		n, err := unix.CopyFileRange(int(src.Fd()), nil, int(dst.Fd()), nil, 1<<30, 0)
+		switch {
+		case err == unix.EINTR:
+			continue
+		case err != nil:
+			if total == 0 && (err == unix.ENOSYS || err == unix.EXDEV || err == unix.EOPNOTSUPP || err == unix.EINVAL) {
+				return 0, fmt.Errorf("%w: %v", errors.ErrUnsupported, err)
+			}
+			return total, err
+		case n == 0:
+			return total, nil
+		}
+		total += int64(n)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"os"
+)
+
+// cloneFile 在非 Linux 平台上不支持 reflink
+func cloneFile(dst, src *os.File) error {
+	return errors.ErrUnsupported
+}
+
+// copyFileRange 在非 Linux 平台上不支持 copy_file_range
+func copyFileRange(dst, src *os.File) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
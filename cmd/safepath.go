@@ -0,0 +1,119 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// pathGuard 校验 tar 条目路径，防止解压时写出目标目录
+// - 拒绝绝对路径和越过目标目录的 .. 路径
+// - 拒绝经过本归档创建的符号链接写入文件
+// - 硬链接目标同样限制在目标目录内
+type pathGuard struct {
+	unsafe   bool            // 为 true 时跳过所有校验（--unsafe-paths）
+	symlinks map[string]bool // 本归档创建的符号链接（规范化后的相对路径）
+}
+
+// newPathGuard 创建路径校验器
+func newPathGuard(unsafe bool) *pathGuard {
+	return &pathGuard{
+		unsafe:   unsafe,
+		symlinks: make(map[string]bool),
+	}
+}
+
+// sanitizeEntryPath 规范化 tar 条目路径，拒绝绝对路径和越过目标目录的路径
+// 返回不带 ./ 前缀、使用斜杠分隔的相对路径，归档根目录返回空字符串
+func sanitizeEntryPath(name string) (string, error) {
+	if strings.HasPrefix(name, "/") || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("不允许使用绝对路径: %s", name)
+	}
+
+	cleaned := path.Clean(name)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("路径越过了目标目录: %s", name)
+	}
+	if cleaned == "." {
+		return "", nil
+	}
+
+	return cleaned, nil
+}
+
+// normalize 规范化条目路径（--unsafe-paths 时只做简单的格式转换）
+func (g *pathGuard) normalize(name string) (string, error) {
+	if g.unsafe {
+		// 移除 ./ 前缀，统一使用斜杠
+		normalizedPath := strings.TrimPrefix(name, "./")
+		if filepath.Separator != '/' {
+			normalizedPath = filepath.ToSlash(normalizedPath)
+		}
+		return strings.TrimSuffix(normalizedPath, "/"), nil
+	}
+	return sanitizeEntryPath(name)
+}
+
+// symlinkAncestor 返回 relPath 经过的本归档创建的符号链接，没有则返回空字符串
+func (g *pathGuard) symlinkAncestor(relPath string) string {
+	for i := 0; i < len(relPath); i++ {
+		if relPath[i] == '/' && g.symlinks[relPath[:i]] {
+			return relPath[:i]
+		}
+	}
+	return ""
+}
+
+// checkEntry 校验条目路径及硬链接目标，返回规范化后的相对路径
+// 符号链接条目会被记录下来，用于校验后续条目
+func (g *pathGuard) checkEntry(header *tar.Header) (string, error) {
+	relPath, err := g.normalize(header.Name)
+	if err != nil || g.unsafe {
+		return relPath, err
+	}
+
+	if link := g.symlinkAncestor(relPath); link != "" {
+		return "", fmt.Errorf("拒绝经过归档内的符号链接 %s 写入: %s", link, header.Name)
+	}
+
+	switch header.Typeflag {
+	case tar.TypeLink:
+		// 硬链接目标必须位于目标目录内，且不能经过或指向归档内的符号链接
+		target, err := sanitizeEntryPath(header.Linkname)
+		if err != nil {
+			return "", fmt.Errorf("硬链接目标不安全: %w", err)
+		}
+		if target == "" || g.symlinks[target] || g.symlinkAncestor(target) != "" {
+			return "", fmt.Errorf("硬链接目标不安全: %s -> %s", header.Name, header.Linkname)
+		}
+	case tar.TypeSymlink:
+		g.symlinks[relPath] = true
+	}
+
+	return relPath, nil
+}
+
+// prepareEntry 校验条目，并在条目替换本归档创建的符号链接时先删除该链接，
+// 避免随后的写入跟随符号链接写到目标目录之外
+func (g *pathGuard) prepareEntry(destDir string, header *tar.Header) (string, error) {
+	replacesLink := !g.unsafe && header.Typeflag != tar.TypeSymlink
+	relPath, err := g.checkEntry(header)
+	if err != nil {
+		return "", err
+	}
+
+	if replacesLink && g.symlinks[relPath] {
+		if err := os.Remove(filepath.Join(destDir, relPath)); err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("删除已存在的符号链接失败 %s: %w", relPath, err)
+		}
+		delete(g.symlinks, relPath)
+	}
+
+	return relPath, nil
+}
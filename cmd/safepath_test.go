@@ -0,0 +1,288 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testTarEntry 测试用 tar 包中的一个条目
+type testTarEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	data     string
+}
+
+// testFile、testSymlink、testHardlink 构造对应类型的条目
+func testFile(name, data string) testTarEntry {
+	return testTarEntry{name: name, typeflag: tar.TypeReg, data: data}
+}
+func testSymlink(name, target string) testTarEntry {
+	return testTarEntry{name: name, typeflag: tar.TypeSymlink, linkname: target}
+}
+func testHardlink(name, target string) testTarEntry {
+	return testTarEntry{name: name, typeflag: tar.TypeLink, linkname: target}
+}
+
+// writeTestTar 将 entries 按顺序写入 tarPath
+func writeTestTar(t *testing.T, tarPath string, entries []testTarEntry) {
+	t.Helper()
+	file, err := os.Create(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	tw := tar.NewWriter(file)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Typeflag: e.typeflag, Linkname: e.linkname, Mode: 0644, Size: int64(len(e.data))}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// pathSafetyCase 一个恶意 tar 包用例
+type pathSafetyCase struct {
+	name    string
+	entries func(outside string) []testTarEntry
+	// untar 必须报告错误；为 false 时条目只是替换归档内的符号链接，允许正常解压
+	untarFails bool
+	// untar-multi 解压前的校验必须拒绝
+	multiRejects bool
+}
+
+// pathSafetyCases 恶意 tar 包语料：绝对路径、..、经过符号链接写入、越界硬链接，
+// 以及在写入协程处理排队文件之前创建同名符号链接的竞争
+var pathSafetyCases = []pathSafetyCase{
+	{
+		name: "绝对路径",
+		entries: func(outside string) []testTarEntry {
+			return []testTarEntry{testFile(filepath.Join(outside, "absolute.txt"), "pwned")}
+		},
+		untarFails:   true,
+		multiRejects: true,
+	},
+	{
+		name:         "..越过目标目录",
+		entries:      func(string) []testTarEntry { return []testTarEntry{testFile("../outside/dotdot.txt", "pwned")} },
+		untarFails:   true,
+		multiRejects: true,
+	},
+	{
+		name: "中间包含..",
+		entries: func(string) []testTarEntry {
+			return []testTarEntry{testFile("a/b/../../../outside/nested.txt", "pwned")}
+		},
+		untarFails:   true,
+		multiRejects: true,
+	},
+	{
+		name: "经过符号链接目录写入",
+		entries: func(outside string) []testTarEntry {
+			return []testTarEntry{testSymlink("link", outside), testFile("link/through-symlink.txt", "pwned")}
+		},
+		untarFails:   true,
+		multiRejects: true,
+	},
+	{
+		name: "先符号链接后同名文件",
+		entries: func(outside string) []testTarEntry {
+			return []testTarEntry{testSymlink("secret-link", filepath.Join(outside, "secret.txt")), testFile("secret-link", "pwned")}
+		},
+	},
+	{
+		name:         "硬链接指向外部",
+		entries:      func(string) []testTarEntry { return []testTarEntry{testHardlink("hard", "../outside/secret.txt")} },
+		untarFails:   true,
+		multiRejects: true,
+	},
+	{
+		name: "硬链接经过符号链接",
+		entries: func(outside string) []testTarEntry {
+			return []testTarEntry{testSymlink("link", outside), testHardlink("hard", "link/secret.txt")}
+		},
+		untarFails:   true,
+		multiRejects: true,
+	},
+	{
+		// 小文件还在队列中时，同名符号链接已经指向外部文件
+		name: "先文件后同名符号链接",
+		entries: func(outside string) []testTarEntry {
+			var entries []testTarEntry
+			for i := 0; i < 500; i++ {
+				name := fmt.Sprintf("x%d", i)
+				entries = append(entries, testFile(name, "pwned"), testSymlink(name, filepath.Join(outside, name)))
+			}
+			return entries
+		},
+	},
+	{
+		// 符号链接替换排队文件所在的目录
+		name: "符号链接替换排队文件的父目录",
+		entries: func(outside string) []testTarEntry {
+			var entries []testTarEntry
+			for i := 0; i < 200; i++ {
+				dir := fmt.Sprintf("d%d", i)
+				entries = append(entries, testFile(dir+"/y", "pwned"), testSymlink(dir, outside))
+			}
+			return entries
+		},
+		untarFails:   true,
+		multiRejects: true,
+	},
+	{
+		// 大文件、小文件和符号链接交替，largest-first 会重新排列队列中的文件
+		name: "大小文件与符号链接交替",
+		entries: func(outside string) []testTarEntry {
+			var entries []testTarEntry
+			for i := 0; i < 200; i++ {
+				name := fmt.Sprintf("m%d", i)
+				entries = append(entries,
+					testFile(fmt.Sprintf("big%d", i), string(make([]byte, 64*1024))),
+					testFile(name, "pwned"),
+					testSymlink(name, filepath.Join(outside, name)))
+			}
+			return entries
+		},
+	},
+}
+
+// setupOutside 创建目标目录之外的目录，放入一个不能被修改的文件
+func setupOutside(t *testing.T, root string) string {
+	t.Helper()
+	outside := filepath.Join(root, "outside")
+	if err := os.MkdirAll(outside, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return outside
+}
+
+// checkOutside 检查目标目录之外的目录没有被修改
+func checkOutside(t *testing.T, outside string) {
+	t.Helper()
+	names, err := os.ReadDir(outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range names {
+		if entry.Name() != "secret.txt" {
+			t.Errorf("在目标目录之外创建了 %s", filepath.Join(outside, entry.Name()))
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(outside, "secret.txt")); err != nil || string(data) != "secret" {
+		t.Errorf("目标目录之外的 secret.txt 被修改: %q, %v", data, err)
+	}
+}
+
+func TestUntarPathSafety(t *testing.T) {
+	for _, tc := range pathSafetyCases {
+		for _, concurrency := range []int{1, 2, 8} {
+			for _, order := range []string{orderManifest, orderLargestFirst} {
+				for _, atomicWrite := range []bool{false, true} {
+					name := fmt.Sprintf("%s/并发%d/%s/atomic=%v", tc.name, concurrency, order, atomicWrite)
+					t.Run(name, func(t *testing.T) {
+						root := t.TempDir()
+						outside := setupOutside(t, root)
+						tarPath := filepath.Join(root, "evil.tar")
+						writeTestTar(t, tarPath, tc.entries(outside))
+
+						destDir := filepath.Join(root, "dest")
+						if err := os.MkdirAll(destDir, 0755); err != nil {
+							t.Fatal(err)
+						}
+						_, err := extractTarParallel(tarPath, destDir, concurrency, compressAuto, 512*1024*1024, false, atomicWrite, nil, order)
+						if tc.untarFails && err == nil {
+							t.Errorf("没有报告错误")
+						}
+						checkOutside(t, outside)
+					})
+				}
+			}
+		}
+	}
+}
+
+func TestUntarMultiPathSafety(t *testing.T) {
+	for _, tc := range pathSafetyCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+			outside := setupOutside(t, root)
+			writeTestTar(t, filepath.Join(root, "part-0001.tar"), tc.entries(outside))
+
+			err := validateTarPaths(root, []string{"part-0001.tar"}, []string{compressNone})
+			if tc.multiRejects && err == nil {
+				t.Errorf("没有拒绝不安全的条目")
+			}
+			if !tc.multiRejects && err != nil {
+				t.Errorf("拒绝了安全的 tar 包: %v", err)
+			}
+		})
+	}
+
+	// 多个 tar 包并行解压时顺序不确定，另一个 tar 包中的同名符号链接可能先被创建
+	t.Run("不同tar包中的同名文件和符号链接", func(t *testing.T) {
+		root := t.TempDir()
+		outside := setupOutside(t, root)
+		writeTestTar(t, filepath.Join(root, "part-0001.tar"), []testTarEntry{testSymlink("x", filepath.Join(outside, "x"))})
+		writeTestTar(t, filepath.Join(root, "part-0002.tar"), []testTarEntry{testFile("x", "pwned")})
+		if err := validateTarPaths(root, []string{"part-0001.tar", "part-0002.tar"}, []string{compressNone, compressNone}); err == nil {
+			t.Errorf("没有拒绝不安全的条目")
+		}
+	})
+}
+
+func TestCreateOutputFileNoFollow(t *testing.T) {
+	for _, atomicWrite := range []bool{false, true} {
+		t.Run(fmt.Sprintf("atomic=%v", atomicWrite), func(t *testing.T) {
+			root := t.TempDir()
+			outside := setupOutside(t, root)
+			destDir := filepath.Join(root, "dest")
+			if err := os.MkdirAll(destDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			// 目标路径和临时文件路径上都已有指向外部的符号链接
+			target := filepath.Join(destDir, "file")
+			if err := os.Symlink(filepath.Join(outside, "secret.txt"), target); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Symlink(filepath.Join(outside, "temp"), atomicTempPath(target)); err != nil {
+				t.Fatal(err)
+			}
+
+			out, err := createOutputFile(target, 0644, atomicWrite)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := out.Write([]byte("new")); err != nil {
+				t.Fatal(err)
+			}
+			if err := out.commit(nil); err != nil {
+				t.Fatal(err)
+			}
+
+			checkOutside(t, outside)
+			info, err := os.Lstat(target)
+			if err != nil || !info.Mode().IsRegular() {
+				t.Fatalf("目标路径应替换为普通文件: %v, %v", info, err)
+			}
+			if data, _ := os.ReadFile(target); string(data) != "new" {
+				t.Errorf("目标文件内容为 %q", data)
+			}
+		})
+	}
+}
@@ -0,0 +1,527 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/spf13/cobra"
+)
+
+// 符号链接的处理方式（--symlinks）
+const (
+	symlinksFollow   = "follow"   // 跟随符号链接，按链接目标记录（默认）
+	symlinksPreserve = "preserve" // 按符号链接本身记录，复制和打包时保留为链接
+	symlinksSkip     = "skip"     // 跳过符号链接
+)
+
+// scanJob 一个待扫描的目录
+type scanJob struct {
+	realPath string         // 目录的真实路径（已解析符号链接）
+	relPath  string         // 目录相对扫描根目录的路径（根目录为空字符串）
+	ignore   *ignoreMatcher // 适用于该目录的忽略规则（不含该目录自身的忽略文件）
+	info     os.FileInfo    // 符号链接指向的目录的信息，IncludeDirs 时用于记录目录条目
+}
+
+// scanWorker 扫描协程的本地状态
+// jobs 是本地双端队列：自己从尾部取（深度优先，局部性好），其他协程从头部偷取（偷到的通常是较大的子树）
+type scanWorker struct {
+	mu          sync.Mutex
+	jobs        []*scanJob
+	entries     []ManifestEntry     // 该协程收集到的条目，最后统一排序合并
+	links       []hardlinkCandidate // 链接数大于 1 的文件，排序后用于识别硬链接
+	symlinkDirs []*scanJob          // 指向目录的符号链接，本轮扫描结束后按路径顺序处理
+}
+
+// popBottom 从本地队列尾部取出任务
+func (w *scanWorker) popBottom() *scanJob {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := len(w.jobs)
+	if n == 0 {
+		return nil
+	}
+	job := w.jobs[n-1]
+	w.jobs[n-1] = nil
+	w.jobs = w.jobs[:n-1]
+	return job
+}
+
+// stealTop 从队列头部偷取任务
+func (w *scanWorker) stealTop() *scanJob {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.jobs) == 0 {
+		return nil
+	}
+	job := w.jobs[0]
+	w.jobs[0] = nil
+	w.jobs = w.jobs[1:]
+	return job
+}
+
+// errScanIncomplete 表示扫描时有目录无法读取，返回的条目列表缺少这些目录下的内容
+var errScanIncomplete = errors.New("目录扫描不完整")
+
+// scanIncompleteError 扫描时无法读取的目录及原因
+type scanIncompleteError struct {
+	errs []error
+}
+
+func (e *scanIncompleteError) Error() string {
+	return fmt.Sprintf("%v：%d 个目录无法读取（%v）", errScanIncomplete, len(e.errs), e.errs[0])
+}
+
+func (e *scanIncompleteError) Unwrap() error {
+	return errScanIncomplete
+}
+
+// warnScanIncomplete 扫描不完整时逐个输出无法读取的目录并返回 nil（条目列表仍可使用），其他错误原样返回
+func warnScanIncomplete(err error) error {
+	var incomplete *scanIncompleteError
+	if !errors.As(err, &incomplete) {
+		return err
+	}
+	for _, e := range incomplete.errs {
+		fmt.Fprintf(os.Stderr, "警告: %v\n", e)
+	}
+	return nil
+}
+
+// unreadableDirs 返回扫描不完整时无法读取的目录路径（相对于 dirPath），err 不是 *scanIncompleteError 时返回 nil
+func unreadableDirs(dirPath string, err error) []string {
+	var incomplete *scanIncompleteError
+	if !errors.As(err, &incomplete) {
+		return nil
+	}
+	paths := make([]string, 0, len(incomplete.errs))
+	for _, e := range incomplete.errs {
+		var pathErr *os.PathError
+		if !errors.As(e, &pathErr) {
+			paths = append(paths, e.Error())
+			continue
+		}
+		path := pathErr.Path
+		if rel, err := filepath.Rel(dirPath, path); err == nil {
+			path = filepath.ToSlash(rel)
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// dirScanner 基于工作窃取的并行目录扫描器
+type dirScanner struct {
+	opts    ManifestOptions
+	workers []*scanWorker
+
+	// 已遍历的目录真实路径，同一个目录经过多个符号链接到达时只遍历一次；不跟随符号链接时为 nil
+	visited *sync.Map
+
+	errMu sync.Mutex
+	errs  []error // 无法读取的目录
+
+	pending int64 // 已入队但尚未处理完的目录数，为 0 时扫描结束
+	queued  int64 // 队列中等待处理的目录数
+	idle    int64 // 正在等待任务的协程数
+
+	mu   sync.Mutex
+	cond *sync.Cond
+}
+
+// scanDirectory 并行扫描指定目录并收集文件条目列表（内部函数）
+// dirPath: 要扫描的目录路径（可以是相对路径或绝对路径）
+// opts: 扫描选项，opts.Filter 和忽略文件会在遍历时生效，opts.Concurrency 为扫描并发数
+// 返回文件条目列表（路径不带 ./ 前缀），按路径逐级排序，与并发数无关。
+// 有目录无法打开或读取时仍返回已扫描到的条目，同时返回 *scanIncompleteError（可用 errScanIncomplete 判断）；
+// 调用方可以继续使用条目列表，但不能据此认为列表之外的路径在目录中不存在。
+//
+// 符号链接按 opts.Symlinks 处理，默认跟随：指向文件的链接按文件记录，指向目录的链接会继续遍历，
+// 但每个真实目录只遍历一次（避免无限递归和重复的子树）。为了让结果与并发数无关，
+// 先扫描不经过符号链接的目录，再逐轮按路径顺序处理指向目录的链接，同一目标保留路径在前的链接。
+// 同一轮中链接的目标先于链接展开后的子目录登记，子目录已是其他链接的目标时不再重复遍历。
+// preserve 模式下链接本身记录为 l 条目，不会进入指向的目录；skip 模式下直接跳过。
+// 目录项的类型直接来自 ReadDir，只有普通文件和符号链接才需要额外的 stat。
+func scanDirectory(dirPath string, opts ManifestOptions) ([]ManifestEntry, error) {
+	// 获取目录的绝对路径
+	absDirPath, err := filepath.Abs(dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("无法获取目录绝对路径: %w", err)
+	}
+
+	// 解析根目录的符号链接
+	realRoot, err := filepath.EvalSymlinks(absDirPath)
+	if err != nil {
+		return nil, fmt.Errorf("扫描目录时出错: %w", err)
+	}
+
+	// 忽略文件（gitignore 语义），未配置时为 nil
+	rootIgnore, err := newIgnoreMatcher(absDirPath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+
+	s := &dirScanner{
+		opts:    opts,
+		workers: make([]*scanWorker, concurrency),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	for i := range s.workers {
+		s.workers[i] = &scanWorker{}
+	}
+	if opts.Symlinks != symlinksPreserve && opts.Symlinks != symlinksSkip {
+		s.visited = &sync.Map{}
+		s.visited.Store(realRoot, struct{}{})
+	}
+
+	// 根目录作为第一个任务
+	s.push(s.workers[0], &scanJob{
+		realPath: realRoot,
+		ignore:   rootIgnore,
+	})
+
+	for {
+		// 启动扫描协程，队列为空时本轮结束
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func(id int) {
+				defer wg.Done()
+				s.run(id)
+			}(i)
+		}
+		wg.Wait()
+
+		if !s.pushSymlinkDirs() {
+			break
+		}
+	}
+
+	// 合并各协程的结果并排序，保证输出稳定
+	total := 0
+	for _, w := range s.workers {
+		total += len(w.entries)
+	}
+	fileList := make([]ManifestEntry, 0, total)
+	for _, w := range s.workers {
+		fileList = append(fileList, w.entries...)
+	}
+	sort.Slice(fileList, func(i, j int) bool {
+		return lessPathComponents(fileList[i].Path, fileList[j].Path)
+	})
+
+	// 指向同一 inode 的文件：排序后第一个路径保留为普通文件，其余记录为硬链接
+	var links []hardlinkCandidate
+	for _, w := range s.workers {
+		links = append(links, w.links...)
+	}
+	markHardlinks(fileList, links)
+
+	if len(s.errs) > 0 {
+		return fileList, &scanIncompleteError{errs: s.errs}
+	}
+	return fileList, nil
+}
+
+// recordError 记录无法读取的目录，扫描过程中被删除的目录不算错误
+func (s *dirScanner) recordError(err error) {
+	if os.IsNotExist(err) {
+		return
+	}
+	s.errMu.Lock()
+	s.errs = append(s.errs, fmt.Errorf("无法读取目录: %w", err))
+	s.errMu.Unlock()
+}
+
+// pushSymlinkDirs 按路径顺序处理本轮遇到的指向目录的符号链接：目标目录尚未遍历的加入队列，
+// 已经遍历过的跳过。没有新的目录需要扫描时返回 false
+func (s *dirScanner) pushSymlinkDirs() bool {
+	var jobs []*scanJob
+	for _, w := range s.workers {
+		jobs = append(jobs, w.symlinkDirs...)
+		w.symlinkDirs = nil
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return lessPathComponents(jobs[i].relPath, jobs[j].relPath)
+	})
+
+	pushed := 0
+	for _, job := range jobs {
+		if _, loaded := s.visited.LoadOrStore(job.realPath, struct{}{}); loaded {
+			continue
+		}
+		w := s.workers[pushed%len(s.workers)]
+		if s.opts.IncludeDirs {
+			w.entries = append(w.entries, newManifestEntry(job.relPath, job.info))
+		}
+		s.push(w, job)
+		pushed++
+	}
+	return pushed > 0
+}
+
+// push 将目录加入协程的本地队列，并唤醒一个空闲协程
+func (s *dirScanner) push(w *scanWorker, job *scanJob) {
+	atomic.AddInt64(&s.pending, 1)
+
+	w.mu.Lock()
+	w.jobs = append(w.jobs, job)
+	w.mu.Unlock()
+
+	atomic.AddInt64(&s.queued, 1)
+	if atomic.LoadInt64(&s.idle) > 0 {
+		s.mu.Lock()
+		s.cond.Signal()
+		s.mu.Unlock()
+	}
+}
+
+// run 扫描协程主循环：优先处理本地队列，空了就从其他协程偷取，都没有任务时等待
+func (s *dirScanner) run(id int) {
+	w := s.workers[id]
+	for {
+		job := w.popBottom()
+		if job == nil {
+			job = s.steal(id)
+		}
+		if job == nil {
+			if !s.waitForWork() {
+				return
+			}
+			continue
+		}
+		atomic.AddInt64(&s.queued, -1)
+
+		s.scanDir(w, job)
+
+		// 最后一个目录处理完，唤醒所有等待的协程退出
+		if atomic.AddInt64(&s.pending, -1) == 0 {
+			s.mu.Lock()
+			s.cond.Broadcast()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// steal 依次尝试从其他协程的队列头部偷取任务
+func (s *dirScanner) steal(id int) *scanJob {
+	n := len(s.workers)
+	for i := 1; i < n; i++ {
+		if job := s.workers[(id+i)%n].stealTop(); job != nil {
+			return job
+		}
+	}
+	return nil
+}
+
+// waitForWork 等待新任务入队，扫描已经结束时返回 false
+func (s *dirScanner) waitForWork() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 先登记为空闲再检查队列，保证 push 一定能看到空闲协程并发出信号
+	atomic.AddInt64(&s.idle, 1)
+	for atomic.LoadInt64(&s.queued) == 0 && atomic.LoadInt64(&s.pending) > 0 {
+		s.cond.Wait()
+	}
+	atomic.AddInt64(&s.idle, -1)
+
+	return atomic.LoadInt64(&s.pending) > 0
+}
+
+// scanDir 读取一个目录：文件记录到协程的结果中，子目录加入本地队列
+func (s *dirScanner) scanDir(w *scanWorker, job *scanJob) {
+	dir, err := os.Open(job.realPath)
+	if err != nil {
+		// 无法打开目录（如权限问题）：跳过并记录，扫描结果不完整
+		s.recordError(err)
+		return
+	}
+	// 不需要 os.ReadDir 的排序，最后会统一排序；读取出错时仍处理已读到的部分
+	entries, err := dir.ReadDir(-1)
+	dir.Close()
+	if err != nil {
+		s.recordError(err)
+	}
+
+	// 读取当前目录中的忽略文件，作用于其下的所有路径
+	ignore := job.ignore.enterDir(job.realPath, job.relPath)
+
+	for _, entry := range entries {
+		name := entry.Name()
+		relPath := name
+		if job.relPath != "" {
+			relPath = job.relPath + "/" + name
+		}
+		fullPath := filepath.Join(job.realPath, name)
+
+		var info os.FileInfo
+		childRealPath := fullPath
+		isDir := entry.IsDir()
+		isSymlink := entry.Type()&os.ModeSymlink != 0
+
+		if isSymlink && s.opts.Symlinks == symlinksSkip {
+			continue
+		}
+
+		// 跟随符号链接（preserve 模式下按链接本身处理，与 git 一样视为文件）
+		if isSymlink && s.opts.Symlinks != symlinksPreserve {
+			info, err = os.Stat(fullPath)
+			if err != nil {
+				// 断开的符号链接，跳过
+				continue
+			}
+			isDir = info.IsDir()
+			if isDir {
+				childRealPath, err = filepath.EvalSymlinks(fullPath)
+				if err != nil {
+					continue
+				}
+			}
+		}
+
+		// 应用过滤规则和忽略文件：被排除或忽略的目录直接跳过整个子树
+		if ignore.ignored(relPath, isDir) {
+			continue
+		}
+
+		if isDir {
+			if s.opts.Filter.excludesDir(relPath) {
+				continue
+			}
+			childJob := &scanJob{realPath: childRealPath, relPath: relPath, ignore: ignore}
+			if isSymlink {
+				// 链接目标可能已经或将要经过其他路径遍历，本轮结束后统一按路径顺序决定
+				childJob.info = info
+				w.symlinkDirs = append(w.symlinkDirs, childJob)
+				continue
+			}
+			// 真实目录也可能是之前某个符号链接的目标（位于链接展开的子树中时），已遍历过则跳过
+			if s.visited != nil {
+				if _, loaded := s.visited.LoadOrStore(childRealPath, struct{}{}); loaded {
+					continue
+				}
+			}
+			if s.opts.IncludeDirs {
+				if info == nil {
+					if info, err = entry.Info(); err != nil {
+						continue
+					}
+				}
+				w.entries = append(w.entries, newManifestEntry(relPath, info))
+			}
+			s.push(w, childJob)
+			continue
+		}
+
+		if !s.opts.Filter.matchFile(relPath) {
+			continue
+		}
+
+		// 只有需要记录元数据的条目才 stat
+		if info == nil {
+			if info, err = entry.Info(); err != nil {
+				continue
+			}
+		}
+		manifestEntry := newManifestEntry(relPath, info)
+		if manifestEntry.Type == manifestTypeSymlink {
+			if manifestEntry.LinkTarget, err = os.Readlink(fullPath); err != nil {
+				continue
+			}
+		}
+		w.entries = append(w.entries, manifestEntry)
+
+		// 跟随符号链接得到的文件不参与硬链接识别，避免把多个指向同一文件的链接合并
+		if !isSymlink {
+			if id, ok := hardlinkID(info); ok {
+				w.links = append(w.links, hardlinkCandidate{path: relPath, id: id})
+			}
+		}
+	}
+}
+
+// applySymlinkMode 对直接从 manifest 读取的条目应用符号链接处理方式
+// skip 删除符号链接条目；follow 将符号链接条目替换为链接目标的文件信息（指向目录或无法访问的链接会被跳过）；
+// preserve 保持 manifest 中记录的类型不变
+func applySymlinkMode(dirPath string, fileList []ManifestEntry, mode string) []ManifestEntry {
+	if mode != symlinksSkip && mode != symlinksFollow {
+		return fileList
+	}
+
+	result := make([]ManifestEntry, 0, len(fileList))
+	for i := range fileList {
+		entry := fileList[i]
+		if entry.Type != manifestTypeSymlink {
+			result = append(result, entry)
+			continue
+		}
+		if mode == symlinksSkip {
+			continue
+		}
+
+		info, err := os.Stat(filepath.Join(dirPath, filepath.FromSlash(entry.Path)))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "警告: 无法跟随符号链接 %s: %v\n", entry.Path, err)
+			continue
+		}
+		if info.IsDir() {
+			fmt.Fprintf(os.Stderr, "警告: 跳过指向目录的符号链接 %s（请重新扫描目录以跟随）\n", entry.Path)
+			continue
+		}
+		result = append(result, newManifestEntry(entry.Path, info))
+	}
+	return result
+}
+
+// hasSymlinkEntries 判断条目列表中是否包含符号链接
+func hasSymlinkEntries(fileList []ManifestEntry) bool {
+	for i := range fileList {
+		if fileList[i].Type == manifestTypeSymlink {
+			return true
+		}
+	}
+	return false
+}
+
+// addSymlinksFlag 为命令添加 --symlinks 参数
+func addSymlinksFlag(cmd *cobra.Command) {
+	cmd.Flags().String("symlinks", symlinksFollow, "符号链接的处理方式：follow（跟随，按目标记录）、preserve（保留为链接）、skip（跳过）")
+}
+
+// lessPathComponents 按路径逐级比较，结果与逐个目录按名称排序后深度优先遍历的顺序一致
+// 例如 a/b 排在 a.b 之前（因为 a < a.b），而普通字符串比较会把 a.b 排在前面
+func lessPathComponents(a, b string) bool {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		ca, cb := a[i], b[i]
+		if ca == cb {
+			continue
+		}
+		if ca == '/' {
+			return true
+		}
+		if cb == '/' {
+			return false
+		}
+		return ca < cb
+	}
+	return len(a) < len(b)
+}
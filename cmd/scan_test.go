@@ -0,0 +1,60 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestScanFollowVisitsDirectoryOnce(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	ext := filepath.Join(root, "ext")
+	for _, dir := range []string{filepath.Join(src, "real", "sub"), filepath.Join(ext, "inner")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{filepath.Join(src, "real", "sub", "f"), filepath.Join(ext, "g"), filepath.Join(ext, "inner", "h")} {
+		if err := os.WriteFile(file, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"a-ext":         ext,                               // 两个同级链接指向树外的同一个目录
+		"b-ext":         ext,                               // 排序在后，跳过
+		"c-inner":       filepath.Join(ext, "inner"),       // 与 a-ext 同一轮处理，a-ext 展开后不再遍历 inner
+		"0-real":        filepath.Join(src, "real"),        // 目标是不经过链接的真实目录
+		"real/sub/loop": src,                               // 指向祖先目录
+		"z-sub":         filepath.Join(src, "real", "sub"), // 目标是真实目录的子目录
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(src, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"a-ext/g", "c-inner/h", "real/sub/f"}
+	for _, concurrency := range []int{1, 2, 8} {
+		t.Run(fmt.Sprintf("并发%d", concurrency), func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				fileList, err := scanDirectory(src, ManifestOptions{Concurrency: concurrency})
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got []string
+				for _, entry := range fileList {
+					got = append(got, entry.Path)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Fatalf("扫描结果为 %q，应为 %q", got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,330 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// seekable zstd 格式（facebook/zstd contrib/seekable_format）：
+// 数据由多个独立的 zstd 帧组成，末尾的 skippable 帧（seek table）记录每个帧压缩前后的大小，
+// 读取任意偏移时只需解压所在的帧。p-tool 在 seek table 之前再写入一个 skippable 帧（路径索引），
+// 记录每个条目在 tar 流中的偏移，extract-file 据此直接定位到文件。
+// 两个 skippable 帧都会被 zstd 命令和 untar 忽略，tar 包仍可正常解压
+const (
+	seekableMinFrameSize = 1024 * 1024 // 帧达到该大小后在下一个条目的边界切分，大文件仍按 compressFrameSize 切分
+	seekTableMagic       = 0x184D2A5E  // seek table 所在 skippable 帧的魔数
+	seekTableFooterMagic = 0x8F92EAB1  // seek table 结尾的魔数
+	seekTableFooterSize  = 9           // 帧数（4 字节）+ 描述符（1 字节）+ 魔数（4 字节）
+	seekTableChecksum    = 0x80        // 描述符中表示每个帧带有校验和的位
+	seekIndexMagic       = 0x184D2A50  // 路径索引所在 skippable 帧的魔数
+	seekIndexID          = "PTIX"      // 路径索引内容的开头，用于区分其他工具写入的 skippable 帧
+	seekIndexHeader      = "#p-tool-seek-index v1"
+	skippableHeaderSize  = 8 // skippable 帧的魔数和长度
+)
+
+// errNotSeekable 表示 tar 包不是带路径索引的 seekable 格式
+var errNotSeekable = errors.New("不是 seekable 格式的 tar 包")
+
+// seekFrame seek table 中的一个帧
+type seekFrame struct {
+	compressedOffset int64 // 帧在 tar 包文件中的偏移
+	rawOffset        int64 // 帧解压后在 tar 流中的偏移
+	compressedSize   uint32
+	rawSize          uint32
+}
+
+// seekIndexEntry 路径索引中的一个条目
+type seekIndexEntry struct {
+	path   string
+	offset int64 // 条目（包括 PAX 扩展头）在 tar 流中的偏移
+}
+
+// seekableWriter 写入 seekable zstd 格式：帧由 parallelWriter 并行压缩，
+// 调用方在每个条目开始前调用 addEntry 记录偏移，Close 时写入路径索引和 seek table
+type seekableWriter struct {
+	w       io.Writer
+	pw      *parallelWriter
+	opts    compressOptions
+	frames  []seekFrame // 由 parallelWriter 的写入协程按顺序追加，Close 之后才读取
+	entries []seekIndexEntry
+}
+
+// newSeekableWriter 创建写入 w 的 seekable zstd 压缩器
+func newSeekableWriter(w io.Writer, opts compressOptions) (*seekableWriter, error) {
+	encoder, err := zstd.NewWriter(nil, opts.zstdEncoderOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	s := &seekableWriter{w: w, opts: opts}
+	s.pw = newParallelWriter(w, opts.frameSize(), max(opts.threads, 1), func(dst, src []byte) ([]byte, error) {
+		return encoder.EncodeAll(src, dst), nil
+	})
+	s.pw.onClose = func() { encoder.Close() }
+	s.pw.onBlock = func(rawSize, compressedSize int) {
+		s.frames = append(s.frames, seekFrame{compressedSize: uint32(compressedSize), rawSize: uint32(rawSize)})
+	}
+	return s, nil
+}
+
+func (s *seekableWriter) Write(data []byte) (int, error) {
+	return s.pw.Write(data)
+}
+
+// addEntry 记录下一个条目的路径和在 tar 流中的偏移；当前帧已达到 seekableMinFrameSize 时在此处切分，
+// 使帧尽量以条目开头，提取单个文件时少解压无关的数据
+func (s *seekableWriter) addEntry(path string, offset int64) {
+	s.entries = append(s.entries, seekIndexEntry{path: path, offset: offset})
+	if s.pw.cur != nil && len(s.pw.cur.src) >= seekableMinFrameSize {
+		s.pw.submit()
+	}
+}
+
+// Close 写出剩余的帧，然后依次写入路径索引和 seek table
+func (s *seekableWriter) Close() error {
+	if err := s.pw.Close(); err != nil {
+		return err
+	}
+	index, err := s.encodeIndex()
+	if err != nil {
+		return err
+	}
+	if _, err := s.w.Write(index); err != nil {
+		return err
+	}
+	table, err := s.encodeSeekTable()
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write(table)
+	return err
+}
+
+// encodeIndex 生成路径索引帧：每行一个条目，"<偏移>\t<路径>"，路径的转义与 manifest 相同，整体以 zstd 压缩
+func (s *seekableWriter) encodeIndex() ([]byte, error) {
+	var text bytes.Buffer
+	text.WriteString(seekIndexHeader + "\n")
+	for _, entry := range s.entries {
+		fmt.Fprintf(&text, "%d\t%s\n", entry.offset, manifestPathEscaper.Replace(entry.path))
+	}
+
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(s.opts.level)), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	defer encoder.Close()
+	payload := encoder.EncodeAll(text.Bytes(), []byte(seekIndexID))
+	if int64(len(payload)) > math.MaxUint32 {
+		return nil, fmt.Errorf("路径索引过大（%s）", formatBytes(int64(len(payload))))
+	}
+
+	frame := make([]byte, skippableHeaderSize, skippableHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(frame[0:], seekIndexMagic)
+	binary.LittleEndian.PutUint32(frame[4:], uint32(len(payload)))
+	return append(frame, payload...), nil
+}
+
+// encodeSeekTable 生成 seek table 帧（不带校验和）
+func (s *seekableWriter) encodeSeekTable() ([]byte, error) {
+	if len(s.frames) > (math.MaxUint32-seekTableFooterSize)/8 {
+		return nil, fmt.Errorf("帧数过多（%d），无法写入 seek table", len(s.frames))
+	}
+	size := len(s.frames)*8 + seekTableFooterSize
+	table := make([]byte, skippableHeaderSize+size)
+	binary.LittleEndian.PutUint32(table[0:], seekTableMagic)
+	binary.LittleEndian.PutUint32(table[4:], uint32(size))
+	pos := skippableHeaderSize
+	for _, frame := range s.frames {
+		binary.LittleEndian.PutUint32(table[pos:], frame.compressedSize)
+		binary.LittleEndian.PutUint32(table[pos+4:], frame.rawSize)
+		pos += 8
+	}
+	binary.LittleEndian.PutUint32(table[pos:], uint32(len(s.frames)))
+	table[pos+4] = 0
+	binary.LittleEndian.PutUint32(table[pos+5:], seekTableFooterMagic)
+	return table, nil
+}
+
+// seekableArchive 打开的 seekable 格式 tar 包，frames 按偏移排序
+type seekableArchive struct {
+	file    *os.File
+	frames  []seekFrame
+	offsets map[string]int64 // 条目路径 → 在 tar 流中的偏移
+	decoder *zstd.Decoder
+}
+
+// openSeekableArchive 读取 file 末尾的 seek table 和路径索引
+// 文件不是 seekable 格式或没有 p-tool 写入的路径索引时返回 errNotSeekable
+func openSeekableArchive(file *os.File) (*seekableArchive, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	fileSize := info.Size()
+	if fileSize < skippableHeaderSize+seekTableFooterSize {
+		return nil, errNotSeekable
+	}
+
+	// seek table 结尾：帧数、描述符、魔数
+	footer := make([]byte, seekTableFooterSize)
+	if _, err := file.ReadAt(footer, fileSize-seekTableFooterSize); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(footer[5:]) != seekTableFooterMagic {
+		return nil, errNotSeekable
+	}
+	frameCount := int64(binary.LittleEndian.Uint32(footer[0:]))
+	entrySize := int64(8)
+	if footer[4]&seekTableChecksum != 0 {
+		entrySize = 12
+	}
+	tableSize := frameCount*entrySize + seekTableFooterSize
+	tableStart := fileSize - skippableHeaderSize - tableSize
+	if tableStart < 0 {
+		return nil, fmt.Errorf("%w：seek table 大小超出文件范围", errNotSeekable)
+	}
+
+	table := make([]byte, skippableHeaderSize+tableSize-seekTableFooterSize)
+	if _, err := file.ReadAt(table, tableStart); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(table[0:]) != seekTableMagic || int64(binary.LittleEndian.Uint32(table[4:])) != tableSize {
+		return nil, fmt.Errorf("%w：seek table 已损坏", errNotSeekable)
+	}
+
+	archive := &seekableArchive{file: file, frames: make([]seekFrame, frameCount)}
+	var compressedOffset, rawOffset int64
+	for i := range archive.frames {
+		entry := table[skippableHeaderSize+int64(i)*entrySize:]
+		frame := seekFrame{
+			compressedOffset: compressedOffset,
+			rawOffset:        rawOffset,
+			compressedSize:   binary.LittleEndian.Uint32(entry[0:]),
+			rawSize:          binary.LittleEndian.Uint32(entry[4:]),
+		}
+		archive.frames[i] = frame
+		compressedOffset += int64(frame.compressedSize)
+		rawOffset += int64(frame.rawSize)
+	}
+
+	// 路径索引紧跟在最后一个数据帧之后，占满到 seek table 之前
+	indexSize := tableStart - compressedOffset - skippableHeaderSize
+	if indexSize < int64(len(seekIndexID)) {
+		return nil, fmt.Errorf("%w：缺少路径索引", errNotSeekable)
+	}
+	index := make([]byte, skippableHeaderSize+indexSize)
+	if _, err := file.ReadAt(index, compressedOffset); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(index[0:]) != seekIndexMagic || int64(binary.LittleEndian.Uint32(index[4:])) != indexSize ||
+		!bytes.HasPrefix(index[skippableHeaderSize:], []byte(seekIndexID)) {
+		return nil, fmt.Errorf("%w：缺少路径索引", errNotSeekable)
+	}
+
+	archive.decoder, err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, fmt.Errorf("创建 zstd 解码器失败: %w", err)
+	}
+	text, err := archive.decoder.DecodeAll(index[skippableHeaderSize+len(seekIndexID):], nil)
+	if err != nil {
+		archive.decoder.Close()
+		return nil, fmt.Errorf("解压路径索引失败: %w", err)
+	}
+	if archive.offsets, err = parseSeekIndex(text); err != nil {
+		archive.decoder.Close()
+		return nil, err
+	}
+	return archive, nil
+}
+
+// parseSeekIndex 解析路径索引的文本内容
+func parseSeekIndex(text []byte) (map[string]int64, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(text))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	if !scanner.Scan() || scanner.Text() != seekIndexHeader {
+		return nil, fmt.Errorf("无法识别的路径索引格式")
+	}
+	offsets := make(map[string]int64)
+	for lineNum := 2; scanner.Scan(); lineNum++ {
+		offsetStr, path, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok {
+			return nil, fmt.Errorf("路径索引第 %d 行格式错误", lineNum)
+		}
+		offset, err := strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("路径索引第 %d 行偏移无效: %w", lineNum, err)
+		}
+		offsets[manifestPathUnescaper.Replace(path)] = offset
+	}
+	return offsets, scanner.Err()
+}
+
+// Close 释放解码器（不关闭文件）
+func (a *seekableArchive) Close() {
+	a.decoder.Close()
+}
+
+// readerAt 返回从 tar 流偏移 offset 开始顺序读取的 reader，只解压 offset 所在及之后的帧
+func (a *seekableArchive) readerAt(offset int64) (io.Reader, error) {
+	i := sort.Search(len(a.frames), func(i int) bool {
+		return a.frames[i].rawOffset+int64(a.frames[i].rawSize) > offset
+	})
+	if i == len(a.frames) {
+		return nil, fmt.Errorf("偏移 %d 超出 tar 流范围", offset)
+	}
+	return &seekableReader{archive: a, next: i, skip: offset - a.frames[i].rawOffset}, nil
+}
+
+// seekableReader 按顺序逐帧解压
+type seekableReader struct {
+	archive *seekableArchive
+	next    int   // 下一个要解压的帧
+	skip    int64 // 第一个帧中需要跳过的字节数
+	src     []byte
+	data    []byte
+	buf     []byte // 当前帧中尚未读取的数据
+}
+
+func (r *seekableReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.next >= len(r.archive.frames) {
+			return 0, io.EOF
+		}
+		frame := r.archive.frames[r.next]
+		r.next++
+
+		if cap(r.src) < int(frame.compressedSize) {
+			r.src = make([]byte, frame.compressedSize)
+		}
+		r.src = r.src[:frame.compressedSize]
+		if _, err := r.archive.file.ReadAt(r.src, frame.compressedOffset); err != nil {
+			return 0, fmt.Errorf("读取第 %d 个帧失败: %w", r.next, err)
+		}
+		data, err := r.archive.decoder.DecodeAll(r.src, r.data[:0])
+		if err != nil {
+			return 0, fmt.Errorf("解压第 %d 个帧失败: %w", r.next, err)
+		}
+		if len(data) != int(frame.rawSize) {
+			return 0, fmt.Errorf("第 %d 个帧解压后的大小与 seek table 不一致", r.next)
+		}
+		r.data = data
+		r.buf = data[r.skip:]
+		r.skip = 0
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
@@ -0,0 +1,279 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+)
+
+// tarBlockSize tar 格式的块大小
+const tarBlockSize = 512
+
+// sparseBlockSize 解压稀疏文件时按该粒度检测全零数据并跳过，与常见文件系统的块大小一致
+const sparseBlockSize = 4096
+
+// sparseSegment 稀疏文件中的一段数据区域 [offset, offset+length)
+type sparseSegment struct {
+	offset int64
+	length int64
+}
+
+// copySparseFile 只复制源文件的数据区域，空洞部分在目标文件中跳过，最后截断到源文件大小
+// 目标文件必须是新创建（已截断）的文件，跳过的区域才会成为空洞
+func copySparseFile(dst, src *os.File, size int64, segments []sparseSegment) error {
+	for _, seg := range segments {
+		if err := copyFileExtent(dst, src, seg.offset, seg.length); err != nil {
+			return err
+		}
+	}
+	return dst.Truncate(size)
+}
+
+// copyFileExtent 使用 pread/pwrite 复制 [offset, offset+length) 范围
+func copyFileExtent(dst, src *os.File, offset, length int64) error {
+	buf := bufferPool.Get().([]byte)
+	defer bufferPool.Put(buf)
+
+	n, err := io.CopyBuffer(io.NewOffsetWriter(dst, offset), io.NewSectionReader(src, offset, length), buf)
+	if err != nil {
+		return err
+	}
+	if n != length {
+		return fmt.Errorf("源文件大小在复制过程中发生变化")
+	}
+	return nil
+}
+
+// isSparseHeader 判断 tar 条目是否是稀疏文件（旧 GNU 格式或 PAX 0.x / 1.0 格式）
+// archive/tar 读取时会把空洞展开为全零数据
+func isSparseHeader(header *tar.Header) bool {
+	if header.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for _, key := range []string{"GNU.sparse.major", "GNU.sparse.map", "GNU.sparse.numblocks"} {
+		if header.PAXRecords[key] != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// sparseWriter 顺序写入文件，跳过对齐的全零块而不是写入，在目标文件中重新形成空洞
+// 写入完成后必须调用 finish 将文件扩展到最终大小
+type sparseWriter struct {
+	f   *os.File
+	off int64
+}
+
+func (w *sparseWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := sparseBlockSize - int(w.off%sparseBlockSize)
+		if n > len(p) {
+			n = len(p)
+		}
+		if !isZeroBlock(p[:n]) {
+			if _, err := w.f.WriteAt(p[:n], w.off); err != nil {
+				return written, err
+			}
+		}
+		w.off += int64(n)
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// finish 将文件截断（扩展）到已写入的大小，保留末尾的空洞
+func (w *sparseWriter) finish() error {
+	return w.f.Truncate(w.off)
+}
+
+// isZeroBlock 判断数据是否全部为零
+func isZeroBlock(p []byte) bool {
+	for _, b := range p {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// writeSparseFileToTar 以 PAX 1.0 稀疏格式（GNU tar 兼容）将文件写入 tar 包，空洞不占用 tar 包空间
+// archive/tar 的 Writer 不支持写入稀疏条目，因此 header 和数据直接写入 tar 包底层的 w，
+// 写入前先 Flush tarWriter 补齐上一个条目的填充
+// 返回文件的实际大小（包括空洞）
+func writeSparseFileToTar(tarWriter *tar.Writer, w io.Writer, header *tar.Header, file *os.File, segments []sparseSegment) (int64, error) {
+	realSize := header.Size
+
+	// 稀疏映射：段数，然后每段的偏移和长度，各占一行，填充到块大小
+	// 文件以空洞结尾时与 GNU tar 一样追加一个位于文件末尾的空数据段
+	if len(segments) == 0 || segments[len(segments)-1].offset+segments[len(segments)-1].length < realSize {
+		segments = append(segments, sparseSegment{offset: realSize})
+	}
+	var sparseMap bytes.Buffer
+	fmt.Fprintf(&sparseMap, "%d\n", len(segments))
+	var dataSize int64
+	for _, seg := range segments {
+		fmt.Fprintf(&sparseMap, "%d\n%d\n", seg.offset, seg.length)
+		dataSize += seg.length
+	}
+	sparseMap.Write(make([]byte, blockPadding(int64(sparseMap.Len()))))
+
+	if err := tarWriter.Flush(); err != nil {
+		return 0, fmt.Errorf("写入 tar header 失败: %w", err)
+	}
+	if _, err := w.Write(formatSparseHeader(header, int64(sparseMap.Len())+dataSize)); err != nil {
+		return 0, fmt.Errorf("写入 tar header 失败: %w", err)
+	}
+	if _, err := w.Write(sparseMap.Bytes()); err != nil {
+		return 0, fmt.Errorf("写入稀疏映射失败: %w", err)
+	}
+
+	bufPtr := tarBufferPool.Get().(*[]byte)
+	defer tarBufferPool.Put(bufPtr)
+	for _, seg := range segments {
+		n, err := io.CopyBuffer(w, io.NewSectionReader(file, seg.offset, seg.length), *bufPtr)
+		if err != nil {
+			return 0, fmt.Errorf("流式写入文件内容失败: %w", err)
+		}
+		if n != seg.length {
+			// 已写入的 header 声明了数据长度，无法再修正
+			return 0, fmt.Errorf("源文件大小在打包过程中发生变化")
+		}
+	}
+	if _, err := w.Write(make([]byte, blockPadding(dataSize))); err != nil {
+		return 0, fmt.Errorf("流式写入文件内容失败: %w", err)
+	}
+	return realSize, nil
+}
+
+// formatSparseHeader 生成稀疏条目的 PAX 扩展头和 ustar 头，size 为条目数据区（稀疏映射 + 数据段）的大小
+// 真实路径和大小记录在 GNU.sparse.name / GNU.sparse.realsize 中，ustar 头的路径按 GNU tar 的约定使用 GNUSparseFile.0/<文件名>
+func formatSparseHeader(header *tar.Header, size int64) []byte {
+	records := map[string]string{
+		"GNU.sparse.major":    "1",
+		"GNU.sparse.minor":    "0",
+		"GNU.sparse.name":     header.Name,
+		"GNU.sparse.realsize": strconv.FormatInt(header.Size, 10),
+	}
+
+	// 超出 ustar 字段范围的值记录在 PAX 扩展头中，ustar 头中写 0
+	fields := []struct {
+		key   string
+		value int64
+		width int
+	}{
+		{"uid", int64(header.Uid), 8},
+		{"gid", int64(header.Gid), 8},
+		{"size", size, 12},
+		{"mtime", header.ModTime.Unix(), 12},
+	}
+	values := make(map[string]int64)
+	for _, f := range fields {
+		if fitsOctal(f.value, f.width) {
+			values[f.key] = f.value
+		} else {
+			records[f.key] = strconv.FormatInt(f.value, 10)
+		}
+	}
+	uname, gname := header.Uname, header.Gname
+	if len(uname) > 32 {
+		records["uname"] = uname
+		uname = ""
+	}
+	if len(gname) > 32 {
+		records["gname"] = gname
+		gname = ""
+	}
+
+	keys := make([]string, 0, len(records))
+	for k := range records {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pax bytes.Buffer
+	for _, k := range keys {
+		pax.WriteString(formatPAXRecord(k, records[k]))
+	}
+
+	base := path.Base(header.Name)
+	var out bytes.Buffer
+	out.Write(formatUstarBlock(truncateName("PaxHeaders.0/"+base), 0644, 0, 0, int64(pax.Len()), values["mtime"], tar.TypeXHeader, "", ""))
+	out.Write(pax.Bytes())
+	out.Write(make([]byte, blockPadding(int64(pax.Len()))))
+	out.Write(formatUstarBlock(truncateName("GNUSparseFile.0/"+base), header.Mode&07777, values["uid"], values["gid"], values["size"], values["mtime"], tar.TypeReg, uname, gname))
+	return out.Bytes()
+}
+
+// formatPAXRecord 生成一条 PAX 记录："<长度> <键>=<值>\n"，长度包含长度字段本身
+func formatPAXRecord(key, value string) string {
+	size := len(key) + len(value) + 3 // ' '、'=' 和 '\n'
+	size += len(strconv.Itoa(size))
+	record := strconv.Itoa(size) + " " + key + "=" + value + "\n"
+	if len(record) != size {
+		// 长度字段本身变长（如 99 -> 100）
+		size = len(record)
+		record = strconv.Itoa(size) + " " + key + "=" + value + "\n"
+	}
+	return record
+}
+
+// formatUstarBlock 生成一个 ustar 格式的 header 块
+func formatUstarBlock(name string, mode, uid, gid, size, mtime int64, typeflag byte, uname, gname string) []byte {
+	block := make([]byte, tarBlockSize)
+	copy(block[0:100], name)
+	putOctal(block[100:108], mode)
+	putOctal(block[108:116], uid)
+	putOctal(block[116:124], gid)
+	putOctal(block[124:136], size)
+	putOctal(block[136:148], mtime)
+	block[156] = typeflag
+	copy(block[257:263], "ustar\x00")
+	copy(block[263:265], "00")
+	copy(block[265:297], uname)
+	copy(block[297:329], gname)
+	putOctal(block[329:337], 0)
+	putOctal(block[337:345], 0)
+
+	// 校验和按校验和字段全为空格计算
+	copy(block[148:156], "        ")
+	var sum int64
+	for _, b := range block {
+		sum += int64(b)
+	}
+	copy(block[148:156], fmt.Sprintf("%06o\x00 ", sum))
+	return block
+}
+
+// putOctal 以补零的八进制数字填充字段，最后一个字节为 NUL
+func putOctal(field []byte, v int64) {
+	copy(field, fmt.Sprintf("%0*o", len(field)-1, v))
+	field[len(field)-1] = 0
+}
+
+// fitsOctal 判断 v 能否写入宽度为 width 的八进制字段（保留一个字节的 NUL）
+func fitsOctal(v int64, width int) bool {
+	return v >= 0 && v < int64(1)<<(3*(width-1))
+}
+
+// truncateName 将路径截断到 ustar name 字段的长度（真实路径由 PAX 记录提供）
+func truncateName(name string) string {
+	if len(name) > 100 {
+		return name[:100]
+	}
+	return name
+}
+
+// blockPadding 返回将 n 字节补齐到 tar 块大小所需的填充字节数
+func blockPadding(n int64) int64 {
+	return -n & (tarBlockSize - 1)
+}
@@ -0,0 +1,56 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// isSparseFile 根据已分配的块数判断文件是否包含空洞（分配的空间小于文件大小）
+func isSparseFile(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || !info.Mode().IsRegular() {
+		return false
+	}
+	return stat.Blocks*512 < info.Size()
+}
+
+// dataSegments 使用 SEEK_DATA / SEEK_HOLE 找出 [offset, end) 范围内的数据区域，范围内其余部分都是空洞
+// 文件系统不支持时返回的错误满足 errors.Is(err, errors.ErrUnsupported)
+func dataSegments(f *os.File, offset, end int64) ([]sparseSegment, error) {
+	fd := int(f.Fd())
+	var segments []sparseSegment
+	for off := offset; off < end; {
+		data, err := unix.Seek(fd, off, unix.SEEK_DATA)
+		if err == unix.ENXIO {
+			// off 之后没有数据，剩余部分都是空洞
+			break
+		}
+		if err != nil {
+			if off == offset && (err == unix.EINVAL || err == unix.EOPNOTSUPP) {
+				return nil, fmt.Errorf("%w: %v", errors.ErrUnsupported, err)
+			}
+			return nil, err
+		}
+		if data >= end {
+			break
+		}
+
+		hole, err := unix.Seek(fd, data, unix.SEEK_HOLE)
+		if err != nil {
+			return nil, err
+		}
+		if hole > end {
+			hole = end
+		}
+		segments = append(segments, sparseSegment{offset: data, length: hole - data})
+		off = hole
+	}
+	return segments, nil
+}
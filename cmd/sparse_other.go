@@ -0,0 +1,21 @@
+//go:build !linux
+
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"os"
+)
+
+// isSparseFile 在非 Linux 平台上不识别稀疏文件
+func isSparseFile(info os.FileInfo) bool {
+	return false
+}
+
+// dataSegments 在非 Linux 平台上不支持 SEEK_DATA / SEEK_HOLE
+func dataSegments(f *os.File, offset, end int64) ([]sparseSegment, error) {
+	return nil, errors.ErrUnsupported
+}
@@ -0,0 +1,223 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// syncCmd represents the sync command
+var syncCmd = &cobra.Command{
+	Use:   "sync <源目录> <目标目录>",
+	Short: "增量同步目录（只复制有变化的文件）",
+	Long: `将源目录增量同步到目标目录，等同于 p-tool cp --update。
+
+对比规则：
+- 普通文件：目标文件大小和修改时间都与源文件一致时跳过
+- 指定 --checksum 时，大小一致的文件改为比较内容校验和（不再比较修改时间）；
+  manifest 中已记录相同算法的校验和时直接使用，不再重新计算源文件
+- 符号链接：目标是指向相同位置的符号链接时跳过
+- 硬链接：目标已经是对应文件的硬链接时跳过
+
+同步时会自动保留修改时间（--preserve timestamps），保证下次同步时能正确比较。
+使用 --delete 时目标目录会成为源目录的精确镜像，其余参数与 cp 命令相同。
+
+示例：
+  p-tool sync /source /dest
+  p-tool sync /source /dest --checksum xxh3
+  p-tool sync /source /dest --manifest-file /tmp/manifest.txt
+  p-tool sync /source /dest -a --exclude '*.tmp'
+  p-tool sync /source /dest --delete`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		runCopy(cmd, args, true)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+
+	addCopyFlags(syncCmd)
+}
+
+// selectChangedEntries 并行对比源目录和目标目录，返回需要复制的条目
+// checksumAlgo 不为空时，大小一致的文件比较内容校验和；manifestAlgo 为 manifest 中记录校验和所用的算法
+func selectChangedEntries(sourceDir, destDir string, fileList []ManifestEntry, checksumAlgo, manifestAlgo string, concurrency int) []ManifestEntry {
+	totalFiles := int64(len(fileList))
+	var checkedFiles int64
+	var checkedBytes int64
+	totalBytes := manifestTotalSize(fileList)
+
+	startTime := time.Now()
+
+	changed := make([]bool, len(fileList))
+	taskChan := make(chan int, concurrency*2)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	// 启动进度更新协程
+	progressDone := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				updateProgress(atomic.LoadInt64(&checkedFiles), totalFiles, atomic.LoadInt64(&checkedBytes), totalBytes, startTime)
+			case <-progressDone:
+				return
+			}
+		}
+	}()
+
+	// 启动工作协程（每个协程只写自己负责的下标，无需加锁）
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range taskChan {
+				entry := &fileList[index]
+				same, err := entryUpToDate(sourceDir, destDir, entry, checksumAlgo, manifestAlgo)
+				if err != nil {
+					// 无法比较时按有变化处理，复制时会报告真正的错误
+					mu.Lock()
+					fmt.Fprintf(os.Stderr, "\n警告: 无法比较 %s: %v\n", entry.Path, err)
+					mu.Unlock()
+				}
+				changed[index] = !same
+				if entry.hasMetadata() {
+					atomic.AddInt64(&checkedBytes, entry.Size)
+				}
+				atomic.AddInt64(&checkedFiles, 1)
+			}
+		}()
+	}
+
+	// 发送任务
+	for i := range fileList {
+		taskChan <- i
+	}
+	close(taskChan)
+
+	// 等待所有协程完成
+	wg.Wait()
+
+	// 停止进度更新协程
+	close(progressDone)
+	time.Sleep(120 * time.Millisecond)
+
+	// 显示最终进度
+	updateProgress(atomic.LoadInt64(&checkedFiles), totalFiles, atomic.LoadInt64(&checkedBytes), totalBytes, startTime)
+	fmt.Fprintf(os.Stdout, "\n")
+
+	// 硬链接的目标文件需要重新复制时，硬链接也需要重新创建（--atomic 会把目标文件替换为新的 inode）
+	changedFiles := make(map[string]bool)
+	for i := range fileList {
+		if changed[i] && fileList[i].Type == manifestTypeFile {
+			changedFiles[fileList[i].Path] = true
+		}
+	}
+	for i := range fileList {
+		if fileList[i].Type == manifestTypeHardlink && changedFiles[fileList[i].LinkTarget] {
+			changed[i] = true
+		}
+	}
+
+	// 保持 manifest 中的顺序
+	result := make([]ManifestEntry, 0)
+	for i := range fileList {
+		if changed[i] {
+			result = append(result, fileList[i])
+		}
+	}
+	return result
+}
+
+// entryUpToDate 判断目标目录中的条目是否已与源目录一致
+// 目标不存在时返回 false 且不报错
+func entryUpToDate(sourceDir, destDir string, entry *ManifestEntry, checksumAlgo, manifestAlgo string) (bool, error) {
+	destPath := filepath.Join(destDir, entry.Path)
+	destInfo, err := os.Lstat(destPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	switch entry.Type {
+	case manifestTypeDir:
+		return destInfo.IsDir(), nil
+	case manifestTypeSymlink:
+		if destInfo.Mode()&os.ModeSymlink == 0 {
+			return false, nil
+		}
+		target, err := os.Readlink(destPath)
+		if err != nil {
+			return false, err
+		}
+		return target == entry.LinkTarget, nil
+	case manifestTypeHardlink:
+		// 目标文件会先于硬链接复制，只要当前已经是同一个文件即可
+		targetInfo, err := os.Lstat(filepath.Join(destDir, entry.LinkTarget))
+		if err != nil {
+			return false, nil
+		}
+		return os.SameFile(destInfo, targetInfo), nil
+	}
+
+	if !destInfo.Mode().IsRegular() {
+		return false, nil
+	}
+
+	// 旧格式 manifest 没有元数据，需要读取源文件信息
+	sourcePath := filepath.Join(sourceDir, entry.Path)
+	size, modTime := entry.Size, entry.ModTime
+	if !entry.hasMetadata() {
+		sourceInfo, err := os.Stat(sourcePath)
+		if err != nil {
+			return false, err
+		}
+		size, modTime = sourceInfo.Size(), sourceInfo.ModTime()
+	}
+
+	if destInfo.Size() != size {
+		return false, nil
+	}
+
+	if checksumAlgo == "" {
+		return sameModTime(destInfo.ModTime(), modTime), nil
+	}
+
+	sourceSum := entry.Checksum
+	if sourceSum == "" || manifestAlgo != checksumAlgo {
+		if sourceSum, err = hashFile(sourcePath, checksumAlgo); err != nil {
+			return false, err
+		}
+	}
+	destSum, err := hashFile(destPath, checksumAlgo)
+	if err != nil {
+		return false, err
+	}
+	return sourceSum == destSum, nil
+}
+
+// sameModTime 判断两个修改时间是否一致
+// 部分文件系统只能保存到秒，其中一方没有纳秒部分时按秒比较
+func sameModTime(a, b time.Time) bool {
+	if a.Equal(b) {
+		return true
+	}
+	if a.Nanosecond() == 0 || b.Nanosecond() == 0 {
+		return a.Unix() == b.Unix()
+	}
+	return false
+}
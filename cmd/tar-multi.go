@@ -9,7 +9,6 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
-	"strings"
 	"sync"
 
 	"github.com/spf13/cobra"
@@ -23,14 +22,15 @@ var tarMultiCmd = &cobra.Command{
 
 支持的功能：
 - 自动在内存中生成 manifest 列表（如果未指定 manifest 文件）
-- 根据 manifest 列表将文件分成多份，每个 tar 包包含不同的文件
+- 根据 manifest 列表将文件分成多份，每个 tar 包包含不同的文件（按文件大小均衡数据量）
 - 并行处理多个 tar 包，每个 tar 包独立读取和打包分配给它的文件
 - 在目标目录生成多个 tar 包和 manifest 文件
 
 示例：
   p-tool tar-multi /source /output
   p-tool tar-multi /source /output --count 10
-  p-tool tar-multi /source /output --manifest-file /tmp/manifest.txt`,
+  p-tool tar-multi /source /output --manifest-file /tmp/manifest.txt
+  p-tool tar-multi /source /output --include 'src/**' --exclude '*.tmp'`,
 	Args: cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		sourceDir := args[0]
@@ -38,6 +38,7 @@ var tarMultiCmd = &cobra.Command{
 
 		manifestFile, _ := cmd.Flags().GetString("manifest-file")
 		tarCount, _ := cmd.Flags().GetInt("count")
+		concurrency, _ := cmd.Flags().GetInt("concurrency")
 		useZstd, _ := cmd.Flags().GetBool("zstd")
 
 		// 验证源目录
@@ -71,13 +72,21 @@ var tarMultiCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		var fileList []string
+		// 解析过滤规则和忽略文件
+		scanOpts, err := scanOptionsFromFlags(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+			os.Exit(1)
+		}
+		scanOpts.Concurrency = concurrency
+
+		var fileList []ManifestEntry
 
 		// 如果未指定 manifest 文件，在内存中生成
 		if manifestFile == "" {
 			var err error
-			fileList, err = GenerateManifestInMemory(absSourceDir)
-			if err != nil {
+			fileList, err = GenerateManifestInMemory(absSourceDir, scanOpts)
+			if err = warnScanIncomplete(err); err != nil {
 				fmt.Fprintf(os.Stderr, "错误: 生成 manifest 失败: %v\n", err)
 				os.Exit(1)
 			}
@@ -88,6 +97,12 @@ var tarMultiCmd = &cobra.Command{
 				fmt.Fprintf(os.Stderr, "错误: 读取 manifest 文件失败: %v\n", err)
 				os.Exit(1)
 			}
+			// 对 manifest 中的路径同样应用过滤规则和忽略文件
+			fileList, err = filterManifestEntries(absSourceDir, fileList, scanOpts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+				os.Exit(1)
+			}
 		}
 
 		if len(fileList) == 0 {
@@ -106,8 +121,11 @@ var tarMultiCmd = &cobra.Command{
 		// 将文件列表分成多份
 		fileChunks := splitFileList(fileList, tarCount)
 
+		// manifest 中的条目按目标文件记录时，系统 tar 也需要跟随符号链接（-h），保持与 manifest 一致
+		dereference := scanOpts.Symlinks == symlinksFollow || (scanOpts.Symlinks == "" && !hasSymlinkEntries(fileList))
+
 		// 并行生成多个 tar 包
-		if err := createMultipleTarsParallel(absSourceDir, absOutputDir, fileChunks, useZstd); err != nil {
+		if err := createMultipleTarsParallel(absSourceDir, absOutputDir, fileChunks, useZstd, dereference); err != nil {
 			fmt.Fprintf(os.Stderr, "错误: 生成 tar 包失败: %v\n", err)
 			os.Exit(1)
 		}
@@ -129,12 +147,57 @@ func init() {
 
 	tarMultiCmd.Flags().String("manifest-file", "", "指定 manifest 文件路径（可选）")
 	tarMultiCmd.Flags().Int("count", 0, "指定生成的 tar 包数量，默认为 CPU 核数")
-	tarMultiCmd.Flags().Int("concurrency", 0, "保留参数（已弃用，系统 tar 命令不支持此参数）")
+	tarMultiCmd.Flags().Int("concurrency", 0, "扫描目录时的并发数量，默认为 CPU 核数（打包并发由 --count 决定）")
+	addFilterFlags(tarMultiCmd)
+	addSymlinksFlag(tarMultiCmd)
 	tarMultiCmd.Flags().Bool("zstd", false, "使用 zstd 算法压缩 tar 包")
 }
 
 // splitFileList 将文件列表分成多份
-func splitFileList(fileList []string, count int) [][]string {
+// manifest 带有大小信息时按数据量均衡切分，否则按文件数平均切分。
+// 硬链接条目会放到目标文件所在的那一份，使系统 tar 能在同一个包内识别出硬链接
+func splitFileList(fileList []ManifestEntry, count int) [][]ManifestEntry {
+	var hardlinks []ManifestEntry
+	if count > 1 {
+		regular := make([]ManifestEntry, 0, len(fileList))
+		for i := range fileList {
+			if fileList[i].Type == manifestTypeHardlink {
+				hardlinks = append(hardlinks, fileList[i])
+			} else {
+				regular = append(regular, fileList[i])
+			}
+		}
+		fileList = regular
+	}
+
+	chunks := splitEntries(fileList, count)
+
+	if len(hardlinks) > 0 {
+		chunkOf := make(map[string]int, len(fileList))
+		for i, chunk := range chunks {
+			for j := range chunk {
+				chunkOf[chunk[j].Path] = i
+			}
+		}
+		for _, link := range hardlinks {
+			// 目标不在列表中时（manifest 不完整）放到最后一份，由系统 tar 按普通文件打包
+			i, ok := chunkOf[link.LinkTarget]
+			if !ok {
+				if len(chunks) == 0 {
+					chunks = append(chunks, nil)
+				}
+				i = len(chunks) - 1
+			}
+			// chunks 使用三下标切片，append 不会覆盖相邻的份
+			chunks[i] = append(chunks[i], link)
+		}
+	}
+
+	return chunks
+}
+
+// splitEntries 将条目列表切分为 count 份连续的子列表
+func splitEntries(fileList []ManifestEntry, count int) [][]ManifestEntry {
 	if count <= 0 {
 		count = 1
 	}
@@ -142,7 +205,11 @@ func splitFileList(fileList []string, count int) [][]string {
 		count = len(fileList)
 	}
 
-	chunks := make([][]string, count)
+	if totalSize := manifestTotalSize(fileList); totalSize > 0 {
+		return splitFileListBySize(fileList, count, totalSize)
+	}
+
+	chunks := make([][]ManifestEntry, count)
 	chunkSize := len(fileList) / count
 	remainder := len(fileList) % count
 
@@ -152,15 +219,43 @@ func splitFileList(fileList []string, count int) [][]string {
 		if i < remainder {
 			end++
 		}
-		chunks[i] = fileList[start:end]
+		chunks[i] = fileList[start:end:end]
 		start = end
 	}
 
 	return chunks
 }
 
+// splitFileListBySize 按数据量将文件列表切分为 count 份连续的子列表
+// 保持 manifest 顺序不变，每份至少包含一个文件
+func splitFileListBySize(fileList []ManifestEntry, count int, totalSize int64) [][]ManifestEntry {
+	chunks := make([][]ManifestEntry, 0, count)
+
+	start := 0
+	var accumulated int64
+	for i := range fileList {
+		accumulated += fileList[i].Size
+
+		remainingChunks := count - len(chunks) - 1
+		if remainingChunks == 0 {
+			break
+		}
+
+		// 累计数据量达到当前份的目标值，或剩余文件数只够每份一个时切分
+		target := totalSize * int64(len(chunks)+1) / int64(count)
+		remainingFiles := len(fileList) - (i + 1)
+		if accumulated >= target || remainingFiles == remainingChunks {
+			chunks = append(chunks, fileList[start:i+1:i+1])
+			start = i + 1
+		}
+	}
+	chunks = append(chunks, fileList[start:])
+
+	return chunks
+}
+
 // createMultipleTarsParallel 并行生成多个 tar 包
-func createMultipleTarsParallel(sourceDir, outputDir string, fileChunks [][]string, useZstd bool) error {
+func createMultipleTarsParallel(sourceDir, outputDir string, fileChunks [][]ManifestEntry, useZstd, dereference bool) error {
 	var failedTars int
 	var wg sync.WaitGroup
 	var mu sync.Mutex
@@ -168,7 +263,7 @@ func createMultipleTarsParallel(sourceDir, outputDir string, fileChunks [][]stri
 	// 并行生成每个 tar 包
 	for i, chunk := range fileChunks {
 		wg.Add(1)
-		go func(index int, files []string) {
+		go func(index int, files []ManifestEntry) {
 			defer wg.Done()
 
 			var tarFileName string
@@ -179,7 +274,7 @@ func createMultipleTarsParallel(sourceDir, outputDir string, fileChunks [][]stri
 			}
 			tarFilePath := filepath.Join(outputDir, tarFileName)
 
-			if err := createSingleTarWithSystemTar(sourceDir, tarFilePath, files, useZstd); err != nil {
+			if err := createSingleTarWithSystemTar(sourceDir, tarFilePath, files, useZstd, dereference); err != nil {
 				mu.Lock()
 				fmt.Fprintf(os.Stderr, "错误: 生成 tar 包 %s 失败: %v\n", tarFileName, err)
 				failedTars++
@@ -199,7 +294,8 @@ func createMultipleTarsParallel(sourceDir, outputDir string, fileChunks [][]stri
 }
 
 // createSingleTarWithSystemTar 使用系统 tar 命令生成单个 tar 包
-func createSingleTarWithSystemTar(sourceDir, outputFile string, fileList []string, useZstd bool) error {
+// dereference 为 true 时跟随符号链接打包目标文件（tar -h）
+func createSingleTarWithSystemTar(sourceDir, outputFile string, fileList []ManifestEntry, useZstd, dereference bool) error {
 	if len(fileList) == 0 {
 		return nil
 	}
@@ -212,13 +308,9 @@ func createSingleTarWithSystemTar(sourceDir, outputFile string, fileList []strin
 	defer os.Remove(tmpManifest.Name())
 	defer tmpManifest.Close()
 
-	// 写入文件列表到临时 manifest（使用相对路径，格式为 ./path）
-	for _, relPath := range fileList {
-		formattedPath := filepath.ToSlash(relPath)
-		if !strings.HasPrefix(formattedPath, "./") {
-			formattedPath = "./" + formattedPath
-		}
-		if _, err := fmt.Fprintf(tmpManifest, "%s\n", formattedPath); err != nil {
+	// 写入文件列表到临时 manifest（系统 tar 只接受路径，格式为 ./path）
+	for i := range fileList {
+		if _, err := fmt.Fprintf(tmpManifest, "%s\n", formatManifestPath(fileList[i].Path)); err != nil {
 			return fmt.Errorf("写入临时 manifest 文件失败: %w", err)
 		}
 	}
@@ -240,9 +332,12 @@ func createSingleTarWithSystemTar(sourceDir, outputFile string, fileList []strin
 	if useZstd {
 		args = append(args, "--zstd")
 	}
+	if dereference {
+		args = append(args, "-h")
+	}
 
 	// 切换到源目录执行 tar 命令
-	// tar -cf output.tar -T manifest.txt [--zstd]
+	// tar -cf output.tar -T manifest.txt [--zstd] [-h]
 	cmd := exec.Command("tar", args...)
 	cmd.Dir = sourceDir
 
@@ -255,23 +350,16 @@ func createSingleTarWithSystemTar(sourceDir, outputFile string, fileList []strin
 	return nil
 }
 
-// writeManifestFile 将文件列表写入 manifest 文件
-func writeManifestFile(manifestPath string, fileList []string) error {
+// writeManifestFile 将文件列表以 v2 格式写入 manifest 文件
+func writeManifestFile(manifestPath string, fileList []ManifestEntry) error {
 	manifestFile, err := os.Create(manifestPath)
 	if err != nil {
 		return fmt.Errorf("无法创建 manifest 文件: %w", err)
 	}
 	defer manifestFile.Close()
 
-	for _, relPath := range fileList {
-		// 确保路径使用斜杠格式，并添加 ./ 前缀
-		formattedPath := filepath.ToSlash(relPath)
-		if !strings.HasPrefix(formattedPath, "./") {
-			formattedPath = "./" + formattedPath
-		}
-		if _, err := fmt.Fprintf(manifestFile, "%s\n", formattedPath); err != nil {
-			return fmt.Errorf("写入 manifest 文件失败: %w", err)
-		}
+	if err := writeManifestEntries(manifestFile, fileList, ""); err != nil {
+		return fmt.Errorf("写入 manifest 文件失败: %w", err)
 	}
 
 	return nil
@@ -6,17 +6,16 @@ package cmd
 import (
 	"archive/tar"
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"runtime"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/klauspost/compress/zstd"
 	"github.com/spf13/cobra"
 )
 
@@ -28,13 +27,31 @@ var tarCmd = &cobra.Command{
 
 支持的功能：
 - 自动在内存中生成 manifest 列表（如果未指定 manifest 文件）
-- 并行读取文件，提高打包速度
+- 多个协程并行读取文件（小文件预读到内存，大文件边读边写），单个写入协程按顺序写入 tar 包，
+  读取和写入互不阻塞；预读占用的内存受 --max-buffer 限制
 - 显示打包进度
+- 使用 --compress zstd|gzip|lz4|xz|bzip2 压缩（--zstd 等同于 --compress zstd），--level 指定压缩级别，
+  --compress-threads 指定压缩线程数（默认 CPU 核数，输入切分为独立的帧并行压缩，输出仍可用 gzip -d 等
+  标准命令解压），--window-size 指定 zstd 窗口或 xz 字典大小；完成后输出压缩比和速度
+- 使用 --seekable 生成 seekable zstd 格式：按文件分组切分为独立的帧，末尾写入 seek table 和路径索引，
+  可用 extract-file 直接定位并提取单个文件，无需解压整个 tar 包
+- 使用 --fsync-mode=none|file|end|dir 或 --sync 控制 tar 包的持久化
+- manifest 作为第一个条目写入 tar 包（解压时无需读完整个 tar 包即可知道文件列表），
+  最后一个条目记录打包时失败的文件；有文件失败时 tar 包仍然完整，但命令以非零状态退出
+- 使用 --order largest-first|locality 调整文件写入 tar 包的顺序（tar 包内的 manifest 仍按原顺序）
+- 稀疏文件以 PAX 稀疏格式（GNU tar 兼容）写入，空洞不占用 tar 包空间
 
 示例：
   p-tool tar /source output.tar
   p-tool tar /source output.tar --manifest-file /tmp/manifest.txt
-  p-tool tar /source output.tar --concurrency 8`,
+  p-tool tar /source output.tar --concurrency 8
+  p-tool tar /source output.tar --max-buffer 2GB
+  p-tool tar /source output.tar.zst --zstd --level 19 --compress-threads 32 --window-size 32MB
+  p-tool tar /source output.tar.gz --compress gzip
+  p-tool tar /source output.tar.zst --zstd --seekable
+  p-tool tar /source output.tar --exclude '**/.git/' --exclude-from /tmp/excludes.txt
+  p-tool tar /source output.tar --fsync-mode file
+  p-tool tar /source output.tar --order locality`,
 	Args: cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		sourceDir := args[0]
@@ -42,7 +59,30 @@ var tarCmd = &cobra.Command{
 
 		manifestFile, _ := cmd.Flags().GetString("manifest-file")
 		concurrency, _ := cmd.Flags().GetInt("concurrency")
-		useZstd, _ := cmd.Flags().GetBool("zstd")
+		maxBufferStr, _ := cmd.Flags().GetString("max-buffer")
+		compressOpts, err := compressOptionsFromFlags(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+			os.Exit(1)
+		}
+
+		dur, err := durabilityFromFlags(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+			os.Exit(1)
+		}
+		order, err := orderFromFlags(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+			os.Exit(1)
+		}
+
+		// 解析内存预算
+		maxBuffer, err := parseByteSize(maxBufferStr)
+		if err != nil || maxBuffer <= 0 {
+			fmt.Fprintf(os.Stderr, "错误: 无效的 --max-buffer 参数: %s\n", maxBufferStr)
+			os.Exit(1)
+		}
 
 		// 验证源目录
 		sourceInfo, err := os.Stat(sourceDir)
@@ -62,13 +102,21 @@ var tarCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		var fileList []string
+		// 解析过滤规则和忽略文件
+		scanOpts, err := scanOptionsFromFlags(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+			os.Exit(1)
+		}
+		scanOpts.Concurrency = concurrency
+
+		var fileList []ManifestEntry
 
 		// 如果未指定 manifest 文件，在内存中生成
 		if manifestFile == "" {
 			var err error
-			fileList, err = GenerateManifestInMemory(absSourceDir)
-			if err != nil {
+			fileList, err = GenerateManifestInMemory(absSourceDir, scanOpts)
+			if err = warnScanIncomplete(err); err != nil {
 				fmt.Fprintf(os.Stderr, "错误: 生成 manifest 失败: %v\n", err)
 				os.Exit(1)
 			}
@@ -79,6 +127,12 @@ var tarCmd = &cobra.Command{
 				fmt.Fprintf(os.Stderr, "错误: 读取 manifest 文件失败: %v\n", err)
 				os.Exit(1)
 			}
+			// 对 manifest 中的路径同样应用过滤规则和忽略文件
+			fileList, err = filterManifestEntries(absSourceDir, fileList, scanOpts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+				os.Exit(1)
+			}
 		}
 
 		if len(fileList) == 0 {
@@ -94,11 +148,22 @@ var tarCmd = &cobra.Command{
 		fmt.Fprintf(os.Stdout, "开始打包 %d 个文件（并发数: %d）...\n", len(fileList), concurrency)
 
 		// 并行生成 tar 包
-		if err := createTarParallel(absSourceDir, outputFile, fileList, concurrency, useZstd); err != nil {
+		if err := createTarParallel(absSourceDir, outputFile, fileList, concurrency, compressOpts, order, maxBuffer); err != nil {
 			fmt.Fprintf(os.Stderr, "错误: 生成 tar 包失败: %v\n", err)
 			os.Exit(1)
 		}
 
+		// 同步到磁盘：tar 包本身以及所在目录
+		if err := dur.syncFileAt(outputFile); err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 同步 tar 包失败: %v\n", err)
+			os.Exit(1)
+		}
+		outputDir := filepath.Dir(outputFile)
+		if err := dur.finish(outputDir, []string{outputDir}, 1); err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+			os.Exit(1)
+		}
+
 		fmt.Fprintf(os.Stdout, "\n打包完成！\n")
 	},
 }
@@ -108,9 +173,20 @@ func init() {
 
 	tarCmd.Flags().String("manifest-file", "", "指定 manifest 文件路径（可选）")
 	tarCmd.Flags().Int("concurrency", 0, "指定并发数量，默认为 CPU 核数")
-	tarCmd.Flags().Bool("zstd", false, "使用 zstd 算法压缩 tar 包")
+	addFilterFlags(tarCmd)
+	addSymlinksFlag(tarCmd)
+	addCompressFlags(tarCmd)
+	tarCmd.Flags().String("max-buffer", "512MB", "打包时预读到内存中的文件内容上限（如 512MB、2GB），不含并行压缩排队的数据（另有 1GB 上限，超过时减少压缩线程数）")
+	addFsyncFlags(tarCmd)
+	addOrderFlag(tarCmd)
 }
 
+// tar 包内 p-tool 自己的记录文件使用特殊名称，便于解压时识别
+const (
+	tarManifestName = ".__p-tool-manifest__.txt" // 第一个条目：要打包的完整文件列表
+	tarFooterName   = ".__p-tool-footer__.txt"   // 最后一个条目：打包时失败、没有写入 tar 包的文件
+)
+
 // tarBufferPool 缓冲区池，用于复用缓冲区减少内存分配
 var tarBufferPool = sync.Pool{
 	New: func() interface{} {
@@ -120,10 +196,19 @@ var tarBufferPool = sync.Pool{
 }
 
 // createTarParallel 并行读取文件并生成 tar 包
-func createTarParallel(sourceDir, outputFile string, fileList []string, concurrency int, useZstd bool) error {
+// order 指定文件的处理顺序，即文件在 tar 包中的顺序；maxBuffer 为预读文件内容占用内存的上限
+// compressOpts 指定压缩格式和参数，完成后输出压缩比和压缩速度
+func createTarParallel(sourceDir, outputFile string, fileList []ManifestEntry, concurrency int, compressOpts compressOptions, order string, maxBuffer int64) error {
 	totalFiles := int64(len(fileList))
 	var processedFiles int64
 	var failedFiles int64
+	var processedBytes int64
+
+	// manifest 带有大小信息时显示数据量进度（旧格式 manifest 为 -1，不显示）
+	totalBytes := manifestTotalSize(fileList)
+
+	// 按 --order 决定任务的发送顺序（需要时先 stat 源文件）
+	ordered := orderEntries(sourceDir, fileList, order, concurrency)
 
 	// 记录开始时间
 	startTime := time.Now()
@@ -138,33 +223,52 @@ func createTarParallel(sourceDir, outputFile string, fileList []string, concurre
 	// 创建带缓冲的 writer 提高性能（增大缓冲区到 256KB）
 	bufferedWriter := bufio.NewWriterSize(outFile, 256*1024)
 
-	// 根据 useZstd 标志决定是否使用 zstd 压缩
-	var writer io.Writer = bufferedWriter
-	var zstdEncoder *zstd.Encoder
-	if useZstd {
-		var err error
-		zstdEncoder, err = zstd.NewWriter(bufferedWriter, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(6)))
-		if err != nil {
-			return fmt.Errorf("创建 zstd 编码器失败: %w", err)
-		}
-		writer = zstdEncoder
+	// 根据压缩格式创建压缩器（不压缩时为 nil）；分别统计压缩前后的字节数
+	compressedCounter := &countingWriter{w: bufferedWriter}
+	compressor, err := newCompressWriter(compressedCounter, compressOpts)
+	if err != nil {
+		return fmt.Errorf("创建 %s 压缩器失败: %w", compressOpts.format, err)
+	}
+	var writer io.Writer = compressedCounter
+	if compressor != nil {
+		writer = compressor
 	}
+	rawCounter := &countingWriter{w: writer}
+	writer = rawCounter
 
 	tarWriter := tar.NewWriter(writer)
+
+	// seekable 模式下在每个条目开始前记录其在 tar 流中的偏移（先写出上一个条目的填充）
+	seekable, _ := compressor.(*seekableWriter)
+	markEntry := func(path string) error {
+		if seekable == nil {
+			return nil
+		}
+		if err := tarWriter.Flush(); err != nil {
+			return err
+		}
+		seekable.addEntry(filepath.ToSlash(path), atomic.LoadInt64(&rawCounter.n))
+		return nil
+	}
+
+	closed := false
 	defer func() {
-		// 按顺序关闭：先关闭 tarWriter，再关闭 zstdEncoder，最后 flush buffer
+		if closed {
+			return
+		}
+		// 出错返回时仍按顺序关闭：先关闭 tarWriter，再关闭压缩器，最后 flush buffer
 		tarWriter.Close()
-		if zstdEncoder != nil {
-			zstdEncoder.Close()
+		if compressor != nil {
+			compressor.Close()
 		}
 		bufferedWriter.Flush()
 	}()
 
-	// 创建任务通道
-	taskChan := make(chan string, concurrency*2)
-
-	var wg sync.WaitGroup
-	var mu sync.Mutex // 保护 tarWriter 的并发写入
+	// 文件列表在打包前已经确定，先把 manifest 写在 tar 包开头，
+	// 解压时读到第一个条目就知道要解压哪些文件，可以立即开始并行写入
+	if err := writeManifestToTar(tarWriter, tarManifestName, fileList); err != nil {
+		return fmt.Errorf("写入 manifest 文件到 tar 包失败: %w", err)
+	}
 
 	// 启动进度更新协程
 	progressDone := make(chan struct{})
@@ -174,130 +278,186 @@ func createTarParallel(sourceDir, outputFile string, fileList []string, concurre
 		for {
 			select {
 			case <-ticker.C:
-				updateTarProgress(atomic.LoadInt64(&processedFiles), totalFiles, startTime)
+				updateTarProgress(atomic.LoadInt64(&processedFiles), totalFiles, atomic.LoadInt64(&processedBytes), totalBytes, startTime)
 			case <-progressDone:
 				return
 			}
 		}
 	}()
 
-	// 启动文件处理工作协程（并行读取文件并流式写入 tar）
-	var writeErr error
-	var writeErrMu sync.Mutex
+	// 读取协程并行读取 header 并预读文件内容，当前协程作为唯一的写入协程按顺序写入 tar 包，
+	// 写入时不持有任何锁，也不会等待磁盘读取（除非预读跟不上）
+	pipe := newTarPipeline(sourceDir, maxBuffer)
+	taskChan := make(chan *tarItem, concurrency*2)
+	// 写入协程等待的条目队列，限制已发送但尚未写入的条目数
+	items := make(chan *tarItem, concurrency*16)
+
+	var wg sync.WaitGroup
 	for i := 0; i < concurrency; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for relPath := range taskChan {
-				// 如果已经有写入错误，跳过后续处理
-				writeErrMu.Lock()
-				if writeErr != nil {
-					writeErrMu.Unlock()
-					atomic.AddInt64(&processedFiles, 1)
-					continue
-				}
-				writeErrMu.Unlock()
-
-				// 读取文件 header（不读内容）
-				header, err := readFileHeaderForTar(sourceDir, relPath)
-				if err != nil {
-					mu.Lock()
-					if os.IsNotExist(err) {
-						fmt.Fprintf(os.Stderr, "警告: 源文件不存在: %s\n", filepath.Join(sourceDir, relPath))
-					} else {
-						fmt.Fprintf(os.Stderr, "警告: 读取文件失败 %s: %v\n", relPath, err)
-					}
-					mu.Unlock()
-					atomic.AddInt64(&failedFiles, 1)
-					atomic.AddInt64(&processedFiles, 1)
-					continue
-				}
-
-				// 加锁保护 tarWriter（tar 格式要求串行写入）
-				mu.Lock()
-				// 再次检查错误
-				writeErrMu.Lock()
-				if writeErr != nil {
-					writeErrMu.Unlock()
-					mu.Unlock()
-					atomic.AddInt64(&processedFiles, 1)
-					continue
-				}
-				writeErrMu.Unlock()
-
-				// 写入 tar header
-				if err := tarWriter.WriteHeader(header); err != nil {
-					writeErrMu.Lock()
-					writeErr = fmt.Errorf("写入 tar header 失败 %s: %w", relPath, err)
-					writeErrMu.Unlock()
-					mu.Unlock()
-					atomic.AddInt64(&processedFiles, 1)
-					return
-				}
-
-				// 流式写入文件内容
-				if err := writeFileContentToTar(sourceDir, relPath, tarWriter); err != nil {
-					writeErrMu.Lock()
-					writeErr = fmt.Errorf("写入文件内容失败 %s: %w", relPath, err)
-					writeErrMu.Unlock()
-					mu.Unlock()
-					atomic.AddInt64(&processedFiles, 1)
-					return
-				}
-
-				mu.Unlock()
-				atomic.AddInt64(&processedFiles, 1)
+			for item := range taskChan {
+				pipe.prepare(item)
 			}
 		}()
 	}
 
-	// 发送任务
-	for _, relPath := range fileList {
-		taskChan <- relPath
+	// 发送任务（硬链接条目要求目标文件先出现在 tar 包中，最后统一写入）
+	var hardlinks []*ManifestEntry
+	go func() {
+		var seq int64
+		for i := range ordered {
+			if ordered[i].Type == manifestTypeHardlink {
+				hardlinks = append(hardlinks, &ordered[i])
+				continue
+			}
+			item := &tarItem{entry: &ordered[i], seq: seq, ready: make(chan struct{})}
+			seq++
+			items <- item
+			taskChan <- item
+		}
+		close(taskChan)
+		close(items)
+	}()
+
+	// 按发送顺序写入 tar 包
+	var writeErr error
+	var failed []ManifestEntry // 读取失败、没有写入 tar 包的条目
+	for item := range items {
+		<-item.ready
+		switch {
+		case writeErr != nil || item.skipped:
+			// 已发生写入错误，只释放资源
+		case item.err != nil:
+			if os.IsNotExist(item.err) {
+				fmt.Fprintf(os.Stderr, "警告: 源文件不存在: %s\n", filepath.Join(sourceDir, item.entry.Path))
+			} else {
+				fmt.Fprintf(os.Stderr, "警告: 读取文件失败 %s: %v\n", item.entry.Path, item.err)
+			}
+			failed = append(failed, *item.entry)
+			atomic.AddInt64(&failedFiles, 1)
+		default:
+			var n int64
+			err := markEntry(item.entry.Path)
+			if err == nil {
+				n, err = pipe.write(tarWriter, writer, item)
+			}
+			atomic.AddInt64(&processedBytes, n)
+			if err != nil {
+				writeErr = fmt.Errorf("写入文件失败 %s: %w", item.entry.Path, err)
+				pipe.abort()
+			}
+		}
+		pipe.release(item)
+		atomic.AddInt64(&processedFiles, 1)
 	}
-	close(taskChan)
 
-	// 等待所有工作协程完成
+	// 等待所有读取协程完成
 	wg.Wait()
 
+	// 写入硬链接条目（只有 header，没有内容）
+	for _, entry := range hardlinks {
+		if writeErr != nil {
+			break
+		}
+		header, err := readFileHeaderForTar(sourceDir, entry)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "警告: 读取文件失败 %s: %v\n", entry.Path, err)
+			failed = append(failed, *entry)
+			atomic.AddInt64(&failedFiles, 1)
+		} else if err := markEntry(entry.Path); err != nil {
+			writeErr = fmt.Errorf("写入 tar 包失败 %s: %w", entry.Path, err)
+		} else if err := tarWriter.WriteHeader(header); err != nil {
+			writeErr = fmt.Errorf("写入 tar header 失败 %s: %w", entry.Path, err)
+		}
+		atomic.AddInt64(&processedFiles, 1)
+	}
+
 	// 停止进度更新协程
 	close(progressDone)
 	time.Sleep(120 * time.Millisecond)
 
 	// 显示最终进度
-	updateTarProgress(atomic.LoadInt64(&processedFiles), totalFiles, startTime)
+	updateTarProgress(atomic.LoadInt64(&processedFiles), totalFiles, atomic.LoadInt64(&processedBytes), totalBytes, startTime)
 
-	writeErrMu.Lock()
-	err = writeErr
-	writeErrMu.Unlock()
-	if err != nil {
-		return err
+	if writeErr != nil {
+		return writeErr
 	}
 
-	if failedFiles > 0 {
-		return fmt.Errorf("有 %d 个文件处理失败或源文件不存在", failedFiles)
+	// 结尾记录打包时失败的文件（没有失败时为空列表），解压时据此区分打包失败和解压失败；
+	// 缺少结尾记录说明打包没有正常完成
+	if err := writeManifestToTar(tarWriter, tarFooterName, failed); err != nil {
+		return fmt.Errorf("写入结尾记录到 tar 包失败: %w", err)
 	}
 
-	// 将 manifest 文件也写入 tar 包
-	if err := writeManifestToTar(tarWriter, fileList); err != nil {
-		return fmt.Errorf("写入 manifest 文件到 tar 包失败: %w", err)
+	// 按顺序关闭并检查错误，压缩器关闭时才写出最后的数据
+	closed = true
+	if err := tarWriter.Close(); err != nil {
+		return fmt.Errorf("关闭 tar 包失败: %w", err)
+	}
+	if compressor != nil {
+		if err := compressor.Close(); err != nil {
+			return fmt.Errorf("压缩 tar 包失败: %w", err)
+		}
+	}
+	if err := bufferedWriter.Flush(); err != nil {
+		return fmt.Errorf("写入 tar 包失败: %w", err)
+	}
+
+	printTarSummary(atomic.LoadInt64(&rawCounter.n), atomic.LoadInt64(&compressedCounter.n), compressOpts, time.Since(startTime))
+
+	if failedFiles > 0 {
+		return fmt.Errorf("有 %d 个文件处理失败或源文件不存在", failedFiles)
 	}
 
 	return nil
 }
 
+// printTarSummary 输出 tar 包大小、打包速度，压缩时输出压缩比
+func printTarSummary(rawBytes, outputBytes int64, opts compressOptions, elapsed time.Duration) {
+	mbPerSec := 0.0
+	if elapsed > 0 {
+		mbPerSec = float64(rawBytes) / 1024 / 1024 / elapsed.Seconds()
+	}
+	fmt.Fprintf(os.Stdout, "\n")
+	if opts.format == compressNone {
+		fmt.Fprintf(os.Stdout, "tar 包大小: %s | 耗时: %s | 速度: %.1f MB/s\n",
+			formatBytes(outputBytes), elapsed.Round(time.Millisecond), mbPerSec)
+		return
+	}
+	ratio := 0.0
+	if outputBytes > 0 {
+		ratio = float64(rawBytes) / float64(outputBytes)
+	}
+	fmt.Fprintf(os.Stdout, "压缩: %s | 原始: %s → 压缩后: %s | 压缩比: %.2f | 耗时: %s | 速度: %.1f MB/s\n",
+		opts, formatBytes(rawBytes), formatBytes(outputBytes), ratio, elapsed.Round(time.Millisecond), mbPerSec)
+}
+
 // readFileHeaderForTar 读取文件信息并创建 tar header（不读文件内容）
-func readFileHeaderForTar(sourceDir, relPath string) (*tar.Header, error) {
+// 符号链接条目生成 TypeSymlink header，硬链接条目生成指向目标条目的 TypeLink header，
+// 其他条目跟随符号链接按目标文件生成
+func readFileHeaderForTar(sourceDir string, entry *ManifestEntry) (*tar.Header, error) {
+	relPath := entry.Path
 	fullPath := filepath.Join(sourceDir, relPath)
 
 	// 获取文件信息
-	fileInfo, err := os.Stat(fullPath)
-	if err != nil {
+	var fileInfo os.FileInfo
+	var linkTarget string
+	var err error
+	if entry.Type == manifestTypeSymlink {
+		if fileInfo, err = os.Lstat(fullPath); err != nil {
+			return nil, err
+		}
+		if linkTarget, err = os.Readlink(fullPath); err != nil {
+			return nil, err
+		}
+	} else if fileInfo, err = os.Stat(fullPath); err != nil {
 		return nil, err
 	}
 
 	// 创建 tar header
-	header, err := tar.FileInfoHeader(fileInfo, "")
+	header, err := tar.FileInfoHeader(fileInfo, linkTarget)
 	if err != nil {
 		return nil, fmt.Errorf("创建 tar header 失败: %w", err)
 	}
@@ -305,56 +465,28 @@ func readFileHeaderForTar(sourceDir, relPath string) (*tar.Header, error) {
 	// 设置文件名（使用相对路径，确保路径使用斜杠）
 	header.Name = filepath.ToSlash(relPath)
 
-	return header, nil
-}
-
-// writeFileContentToTar 流式写入文件内容到 tar（优化内存占用）
-func writeFileContentToTar(sourceDir, relPath string, tarWriter *tar.Writer) error {
-	fullPath := filepath.Join(sourceDir, relPath)
-
-	// 打开文件
-	file, err := os.Open(fullPath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	// 从缓冲区池获取缓冲区
-	bufPtr := tarBufferPool.Get().(*[]byte)
-	defer tarBufferPool.Put(bufPtr)
-	buf := *bufPtr
-
-	// 使用流式复制，避免将整个文件读入内存
-	_, err = io.CopyBuffer(tarWriter, file, buf)
-	if err != nil {
-		return fmt.Errorf("流式写入文件内容失败: %w", err)
+	if entry.Type == manifestTypeHardlink {
+		header.Typeflag = tar.TypeLink
+		header.Linkname = entry.LinkTarget
+		header.Size = 0
 	}
 
-	return nil
+	return header, nil
 }
 
-// writeManifestToTar 将 manifest 文件写入 tar 包
-func writeManifestToTar(tarWriter *tar.Writer, fileList []string) error {
-	// manifest 文件使用特殊名称，便于解压时识别
-	manifestName := ".__p-tool-manifest__.txt"
-
-	// 生成 manifest 内容（每行一个文件路径，格式为 ./relative/path）
-	var manifestContent strings.Builder
-	for _, relPath := range fileList {
-		// 确保路径使用斜杠格式，并添加 ./ 前缀
-		formattedPath := filepath.ToSlash(relPath)
-		if !strings.HasPrefix(formattedPath, "./") {
-			formattedPath = "./" + formattedPath
-		}
-		manifestContent.WriteString(formattedPath)
-		manifestContent.WriteString("\n")
+// writeManifestToTar 将 v2 格式的条目列表以 name 为文件名写入 tar 包（manifest 和结尾记录）
+func writeManifestToTar(tarWriter *tar.Writer, name string, fileList []ManifestEntry) error {
+	// 生成 v2 格式的 manifest 内容
+	var manifestContent bytes.Buffer
+	if err := writeManifestEntries(&manifestContent, fileList, ""); err != nil {
+		return fmt.Errorf("生成 manifest 内容失败: %w", err)
 	}
 
-	content := []byte(manifestContent.String())
+	content := manifestContent.Bytes()
 
 	// 创建 manifest 文件的 tar header
 	header := &tar.Header{
-		Name:     manifestName,
+		Name:     name,
 		Size:     int64(len(content)),
 		Mode:     0644,
 		ModTime:  time.Now(),
@@ -375,7 +507,8 @@ func writeManifestToTar(tarWriter *tar.Writer, fileList []string) error {
 }
 
 // updateTarProgress 更新打包进度
-func updateTarProgress(current, total int64, startTime time.Time) {
+// totalBytes 为 -1 时表示总数据量未知，只显示文件数进度
+func updateTarProgress(current, total, currentBytes, totalBytes int64, startTime time.Time) {
 	if total == 0 {
 		return
 	}
@@ -383,11 +516,17 @@ func updateTarProgress(current, total int64, startTime time.Time) {
 
 	// 计算每秒文件数
 	elapsed := time.Since(startTime)
-	var filesPerSec float64
+	var filesPerSec, bytesPerSec float64
 	if elapsed.Seconds() > 0 {
 		filesPerSec = float64(current) / elapsed.Seconds()
+		bytesPerSec = float64(currentBytes) / elapsed.Seconds()
 	}
 
-	fmt.Fprintf(os.Stdout, "\r进度: %d/%d (%.1f%%) | 速度: %.1f 文件/秒", current, total, percentage, filesPerSec)
+	if totalBytes >= 0 {
+		fmt.Fprintf(os.Stdout, "\r进度: %d/%d (%.1f%%) | 数据: %s/%s | 速度: %.1f 文件/秒, %s/秒",
+			current, total, percentage, formatBytes(currentBytes), formatBytes(totalBytes), filesPerSec, formatBytes(int64(bytesPerSec)))
+	} else {
+		fmt.Fprintf(os.Stdout, "\r进度: %d/%d (%.1f%%) | 速度: %.1f 文件/秒", current, total, percentage, filesPerSec)
+	}
 	os.Stdout.Sync()
 }
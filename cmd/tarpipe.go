@@ -0,0 +1,318 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// 打包流水线的参数
+const (
+	tarPrefetchMinClass  = 12                       // 预读缓冲区按 2 的幂分级，最小 4KB
+	tarPrefetchMaxClass  = 20                       // 最大 1MB
+	tarPrefetchThreshold = 1 << tarPrefetchMaxClass // 不超过该大小的文件由读取协程完整预读到内存
+	tarReadAheadDepth    = 4                        // 大文件预读的缓冲区个数（每个 1MB，来自 bufferPool）
+)
+
+// tarReadAheadBytes 每个大文件预读占用的内存预算：排队的缓冲区，加上正在读取和正在写入的各一个
+const tarReadAheadBytes = (tarReadAheadDepth + 2) * 1024 * 1024
+
+// prefetchPools 按大小分级的预读缓冲区池，第 i 级的缓冲区大小为 1 << (tarPrefetchMinClass + i)
+var prefetchPools [tarPrefetchMaxClass - tarPrefetchMinClass + 1]sync.Pool
+
+// prefetchClass 返回容纳 size 字节所需的缓冲区级别
+func prefetchClass(size int64) int {
+	class := bits.Len64(uint64(size-1)) - tarPrefetchMinClass
+	if class < 0 {
+		return 0
+	}
+	return class
+}
+
+// getPrefetchBuffer 从对应级别的池中取出至少 size 字节的缓冲区
+func getPrefetchBuffer(size int64) *[]byte {
+	class := prefetchClass(size)
+	if buf, ok := prefetchPools[class].Get().(*[]byte); ok {
+		return buf
+	}
+	buf := make([]byte, 1<<(tarPrefetchMinClass+class))
+	return &buf
+}
+
+// putPrefetchBuffer 将缓冲区归还到对应级别的池中
+func putPrefetchBuffer(buf *[]byte) {
+	prefetchPools[prefetchClass(int64(cap(*buf)))].Put(buf)
+}
+
+// orderedBudget 按序号顺序分配的内存预算
+// 写入协程按顺序等待条目，如果后面的条目先占满预算，它等待的条目就永远拿不到预算；
+// 按序号分配保证排在前面的条目总是先拿到预算，预算只会被写入协程已经等到或即将等到的条目占用
+type orderedBudget struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int64
+	used  int64
+	next  int64 // 下一个允许申请的序号
+}
+
+// newOrderedBudget 创建一个容量为 limit 字节的按序预算
+func newOrderedBudget(limit int64) *orderedBudget {
+	b := &orderedBudget{limit: limit}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire 轮到序号 seq 且预算足够时申请 n 字节（n 可以为 0，只用于让出顺序）
+// 当前没有任何占用时总是允许申请，避免单个超过预算的条目造成死锁
+func (b *orderedBudget) acquire(seq, n int64) {
+	b.mu.Lock()
+	for b.next != seq || (b.used > 0 && b.used+n > b.limit) {
+		b.cond.Wait()
+	}
+	b.used += n
+	b.next++
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// release 归还 n 字节的预算
+func (b *orderedBudget) release(n int64) {
+	if n == 0 {
+		return
+	}
+	b.mu.Lock()
+	b.used -= n
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// tarItem 打包流水线中的一个条目
+// 读取协程准备 header 和内容后关闭 ready，写入协程按发送顺序等待并写入 tar 包
+type tarItem struct {
+	entry *ManifestEntry
+	seq   int64
+	ready chan struct{}
+
+	header   *tar.Header
+	content  *[]byte  // 预读到内存的小文件内容（来自预读缓冲区池）
+	file     *os.File // 大文件或稀疏文件，由写入协程流式写入
+	chunks   chan []byte
+	readErr  error // 大文件预读失败的原因，chunks 关闭后可读
+	reserved int64 // 占用的内存预算
+	skipped  bool  // 已发生写入错误，条目未被读取
+	err      error // 读取失败，条目不写入 tar 包
+}
+
+// tarPipeline 打包流水线：多个读取协程并行打开和预读文件，单个写入协程按顺序写入 tar 包
+// 小文件完整预读到内存，大文件由单独的协程预读若干缓冲区，写入协程写入时不会等待磁盘读取；
+// 预读的总内存受按序预算限制
+type tarPipeline struct {
+	sourceDir string
+	budget    *orderedBudget
+	stop      chan struct{} // 发生写入错误后关闭，读取协程不再读取，预读协程退出
+	stopOnce  sync.Once
+}
+
+// newTarPipeline 创建打包流水线，maxBuffer 为预读占用内存的上限
+func newTarPipeline(sourceDir string, maxBuffer int64) *tarPipeline {
+	return &tarPipeline{
+		sourceDir: sourceDir,
+		budget:    newOrderedBudget(maxBuffer),
+		stop:      make(chan struct{}),
+	}
+}
+
+// abort 停止流水线中尚未开始的读取
+func (p *tarPipeline) abort() {
+	p.stopOnce.Do(func() { close(p.stop) })
+}
+
+// stopped 判断流水线是否已停止
+func (p *tarPipeline) stopped() bool {
+	select {
+	case <-p.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// prepare 在读取协程中准备条目：读取 header，打开文件并按大小预读内容
+// 每个条目都必须按序申请一次预算（可能为 0），否则后面的条目会一直等待
+func (p *tarPipeline) prepare(item *tarItem) {
+	defer close(item.ready)
+
+	if p.stopped() {
+		item.skipped = true
+		p.budget.acquire(item.seq, 0)
+		return
+	}
+
+	header, err := readFileHeaderForTar(p.sourceDir, item.entry)
+	if err != nil {
+		item.err = err
+		p.budget.acquire(item.seq, 0)
+		return
+	}
+	item.header = header
+	if header.Typeflag != tar.TypeReg {
+		p.budget.acquire(item.seq, 0)
+		return
+	}
+
+	file, err := os.Open(filepath.Join(p.sourceDir, item.entry.Path))
+	if err != nil {
+		item.err = err
+		p.budget.acquire(item.seq, 0)
+		return
+	}
+
+	// 稀疏文件由写入协程按数据区域写入
+	if info, err := file.Stat(); err == nil && isSparseFile(info) && info.Size() == header.Size {
+		item.file = file
+		p.budget.acquire(item.seq, 0)
+		return
+	}
+
+	if header.Size > tarPrefetchThreshold {
+		item.reserved = tarReadAheadBytes
+		p.budget.acquire(item.seq, item.reserved)
+		item.file = file
+		item.chunks = make(chan []byte, tarReadAheadDepth)
+		go p.readAhead(item)
+		return
+	}
+
+	// 小文件完整预读
+	defer file.Close()
+	if header.Size == 0 {
+		p.budget.acquire(item.seq, 0)
+		return
+	}
+	item.reserved = int64(1) << (tarPrefetchMinClass + prefetchClass(header.Size))
+	p.budget.acquire(item.seq, item.reserved)
+	buf := getPrefetchBuffer(header.Size)
+	if _, err := io.ReadFull(file, (*buf)[:header.Size]); err != nil {
+		putPrefetchBuffer(buf)
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			err = fmt.Errorf("源文件大小在打包过程中发生变化")
+		}
+		item.err = err
+		return
+	}
+	item.content = buf
+}
+
+// readAhead 顺序读取大文件内容到缓冲区，交给写入协程
+func (p *tarPipeline) readAhead(item *tarItem) {
+	defer close(item.chunks)
+
+	remaining := item.header.Size
+	for remaining > 0 {
+		buf := bufferPool.Get().([]byte)
+		n := int64(len(buf))
+		if remaining < n {
+			n = remaining
+		}
+		if _, err := io.ReadFull(item.file, buf[:n]); err != nil {
+			bufferPool.Put(buf)
+			if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+				err = fmt.Errorf("源文件大小在打包过程中发生变化")
+			}
+			item.readErr = err
+			return
+		}
+		select {
+		case item.chunks <- buf[:n]:
+		case <-p.stop:
+			bufferPool.Put(buf)
+			return
+		}
+		remaining -= n
+	}
+}
+
+// write 在写入协程中将准备好的条目写入 tar 包，返回写入的文件内容字节数
+// 稀疏文件的 header 和数据直接写入 tar 包底层的 w
+func (p *tarPipeline) write(tarWriter *tar.Writer, w io.Writer, item *tarItem) (int64, error) {
+	header := item.header
+
+	if item.file != nil && item.chunks == nil {
+		if segments, err := dataSegments(item.file, 0, header.Size); err == nil {
+			return writeSparseFileToTar(tarWriter, w, header, item.file, segments)
+		}
+	}
+
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return 0, fmt.Errorf("写入 tar header 失败: %w", err)
+	}
+
+	switch {
+	case item.content != nil:
+		n, err := tarWriter.Write((*item.content)[:header.Size])
+		if err != nil {
+			return int64(n), fmt.Errorf("写入文件内容失败: %w", err)
+		}
+		return int64(n), nil
+
+	case item.chunks != nil:
+		var written int64
+		var err error
+		for buf := range item.chunks {
+			if err == nil {
+				var n int
+				n, err = tarWriter.Write(buf)
+				written += int64(n)
+				if err != nil {
+					// 通知预读协程退出，继续取出剩余的缓冲区
+					p.abort()
+				}
+			}
+			bufferPool.Put(buf[:cap(buf)])
+		}
+		if err != nil {
+			return written, fmt.Errorf("写入文件内容失败: %w", err)
+		}
+		if item.readErr != nil {
+			return written, fmt.Errorf("读取文件内容失败: %w", item.readErr)
+		}
+		return written, nil
+
+	case item.file != nil:
+		// 不支持 SEEK_DATA 的稀疏文件按普通文件写入
+		bufPtr := tarBufferPool.Get().(*[]byte)
+		defer tarBufferPool.Put(bufPtr)
+		n, err := io.CopyBuffer(tarWriter, item.file, *bufPtr)
+		if err != nil {
+			return n, fmt.Errorf("流式写入文件内容失败: %w", err)
+		}
+		return n, nil
+	}
+	return 0, nil
+}
+
+// release 写入完成（或跳过）后释放条目占用的文件、缓冲区和预算
+func (p *tarPipeline) release(item *tarItem) {
+	if item.chunks != nil {
+		// 写入协程提前返回时取出剩余的缓冲区，确保预读协程退出
+		for buf := range item.chunks {
+			bufferPool.Put(buf[:cap(buf)])
+		}
+	}
+	if item.file != nil {
+		item.file.Close()
+	}
+	if item.content != nil {
+		putPrefetchBuffer(item.content)
+		item.content = nil
+	}
+	p.budget.release(item.reserved)
+}
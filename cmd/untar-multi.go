@@ -4,7 +4,10 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"archive/tar"
+	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -22,9 +25,11 @@ var untarMultiCmd = &cobra.Command{
 	Long: `并行解压由 tar-multi 命令生成的多个 tar 包到一个完整目录。
 
 支持的功能：
-- 自动检测源目录中的 part-*.tar 文件
+- 自动检测源目录中的 part-*.tar 文件（以及 .tar.zst、.tar.gz、.tar.lz4、.tar.xz、.tar.bz2）
+- 根据每个 tar 包开头的魔数自动识别压缩格式，压缩过的 tar 包由内置解码器解压后交给系统 tar 命令
 - 并行解压多个 tar 包，提高解压速度
 - 自动处理文件冲突（如果多个 tar 包包含相同文件，只解压一次）
+- 解压前校验条目路径，拒绝绝对路径、.. 路径以及经过符号链接的写入
 
 示例：
   p-tool untar-multi /output /dest
@@ -34,7 +39,13 @@ var untarMultiCmd = &cobra.Command{
 		sourceDir := args[0]
 		destDir := args[1]
 
-		useZstd, _ := cmd.Flags().GetBool("zstd")
+		unsafePaths, _ := cmd.Flags().GetBool("unsafe-paths")
+
+		compressFormat, err := decompressFormatFromFlags(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+			os.Exit(1)
+		}
 
 		// 验证源目录
 		sourceInfo, err := os.Stat(sourceDir)
@@ -68,25 +79,37 @@ var untarMultiCmd = &cobra.Command{
 		}
 
 		// 查找所有 tar 包文件
-		tarFiles, err := findTarFiles(absSourceDir, useZstd)
+		tarFiles, err := findTarFiles(absSourceDir)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "错误: 查找 tar 包失败: %v\n", err)
 			os.Exit(1)
 		}
 
 		if len(tarFiles) == 0 {
-			if useZstd {
-				fmt.Fprintf(os.Stderr, "错误: 在源目录中未找到 tar 包文件（part-*.tar.zst）\n")
-			} else {
-				fmt.Fprintf(os.Stderr, "错误: 在源目录中未找到 tar 包文件（part-*.tar）\n")
-			}
+			fmt.Fprintf(os.Stderr, "错误: 在源目录中未找到 tar 包文件（part-*%s）\n", strings.Join(partTarSuffixes, "、part-*"))
+			os.Exit(1)
+		}
+
+		// 识别每个 tar 包的压缩格式
+		formats, err := detectTarFormats(absSourceDir, tarFiles, compressFormat)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
 			os.Exit(1)
 		}
 
 		fmt.Fprintf(os.Stdout, "找到 %d 个 tar 包，开始并行解压...\n", len(tarFiles))
 
+		// 解压前校验所有 tar 包的条目路径，防止写出目标目录
+		if !unsafePaths {
+			fmt.Fprintf(os.Stdout, "正在校验 tar 包条目路径...\n")
+			if err := validateTarPaths(absSourceDir, tarFiles, formats); err != nil {
+				fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
 		// 并行解压多个 tar 包
-		if err := extractMultipleTarsParallel(absSourceDir, absDestDir, tarFiles, useZstd); err != nil {
+		if err := extractMultipleTarsParallel(absSourceDir, absDestDir, tarFiles, formats, unsafePaths); err != nil {
 			fmt.Fprintf(os.Stderr, "错误: 解压 tar 包失败: %v\n", err)
 			os.Exit(1)
 		}
@@ -99,11 +122,15 @@ func init() {
 	rootCmd.AddCommand(untarMultiCmd)
 
 	untarMultiCmd.Flags().Int("concurrency", 0, "保留参数（已弃用，系统 tar 命令不支持此参数）")
-	untarMultiCmd.Flags().Bool("zstd", false, "解压缩经过 zstd 压缩的 tar 包")
+	addDecompressFlags(untarMultiCmd)
+	untarMultiCmd.Flags().Bool("unsafe-paths", false, "关闭路径安全检查，允许绝对路径、.. 以及经过符号链接写入（不安全）")
 }
 
-// findTarFiles 查找源目录中的所有 part-*.tar 或 part-*.tar.zst 文件
-func findTarFiles(sourceDir string, useZstd bool) ([]string, error) {
+// partTarSuffixes tar-multi 生成的 tar 包可能的扩展名，实际的压缩格式根据魔数识别
+var partTarSuffixes = []string{".tar", ".tar.zst", ".tar.gz", ".tar.lz4", ".tar.xz", ".tar.bz2"}
+
+// findTarFiles 查找源目录中的所有 part-* tar 包文件（扩展名见 partTarSuffixes）
+func findTarFiles(sourceDir string) ([]string, error) {
 	entries, err := os.ReadDir(sourceDir)
 	if err != nil {
 		return nil, fmt.Errorf("无法读取源目录: %w", err)
@@ -111,15 +138,13 @@ func findTarFiles(sourceDir string, useZstd bool) ([]string, error) {
 
 	var tarFiles []string
 	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasPrefix(entry.Name(), "part-") {
-			if useZstd {
-				if strings.HasSuffix(entry.Name(), ".tar.zst") {
-					tarFiles = append(tarFiles, entry.Name())
-				}
-			} else {
-				if strings.HasSuffix(entry.Name(), ".tar") && !strings.HasSuffix(entry.Name(), ".tar.zst") {
-					tarFiles = append(tarFiles, entry.Name())
-				}
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), "part-") {
+			continue
+		}
+		for _, suffix := range partTarSuffixes {
+			if strings.HasSuffix(entry.Name(), suffix) {
+				tarFiles = append(tarFiles, entry.Name())
+				break
 			}
 		}
 	}
@@ -130,27 +155,136 @@ func findTarFiles(sourceDir string, useZstd bool) ([]string, error) {
 	return tarFiles, nil
 }
 
+// detectTarFormats 根据魔数识别每个 tar 包的压缩格式，不同 tar 包可以使用不同的格式
+func detectTarFormats(sourceDir string, tarFiles []string, format string) ([]string, error) {
+	formats := make([]string, len(tarFiles))
+	for i, filename := range tarFiles {
+		file, err := os.Open(filepath.Join(sourceDir, filename))
+		if err != nil {
+			return nil, err
+		}
+		formats[i], err = sniffCompressFormat(bufio.NewReaderSize(file, tarBlockSize), filename, format)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return formats, nil
+}
+
+// validateTarPaths 并行读取所有 tar 包的条目头，校验路径安全
+// 多个 tar 包并行解压时顺序不确定，因此任意 tar 包中的符号链接都会约束所有 tar 包的条目
+func validateTarPaths(sourceDir string, tarFiles, formats []string) error {
+	headers := make([][]*tar.Header, len(tarFiles))
+	errs := make([]error, len(tarFiles))
+	var wg sync.WaitGroup
+
+	for i, tarFile := range tarFiles {
+		wg.Add(1)
+		go func(index int, filename string) {
+			defer wg.Done()
+			headers[index], errs[index] = readTarHeaders(filepath.Join(sourceDir, filename), formats[index])
+		}(i, tarFile)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("读取 tar 包 %s 失败: %w", tarFiles[i], err)
+		}
+	}
+
+	// 先收集所有 tar 包中的符号链接，再逐个校验条目
+	guard := newPathGuard(false)
+	symlinkPart := make(map[string]int) // 符号链接路径 → 所在的 tar 包
+	for i, partHeaders := range headers {
+		for _, header := range partHeaders {
+			if header.Typeflag != tar.TypeSymlink {
+				continue
+			}
+			if relPath, err := guard.normalize(header.Name); err == nil {
+				guard.symlinks[relPath] = true
+				symlinkPart[relPath] = i
+			}
+		}
+	}
+
+	var unsafeEntries int
+	for i, partHeaders := range headers {
+		for _, header := range partHeaders {
+			relPath, err := guard.checkEntry(header)
+			// 另一个 tar 包中的同名符号链接可能先被创建，写入时会跟随该链接
+			if part, ok := symlinkPart[relPath]; err == nil && ok && part != i && header.Typeflag != tar.TypeSymlink {
+				err = fmt.Errorf("与 tar 包 %s 中的符号链接同名: %s", tarFiles[part], header.Name)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "错误: tar 包 %s 包含不安全的条目: %v\n", tarFiles[i], err)
+				unsafeEntries++
+			}
+		}
+	}
+
+	if unsafeEntries > 0 {
+		return fmt.Errorf("发现 %d 个不安全的条目，已拒绝解压（可使用 --unsafe-paths 跳过检查）", unsafeEntries)
+	}
+
+	return nil
+}
+
+// readTarHeaders 读取 tar 包中所有条目的 header（不保留内容）
+func readTarHeaders(tarFilePath, format string) ([]*tar.Header, error) {
+	file, err := os.Open(tarFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// 未压缩的 tar 包直接使用文件句柄，tar.Reader 可以通过 Seek 跳过文件内容
+	var reader io.Reader = file
+	if format != compressNone {
+		decoder, err := newDecompressReader(bufio.NewReaderSize(file, 1024*1024), format)
+		if err != nil {
+			return nil, err
+		}
+		defer decoder.Close()
+		reader = decoder
+	}
+
+	var headers []*tar.Header
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return headers, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取 tar header 失败: %w", err)
+		}
+		headers = append(headers, header)
+	}
+}
+
 // extractMultipleTarsParallel 并行解压多个 tar 包
-func extractMultipleTarsParallel(sourceDir, destDir string, tarFiles []string, useZstd bool) error {
+func extractMultipleTarsParallel(sourceDir, destDir string, tarFiles, formats []string, unsafePaths bool) error {
 	var failedTars int
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 
 	// 并行解压每个 tar 包
-	for _, tarFile := range tarFiles {
+	for i, tarFile := range tarFiles {
 		wg.Add(1)
-		go func(filename string) {
+		go func(filename, format string) {
 			defer wg.Done()
 
 			tarFilePath := filepath.Join(sourceDir, filename)
-			err := extractSingleTarWithSystemTar(tarFilePath, destDir, useZstd)
+			err := extractSingleTarWithSystemTar(tarFilePath, destDir, format, unsafePaths)
 			if err != nil {
 				mu.Lock()
 				fmt.Fprintf(os.Stderr, "错误: 解压 tar 包 %s 失败: %v\n", filename, err)
 				failedTars++
 				mu.Unlock()
 			}
-		}(tarFile)
+		}(tarFile, formats[i])
 	}
 
 	// 等待所有 tar 包解压完成
@@ -164,7 +298,8 @@ func extractMultipleTarsParallel(sourceDir, destDir string, tarFiles []string, u
 }
 
 // extractSingleTarWithSystemTar 使用系统 tar 命令解压单个 tar 包
-func extractSingleTarWithSystemTar(tarFilePath, destDir string, useZstd bool) error {
+// 压缩过的 tar 包由内置解码器解压后通过标准输入交给系统 tar，不依赖系统 tar 对压缩格式的支持
+func extractSingleTarWithSystemTar(tarFilePath, destDir, format string, unsafePaths bool) error {
 	// 获取 tar 文件的绝对路径
 	absTarFilePath, err := filepath.Abs(tarFilePath)
 	if err != nil {
@@ -183,15 +318,33 @@ func extractSingleTarWithSystemTar(tarFilePath, destDir string, useZstd bool) er
 	}
 
 	// 构建 tar 命令参数
-	// tar -xf tarfile.tar -C destdir -k [--zstd]
+	// tar -xf tarfile.tar -C destdir -k，压缩过的 tar 包使用 -xf - 从标准输入读取
 	// 使用 -k 选项保持现有文件不被覆盖（处理多个 tar 包可能包含相同文件的情况）
-	args := []string{"-xf", absTarFilePath, "-C", absDestDir, "-k"}
-	if useZstd {
-		args = append(args, "--zstd")
+	var stdin io.Reader
+	source := absTarFilePath
+	if format != compressNone {
+		file, err := os.Open(absTarFilePath)
+		if err != nil {
+			return fmt.Errorf("无法打开 tar 文件: %w", err)
+		}
+		defer file.Close()
+		decoder, err := newDecompressReader(bufio.NewReaderSize(file, 1024*1024), format)
+		if err != nil {
+			return err
+		}
+		defer decoder.Close()
+		stdin = decoder
+		source = "-"
+	}
+	args := []string{"-xf", source, "-C", absDestDir, "-k"}
+	// 关闭路径检查时保留绝对路径和 ..（-P / --absolute-names）
+	if unsafePaths {
+		args = append(args, "-P")
 	}
 
 	// 使用系统 tar 命令解压
 	cmd := exec.Command("tar", args...)
+	cmd.Stdin = stdin
 
 	// 执行命令并捕获输出
 	output, err := cmd.CombinedOutput()
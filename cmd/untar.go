@@ -11,12 +11,12 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/klauspost/compress/zstd"
 	"github.com/spf13/cobra"
 )
 
@@ -24,23 +24,63 @@ import (
 var untarCmd = &cobra.Command{
 	Use:   "untar <tar文件> <目标目录>",
 	Short: "并行解压 tar 包",
-	Long: `根据 tar 包内的 manifest 文件并行解压文件。
+	Long: `流式读取 tar 包并并行解压文件。
 
 支持的功能：
-- 自动读取 tar 包内的 manifest 文件
-- 并行写入文件，提高解压速度
+- 流式读取 tar 包，内存占用受 --max-buffer 限制，不随 tar 包大小增长
+- 小文件在内存中缓存后并行写入，大文件直接流式写入磁盘
+- 稀疏文件（GNU / PAX 稀疏格式）解压时重新形成空洞，不会把空洞写成零
+- 根据 tar 包内的 manifest 文件校验解压完整性；manifest 位于 tar 包开头时（新版本 tar 命令生成）
+  读到第一个条目就提前并行创建目录结构，打包时失败的文件（记录在 tar 包结尾）只给出提示；
+  同样接受 manifest 位于末尾的旧 tar 包
+- 拒绝绝对路径、.. 路径以及经过归档内符号链接的写入（可用 --unsafe-paths 关闭）
+- 使用 --atomic 时文件先写入临时文件再重命名，不会出现写了一半的文件，并自动清理上次中断遗留的临时文件
+- 使用 --fsync-mode=none|file|end|dir 或 --sync 控制持久化，同步阶段的耗时单独输出
+- 使用 --order largest-first 时写入协程优先写入已缓存的最大文件（其他顺序按 tar 包中的顺序写入）
+- 根据文件开头的魔数自动识别压缩格式（zstd、gzip、lz4、xz、bzip2 或未压缩），
+  --compress 指定的格式与实际不一致时给出警告并使用识别出的格式
 - 显示解压进度
 
 示例：
   p-tool untar output.tar /dest
-  p-tool untar output.tar /dest --concurrency 8`,
+  p-tool untar output.tar /dest --concurrency 8
+  p-tool untar output.tar.gz /dest
+  p-tool untar output.tar /dest --max-buffer 2GB
+  p-tool untar output.tar /dest --atomic
+  p-tool untar output.tar /dest --sync
+  p-tool untar output.tar /dest --order largest-first`,
 	Args: cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		tarFile := args[0]
 		destDir := args[1]
 
 		concurrency, _ := cmd.Flags().GetInt("concurrency")
-		useZstd, _ := cmd.Flags().GetBool("zstd")
+		maxBufferStr, _ := cmd.Flags().GetString("max-buffer")
+		unsafePaths, _ := cmd.Flags().GetBool("unsafe-paths")
+		atomicWrite, _ := cmd.Flags().GetBool("atomic")
+
+		dur, err := durabilityFromFlags(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+			os.Exit(1)
+		}
+		order, err := orderFromFlags(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+			os.Exit(1)
+		}
+		compressFormat, err := decompressFormatFromFlags(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+			os.Exit(1)
+		}
+
+		// 解析内存预算
+		maxBuffer, err := parseByteSize(maxBufferStr)
+		if err != nil || maxBuffer <= 0 {
+			fmt.Fprintf(os.Stderr, "错误: 无效的 --max-buffer 参数: %s\n", maxBufferStr)
+			os.Exit(1)
+		}
 
 		// 验证 tar 文件
 		tarInfo, err := os.Stat(tarFile)
@@ -71,14 +111,31 @@ var untarCmd = &cobra.Command{
 			concurrency = runtime.NumCPU()
 		}
 
+		// 清理上次中断遗留的临时文件
+		if atomicWrite {
+			removed, err := removeAtomicTempFiles(absDestDir, concurrency)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "警告: 清理临时文件失败: %v\n", err)
+			} else if removed > 0 {
+				fmt.Fprintf(os.Stdout, "已清理上次中断遗留的 %d 个临时文件\n", removed)
+			}
+		}
+
 		fmt.Fprintf(os.Stdout, "开始解压 tar 包（并发数: %d）...\n", concurrency)
 
 		// 并行解压 tar 包
-		if err := extractTarParallel(tarFile, absDestDir, concurrency, useZstd); err != nil {
+		extracted, err := extractTarParallel(tarFile, absDestDir, concurrency, compressFormat, maxBuffer, unsafePaths, atomicWrite, dur, order)
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "错误: 解压 tar 包失败: %v\n", err)
 			os.Exit(1)
 		}
 
+		// 同步到磁盘
+		if err := dur.finish(absDestDir, dirsToSync(absDestDir, extracted), concurrency); err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+			os.Exit(1)
+		}
+
 		fmt.Fprintf(os.Stdout, "\n解压完成！\n")
 	},
 }
@@ -87,7 +144,12 @@ func init() {
 	rootCmd.AddCommand(untarCmd)
 
 	untarCmd.Flags().Int("concurrency", 0, "指定并发数量，默认为 CPU 核数")
-	untarCmd.Flags().Bool("zstd", false, "解压缩经过 zstd 压缩的 tar 包")
+	addDecompressFlags(untarCmd)
+	untarCmd.Flags().String("max-buffer", "512MB", "解压时缓存在内存中的文件内容上限（如 512MB、2GB）")
+	untarCmd.Flags().Bool("unsafe-paths", false, "关闭路径安全检查，允许绝对路径、.. 以及经过符号链接写入（不安全）")
+	untarCmd.Flags().Bool("atomic", false, "先写入同目录的临时文件 .<文件名>.ptool-tmp，完成后再重命名到目标路径")
+	addFsyncFlags(untarCmd)
+	addOrderFlag(untarCmd)
 }
 
 // 缓冲区池，用于复用大缓冲区
@@ -97,164 +159,231 @@ var bufferPool = sync.Pool{
 	},
 }
 
+// untarStreamThreshold 超过该大小的文件不进入内存队列，直接由读取协程流式写入磁盘
+const untarStreamThreshold = 8 * 1024 * 1024
+
 // fileEntry 存储从 tar 包中读取的文件数据
 type fileEntry struct {
+	relPath string
 	header  *tar.Header
 	content []byte
-	err     error
 }
 
-// extractTarParallel 并行解压 tar 包
-func extractTarParallel(tarFile, destDir string, concurrency int, useZstd bool) error {
-	// 打开 tar 文件
-	tarFileHandle, err := os.Open(tarFile)
-	if err != nil {
-		return fmt.Errorf("无法打开 tar 文件: %w", err)
-	}
-	defer tarFileHandle.Close()
+// memoryBudget 限制同时缓存在内存中的文件内容总字节数
+type memoryBudget struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int64
+	used  int64
+}
 
-	// 创建带缓冲的 reader 提高性能（使用1MB缓冲区）
-	bufferedReader := bufio.NewReaderSize(tarFileHandle, 1024*1024)
+// newMemoryBudget 创建一个容量为 limit 字节的内存预算
+func newMemoryBudget(limit int64) *memoryBudget {
+	b := &memoryBudget{limit: limit}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
 
-	// 根据 useZstd 标志决定是否使用 zstd 解压缩
-	var reader io.Reader = bufferedReader
-	if useZstd {
-		zstdDecoder, err := zstd.NewReader(bufferedReader)
-		if err != nil {
-			return fmt.Errorf("创建 zstd 解码器失败: %w", err)
-		}
-		defer zstdDecoder.Close()
-		reader = zstdDecoder
+// acquire 申请 n 字节的预算，预算不足时阻塞等待
+// 当前没有任何占用时总是允许申请，避免单个超过预算的条目造成死锁
+func (b *memoryBudget) acquire(n int64) {
+	b.mu.Lock()
+	for b.used > 0 && b.used+n > b.limit {
+		b.cond.Wait()
 	}
+	b.used += n
+	b.mu.Unlock()
+}
 
-	tarReader := tar.NewReader(reader)
+// release 归还 n 字节的预算
+func (b *memoryBudget) release(n int64) {
+	b.mu.Lock()
+	b.used -= n
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
 
-	// 第一步：读取所有文件数据到内存，并找到 manifest 文件
-	fileDataMap := make(map[string]*fileEntry)
-	var manifestContent []byte
-	manifestName := ".__p-tool-manifest__.txt"
+// pathTracker 记录已交给写入协程但尚未写完的文件路径，每个路径同时计入它的所有上级目录
+// 读取协程直接创建或替换条目之前等待同一路径（以及该路径下）排队的文件写完，
+// 否则写入协程稍后打开文件时可能跟随刚创建的符号链接写到目标目录之外；
+// 同一路径的多个条目也因此按 tar 包中的顺序写入
+type pathTracker struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	counts map[string]int
+}
 
-	fmt.Fprintf(os.Stdout, "正在读取 tar 包内容...\n")
+// newPathTracker 创建路径跟踪器
+func newPathTracker() *pathTracker {
+	t := &pathTracker{counts: make(map[string]int)}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
 
-	for {
-		header, err := tarReader.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("读取 tar header 失败: %w", err)
+// ancestors 依次对 relPath 及其每一级上级目录调用 fn
+func (t *pathTracker) ancestors(relPath string, fn func(p string)) {
+	for p := relPath; ; {
+		fn(p)
+		i := strings.LastIndexByte(p, '/')
+		if i < 0 {
+			return
 		}
+		p = p[:i]
+	}
+}
 
-		// 规范化路径（移除 ./ 前缀，统一使用斜杠）
-		var normalizedPath string
-		if strings.HasPrefix(header.Name, "./") {
-			normalizedPath = header.Name[2:]
-		} else {
-			normalizedPath = header.Name
-		}
-		// 只在非 Unix 系统上转换路径分隔符
-		if filepath.Separator != '/' {
-			normalizedPath = filepath.ToSlash(normalizedPath)
-		}
+// add 记录 relPath 已入队
+func (t *pathTracker) add(relPath string) {
+	t.mu.Lock()
+	t.ancestors(relPath, func(p string) { t.counts[p]++ })
+	t.mu.Unlock()
+}
 
-		// 检查是否是 manifest 文件
-		if normalizedPath == manifestName || strings.HasSuffix(normalizedPath, manifestName) {
-			// 读取 manifest 内容
-			manifestContent, err = io.ReadAll(tarReader)
-			if err != nil {
-				return fmt.Errorf("读取 manifest 文件失败: %w", err)
-			}
-			continue
+// done 记录 relPath 已写入完成（无论成功与否）
+func (t *pathTracker) done(relPath string) {
+	t.mu.Lock()
+	t.ancestors(relPath, func(p string) {
+		if t.counts[p]--; t.counts[p] == 0 {
+			delete(t.counts, p)
 		}
+	})
+	t.mu.Unlock()
+	t.cond.Broadcast()
+}
 
-		// 读取文件内容（目录没有内容）
-		var content []byte
-		if header.Typeflag == tar.TypeReg {
-			// 使用缓冲区池优化大文件读取
-			if header.Size > 0 && header.Size < 10*1024*1024 {
-				// 小文件直接分配
-				content = make([]byte, header.Size)
-				if _, err := io.ReadFull(tarReader, content); err != nil {
-					return fmt.Errorf("读取文件内容失败 %s: %w", normalizedPath, err)
-				}
-			} else {
-				// 大文件使用缓冲区池
-				buf := bufferPool.Get().([]byte)
-				defer bufferPool.Put(buf)
-				content, err = readAllOptimized(tarReader, buf)
-				if err != nil {
-					return fmt.Errorf("读取文件内容失败 %s: %w", normalizedPath, err)
-				}
-			}
-		} else {
-			// 对于非普通文件（如目录、符号链接等），跳过内容读取
-			if _, err := io.Copy(io.Discard, tarReader); err != nil {
-				return fmt.Errorf("跳过文件内容失败 %s: %w", normalizedPath, err)
-			}
-		}
+// wait 等待 relPath 以及 relPath 下所有已入队的文件写入完成
+func (t *pathTracker) wait(relPath string) {
+	t.mu.Lock()
+	for t.counts[relPath] > 0 {
+		t.cond.Wait()
+	}
+	t.mu.Unlock()
+}
+
+// countingReader 统计已读取的字节数，用于计算解压进度
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
 
-		// 存储文件数据
-		fileDataMap[normalizedPath] = &fileEntry{
-			header:  header,
-			content: content,
+// parseByteSize 解析带单位的字节数，例如 512MB、1G、64KiB、1048576
+func parseByteSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	if str == "" {
+		return 0, fmt.Errorf("大小不能为空")
+	}
+
+	// 去掉可选的 B / IB 后缀，统一按 1024 进制计算
+	str = strings.TrimSuffix(str, "B")
+	str = strings.TrimSuffix(str, "I")
+
+	multiplier := int64(1)
+	if n := len(str); n > 0 {
+		switch str[n-1] {
+		case 'K':
+			multiplier = 1024
+		case 'M':
+			multiplier = 1024 * 1024
+		case 'G':
+			multiplier = 1024 * 1024 * 1024
+		case 'T':
+			multiplier = 1024 * 1024 * 1024 * 1024
+		}
+		if multiplier > 1 {
+			str = str[:n-1]
 		}
 	}
 
-	// 检查是否找到 manifest 文件
-	if manifestContent == nil {
-		return fmt.Errorf("未找到 manifest 文件（%s），无法并行解压", manifestName)
+	value, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("无效的大小: %s", s)
 	}
+	return int64(value * float64(multiplier)), nil
+}
 
-	// 解析 manifest 文件，获取文件列表
-	fileList, err := parseManifestContent(manifestContent)
+// extractTarParallel 流式并行解压 tar 包
+// 读取协程顺序读取 tar 流，小文件在内存预算内缓存后交给写入协程并行落盘，
+// 大文件则直接从 tar 流写入磁盘，整个过程不会把整个 tar 包读入内存
+// compressFormat 为 auto 时根据魔数识别压缩格式，指定的格式与魔数不一致时以魔数为准
+// atomicWrite 为 true 时文件先写入临时文件再重命名到目标路径，dur 指定每个文件写入后是否 fsync
+// order 为 largest-first 时写入协程优先处理已缓存的最大文件
+// 返回成功解压的条目路径（用于同步目录）
+func extractTarParallel(tarFile, destDir string, concurrency int, compressFormat string, maxBuffer int64, unsafePaths, atomicWrite bool, dur *durability, order string) ([]string, error) {
+	// 打开 tar 文件
+	tarFileHandle, err := os.Open(tarFile)
 	if err != nil {
-		return fmt.Errorf("解析 manifest 文件失败: %w", err)
+		return nil, fmt.Errorf("无法打开 tar 文件: %w", err)
 	}
+	defer tarFileHandle.Close()
 
-	if len(fileList) == 0 {
-		return fmt.Errorf("manifest 文件为空")
+	// 获取 tar 文件大小，用于按已读取字节数估算进度
+	var tarSize int64
+	if info, err := tarFileHandle.Stat(); err == nil {
+		tarSize = info.Size()
 	}
+	counter := &countingReader{r: tarFileHandle}
 
-	fmt.Fprintf(os.Stdout, "找到 %d 个文件，开始并行解压...\n", len(fileList))
+	// 创建带缓冲的 reader 提高性能（使用1MB缓冲区）
+	bufferedReader := bufio.NewReaderSize(counter, 1024*1024)
 
-	// 预创建所有需要的目录，减少并发时的锁竞争
-	fmt.Fprintf(os.Stdout, "正在预创建目录结构...\n")
-	dirSet := make(map[string]bool)
-	for _, relPath := range fileList {
-		entry, exists := fileDataMap[relPath]
-		if !exists {
-			continue
-		}
-		dir := filepath.Dir(relPath)
-		for dir != "." && dir != "/" && dir != "" {
-			dirSet[dir] = true
-			dir = filepath.Dir(dir)
-		}
-		// 对于目录类型的条目，也需要创建
-		if entry.header.Typeflag == tar.TypeDir {
-			dirSet[relPath] = true
-		}
+	// 根据文件开头的魔数识别压缩格式并解压缩
+	compressFormat, err = sniffCompressFormat(bufferedReader, tarFile, compressFormat)
+	if err != nil {
+		return nil, err
+	}
+	if compressFormat != compressNone {
+		fmt.Fprintf(os.Stdout, "压缩格式: %s\n", compressFormat)
+	}
+	reader, err := newDecompressReader(bufferedReader, compressFormat)
+	if err != nil {
+		return nil, err
 	}
+	defer reader.Close()
 
-	// 批量创建目录
-	for dir := range dirSet {
-		targetDir := filepath.Join(destDir, dir)
-		if err := os.MkdirAll(targetDir, 0755); err != nil {
-			return fmt.Errorf("预创建目录失败 %s: %w", targetDir, err)
-		}
+	tarReader := tar.NewReader(reader)
+
+	// manifest 在新格式 tar 包中是第一个条目，旧格式 tar 包中是最后一个条目（且没有结尾记录）
+	var manifestEntries []ManifestEntry
+	var footerEntries []ManifestEntry
+	var manifestFound, footerFound, manifestFirst bool
+	var entryCount int64
+
+	// 超过流式阈值或超过整个内存预算的文件直接流式写入
+	streamThreshold := int64(untarStreamThreshold)
+	if maxBuffer < streamThreshold {
+		streamThreshold = maxBuffer
 	}
+	budget := newMemoryBudget(maxBuffer)
+	guard := newPathGuard(unsafePaths)
 
-	// 第二步：根据 manifest 文件列表并行写入文件
-	totalFiles := int64(len(fileList))
 	var processedFiles int64
 	var failedFiles int64
-
 	startTime := time.Now()
 
-	// 创建任务通道和数据通道
-	taskChan := make(chan string, concurrency*2)
+	// 已成功写入的文件，用于最后与 manifest 核对
+	var extracted sync.Map
+	// 目录缓存，避免重复创建目录
+	dirCache := sync.Map{}
+	// 目录的权限和时间在最后统一设置，避免目录只读或时间被后续写入覆盖
+	var dirHeaders []*fileEntry
 
+	taskQueue := newFileEntryQueue(concurrency*2, order)
 	var wg sync.WaitGroup
+	var pending sync.WaitGroup // 已入队但尚未写入完成的文件
+	queued := newPathTracker() // 已入队但尚未写入完成的文件路径
+	// drainQueue 在读取协程直接写入条目之前调用：largest-first 会重新排列队列中的文件，
+	// 先等队列写完，保证直接写入的条目与之前的文件仍按 tar 包中的顺序落盘
+	drainQueue := func() {
+		if order == orderLargestFirst {
+			pending.Wait()
+		}
+	}
 	var mu sync.Mutex
 
 	// 启动进度更新协程
@@ -265,140 +394,309 @@ func extractTarParallel(tarFile, destDir string, concurrency int, useZstd bool)
 		for {
 			select {
 			case <-ticker.C:
-				updateUntarProgressWithTotal(atomic.LoadInt64(&processedFiles), totalFiles, startTime)
+				updateUntarProgress(atomic.LoadInt64(&processedFiles), atomic.LoadInt64(&counter.n), tarSize, startTime)
 			case <-progressDone:
 				return
 			}
 		}
 	}()
 
-	// 启动文件写入工作协程（并行写入文件）
+	// reportFailure 记录写入失败的文件
+	reportFailure := func(relPath string, err error) {
+		mu.Lock()
+		fmt.Fprintf(os.Stderr, "警告: 写入文件失败 %s: %v\n", relPath, err)
+		mu.Unlock()
+		atomic.AddInt64(&failedFiles, 1)
+	}
+
+	// 启动文件写入工作协程（并行写入内存中的小文件）
 	for i := 0; i < concurrency; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for relPath := range taskChan {
-				entry, exists := fileDataMap[relPath]
-				if !exists {
-					mu.Lock()
-					fmt.Fprintf(os.Stderr, "警告: manifest 中列出的文件在 tar 包中不存在: %s\n", relPath)
-					mu.Unlock()
-					atomic.AddInt64(&failedFiles, 1)
-					atomic.AddInt64(&processedFiles, 1)
-					continue
+			for {
+				entry, ok := taskQueue.pop()
+				if !ok {
+					return
 				}
-
-				if err := writeFileEntry(destDir, relPath, entry); err != nil {
-					mu.Lock()
-					fmt.Fprintf(os.Stderr, "警告: 写入文件失败 %s: %v\n", relPath, err)
-					mu.Unlock()
-					atomic.AddInt64(&failedFiles, 1)
-					atomic.AddInt64(&processedFiles, 1)
-					continue
+				err := ensureParentDir(destDir, entry.relPath, &dirCache)
+				if err == nil {
+					err = writeFileEntry(destDir, entry.relPath, entry, atomicWrite, dur)
 				}
-
+				if err != nil {
+					reportFailure(entry.relPath, err)
+				} else {
+					extracted.Store(entry.relPath, true)
+				}
+				budget.release(int64(len(entry.content)))
 				atomic.AddInt64(&processedFiles, 1)
+				queued.done(entry.relPath)
+				pending.Done()
 			}
 		}()
 	}
 
-	// 发送任务
-	for _, relPath := range fileList {
-		taskChan <- relPath
-	}
-	close(taskChan)
+	// 读取协程：顺序读取 tar 流并分发
+	readErr := func() error {
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("读取 tar header 失败: %w", err)
+			}
+
+			// 规范化并校验路径（拒绝绝对路径、.. 以及经过符号链接的写入）
+			normalizedPath, err := guard.prepareEntry(destDir, header)
+			if err != nil {
+				mu.Lock()
+				fmt.Fprintf(os.Stderr, "警告: 跳过不安全的条目: %v\n", err)
+				mu.Unlock()
+				atomic.AddInt64(&failedFiles, 1)
+				atomic.AddInt64(&processedFiles, 1)
+				continue
+			}
+
+			entryCount++
+
+			// 检查是否是 manifest 文件
+			if normalizedPath == tarManifestName || strings.HasSuffix(normalizedPath, tarManifestName) {
+				manifestEntries, _, err = parseManifest(tarReader)
+				if err != nil {
+					return fmt.Errorf("读取 manifest 文件失败: %w", err)
+				}
+				manifestFound = true
+				manifestFirst = entryCount == 1
+				if manifestFirst && !unsafePaths {
+					// 文件列表已知，在读取后续条目的同时提前并行创建目录结构
+					if err := precreateDirectories(destDir, safeManifestEntries(manifestEntries), concurrency); err != nil {
+						mu.Lock()
+						fmt.Fprintf(os.Stderr, "警告: 预创建目录失败，将按需创建: %v\n", err)
+						mu.Unlock()
+					}
+				}
+				continue
+			}
+
+			// 检查是否是结尾记录（打包时失败的文件）
+			if normalizedPath == tarFooterName || strings.HasSuffix(normalizedPath, tarFooterName) {
+				footerEntries, _, err = parseManifest(tarReader)
+				if err != nil {
+					return fmt.Errorf("读取结尾记录失败: %w", err)
+				}
+				footerFound = true
+				continue
+			}
+
+			switch header.Typeflag {
+			case tar.TypeReg, tar.TypeGNUSparse:
+				sparse := isSparseHeader(header)
+				// 同一路径之前的条目写完后才能写入，保持 tar 包中的先后顺序
+				queued.wait(normalizedPath)
+				if header.Size <= streamThreshold && !sparse {
+					// 小文件：申请内存预算后读入内存，交给写入协程
+					budget.acquire(header.Size)
+					content := make([]byte, header.Size)
+					if _, err := io.ReadFull(tarReader, content); err != nil {
+						budget.release(header.Size)
+						return fmt.Errorf("读取文件内容失败 %s: %w", normalizedPath, err)
+					}
+					pending.Add(1)
+					queued.add(normalizedPath)
+					taskQueue.push(&fileEntry{relPath: normalizedPath, header: header, content: content})
+					continue
+				}
+
+				// 大文件和稀疏文件：直接从 tar 流写入磁盘
+				drainQueue()
+				err := ensureParentDir(destDir, normalizedPath, &dirCache)
+				if err == nil {
+					err = streamFileEntry(destDir, normalizedPath, header, tarReader, atomicWrite, dur, sparse)
+				}
+				if err != nil {
+					// 未读完的内容由 tarReader.Next() 跳过，继续解压后续条目
+					reportFailure(normalizedPath, err)
+				} else {
+					extracted.Store(normalizedPath, true)
+				}
+
+			case tar.TypeDir:
+				targetDir := filepath.Join(destDir, normalizedPath)
+				if err := os.MkdirAll(targetDir, 0755); err != nil {
+					reportFailure(normalizedPath, err)
+				} else {
+					dirCache.Store(targetDir, true)
+					dirHeaders = append(dirHeaders, &fileEntry{relPath: normalizedPath, header: header})
+					extracted.Store(normalizedPath, true)
+				}
+
+			case tar.TypeLink:
+				// 硬链接需要等待目标文件写入完成
+				pending.Wait()
+				fallthrough
+
+			default:
+				// 符号链接、硬链接等无内容条目直接在读取协程中创建，
+				// 先等待同一路径及其下排队的文件写完，写入协程不会再经过新建的符号链接写入
+				queued.wait(normalizedPath)
+				drainQueue()
+				entry := &fileEntry{relPath: normalizedPath, header: header}
+				err := ensureParentDir(destDir, normalizedPath, &dirCache)
+				if err == nil {
+					err = writeFileEntry(destDir, normalizedPath, entry, atomicWrite, dur)
+				}
+				if err != nil {
+					reportFailure(normalizedPath, err)
+				} else {
+					extracted.Store(normalizedPath, true)
+				}
+			}
+			atomic.AddInt64(&processedFiles, 1)
+		}
+	}()
+
+	taskQueue.close()
 
 	// 等待所有写入协程完成
 	wg.Wait()
 
+	// 最后设置目录的权限和时间（从深到浅，避免子目录操作影响父目录时间）
+	for i := len(dirHeaders) - 1; i >= 0; i-- {
+		applyEntryMetadata(filepath.Join(destDir, dirHeaders[i].relPath), dirHeaders[i].header)
+	}
+
 	// 停止进度更新协程
 	close(progressDone)
 	time.Sleep(120 * time.Millisecond)
 
 	// 显示最终进度
-	updateUntarProgressWithTotal(atomic.LoadInt64(&processedFiles), totalFiles, startTime)
+	updateUntarProgress(atomic.LoadInt64(&processedFiles), atomic.LoadInt64(&counter.n), tarSize, startTime)
+
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	// 根据 manifest 核对是否所有文件都已解压（打包时就失败的文件不在 tar 包中，只给出提示）
+	if !manifestFound {
+		fmt.Fprintf(os.Stderr, "警告: 未找到 manifest 文件（%s），无法校验解压完整性\n", tarManifestName)
+	} else {
+		failedAtTar := make(map[string]bool, len(footerEntries))
+		for i := range footerEntries {
+			failedAtTar[footerEntries[i].Path] = true
+		}
+		if len(footerEntries) > 0 {
+			fmt.Fprintf(os.Stderr, "警告: 有 %d 个文件在打包时失败，没有写入 tar 包:\n", len(footerEntries))
+			for i := range footerEntries {
+				fmt.Fprintf(os.Stderr, "  %s\n", footerEntries[i].Path)
+			}
+		}
+		if manifestFirst && !footerFound {
+			fmt.Fprintf(os.Stderr, "警告: tar 包缺少结尾记录（%s），打包过程可能没有正常完成\n", tarFooterName)
+		}
+		for i := range manifestEntries {
+			relPath := manifestEntries[i].Path
+			if failedAtTar[relPath] {
+				continue
+			}
+			if _, ok := extracted.Load(relPath); !ok {
+				fmt.Fprintf(os.Stderr, "警告: manifest 中列出的文件未能解压: %s\n", relPath)
+				failedFiles++
+			}
+		}
+	}
 
 	if failedFiles > 0 {
-		return fmt.Errorf("有 %d 个文件解压失败", failedFiles)
+		return nil, fmt.Errorf("有 %d 个文件解压失败", failedFiles)
 	}
 
-	return nil
+	var extractedPaths []string
+	extracted.Range(func(key, value interface{}) bool {
+		extractedPaths = append(extractedPaths, key.(string))
+		return true
+	})
+	return extractedPaths, nil
 }
 
-// parseManifestContent 解析 manifest 文件内容，返回文件相对路径列表
-func parseManifestContent(content []byte) ([]string, error) {
-	// 预分配容量，减少重新分配
-	lines := strings.Split(string(content), "\n")
-	fileList := make([]string, 0, len(lines))
+// ensureParentDir 确保条目的父目录存在（使用缓存避免重复创建）
+func ensureParentDir(destDir, relPath string, dirCache *sync.Map) error {
+	dir := filepath.Dir(filepath.Join(destDir, relPath))
+	if _, exists := dirCache.Load(dir); exists {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("创建目录失败 %s: %w", dir, err)
+	}
+	dirCache.Store(dir, true)
+	return nil
+}
 
-	for _, line := range lines {
-		// 快速跳过空行
-		if len(line) == 0 {
+// safeManifestEntries 返回路径安全（相对路径且不越过目标目录）的条目，路径已规范化
+// 用于根据 tar 包开头的 manifest 预创建目录，不安全的路径交给逐个条目的校验处理
+func safeManifestEntries(entries []ManifestEntry) []ManifestEntry {
+	safe := make([]ManifestEntry, 0, len(entries))
+	for i := range entries {
+		relPath, err := sanitizeEntryPath(entries[i].Path)
+		if err != nil || relPath == "" {
 			continue
 		}
+		safe = append(safe, ManifestEntry{Path: relPath})
+	}
+	return safe
+}
 
-		// 去除前后空白
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
+// streamFileEntry 将 tar 流中的大文件直接写入磁盘
+// sparse 为 true 时跳过全零块，在目标文件中重新形成空洞
+func streamFileEntry(destDir, relPath string, header *tar.Header, r io.Reader, atomicWrite bool, dur *durability, sparse bool) error {
+	targetPath := filepath.Join(destDir, relPath)
 
-		// 移除开头的 ./
-		var normalizedPath string
-		if strings.HasPrefix(line, "./") {
-			normalizedPath = line[2:]
-		} else {
-			normalizedPath = line
-		}
+	outFile, err := createOutputFile(targetPath, os.FileMode(header.Mode), atomicWrite)
+	if err != nil {
+		return fmt.Errorf("创建文件失败 %s: %w", targetPath, err)
+	}
 
-		// 统一使用斜杠（只在需要时转换）
-		if filepath.Separator != '/' {
-			normalizedPath = filepath.ToSlash(normalizedPath)
-		}
+	// 从缓冲区池获取缓冲区
+	buf := bufferPool.Get().([]byte)
+	defer bufferPool.Put(buf)
 
-		fileList = append(fileList, normalizedPath)
+	var w io.Writer = outFile
+	var holes *sparseWriter
+	if sparse {
+		holes = &sparseWriter{f: outFile.File}
+		w = holes
 	}
-	return fileList, nil
-}
-
-// readAllOptimized 使用缓冲区池优化的大文件读取函数
-func readAllOptimized(r io.Reader, buf []byte) ([]byte, error) {
-	// 预分配容量，减少重新分配
-	var result []byte
-	bufSize := len(buf)
 
-	// 先读取一次，估算大小
-	n, err := r.Read(buf)
-	if n > 0 {
-		result = make([]byte, 0, bufSize*2) // 预分配容量
-		result = append(result, buf[:n]...)
+	if _, err := io.CopyBuffer(w, r, buf); err != nil {
+		outFile.abort()
+		return fmt.Errorf("写入文件内容失败 %s: %w", targetPath, err)
 	}
-	if err == io.EOF {
-		return result, nil
+	if holes != nil {
+		if err := holes.finish(); err != nil {
+			outFile.abort()
+			return fmt.Errorf("设置文件大小失败 %s: %w", targetPath, err)
+		}
 	}
-	if err != nil {
-		return nil, err
+	if err := outFile.commit(dur); err != nil {
+		return fmt.Errorf("%s: %w", targetPath, err)
 	}
 
-	// 继续读取剩余数据
-	for {
-		n, err := r.Read(buf)
-		if n > 0 {
-			result = append(result, buf[:n]...)
-		}
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, err
-		}
-	}
+	applyEntryMetadata(targetPath, header)
+	return nil
+}
 
-	return result, nil
+// applyEntryMetadata 设置文件或目录的权限和时间（失败不影响解压）
+func applyEntryMetadata(targetPath string, header *tar.Header) {
+	if err := os.Chmod(targetPath, os.FileMode(header.Mode)); err != nil {
+		// 权限设置失败不影响解压
+	}
+	if err := os.Chtimes(targetPath, header.AccessTime, header.ModTime); err != nil {
+		// 时间设置失败不影响解压
+	}
 }
 
 // writeFileEntry 写入单个文件条目到目标目录
-func writeFileEntry(destDir, relPath string, entry *fileEntry) error {
+// atomicWrite 为 true 时普通文件先写入临时文件再重命名到目标路径，dur 指定写入后是否 fsync
+func writeFileEntry(destDir, relPath string, entry *fileEntry, atomicWrite bool, dur *durability) error {
 	// 构建目标文件路径
 	targetPath := filepath.Join(destDir, relPath)
 
@@ -406,10 +704,10 @@ func writeFileEntry(destDir, relPath string, entry *fileEntry) error {
 	switch entry.header.Typeflag {
 	case tar.TypeReg:
 		// 普通文件
-		// 目录已在预创建阶段创建，这里不需要再创建
+		// 父目录已由调用方创建，这里不需要再创建
 
-		// 创建文件（使用 O_EXCL 避免不必要的检查）
-		outFile, err := os.OpenFile(targetPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(entry.header.Mode))
+		// 创建文件
+		outFile, err := createOutputFile(targetPath, os.FileMode(entry.header.Mode), atomicWrite)
 		if err != nil {
 			return fmt.Errorf("创建文件失败 %s: %w", targetPath, err)
 		}
@@ -419,47 +717,37 @@ func writeFileEntry(destDir, relPath string, entry *fileEntry) error {
 			// 大文件使用缓冲写入
 			writer := bufio.NewWriterSize(outFile, 1024*1024)
 			if _, err := writer.Write(entry.content); err != nil {
-				outFile.Close()
+				outFile.abort()
 				return fmt.Errorf("写入文件内容失败 %s: %w", targetPath, err)
 			}
 			if err := writer.Flush(); err != nil {
-				outFile.Close()
+				outFile.abort()
 				return fmt.Errorf("刷新缓冲区失败 %s: %w", targetPath, err)
 			}
 		} else {
 			// 小文件直接写入，减少缓冲开销
 			if _, err := outFile.Write(entry.content); err != nil {
-				outFile.Close()
+				outFile.abort()
 				return fmt.Errorf("写入文件内容失败 %s: %w", targetPath, err)
 			}
 		}
 
 		// 设置文件权限和时间（延迟到关闭文件后，减少系统调用）
-		outFile.Close()
-
-		// 使用单个系统调用设置权限和时间（如果可能）
-		if err := os.Chmod(targetPath, os.FileMode(entry.header.Mode)); err != nil {
-			// 权限设置失败不影响解压，只记录警告
-		}
-		if err := os.Chtimes(targetPath, entry.header.AccessTime, entry.header.ModTime); err != nil {
-			// 时间设置失败不影响解压，只记录警告
+		if err := outFile.commit(dur); err != nil {
+			return fmt.Errorf("%s: %w", targetPath, err)
 		}
+		applyEntryMetadata(targetPath, entry.header)
 
 	case tar.TypeDir:
 		// 目录
 		if err := os.MkdirAll(targetPath, os.FileMode(entry.header.Mode)); err != nil {
 			return fmt.Errorf("创建目录失败 %s: %w", targetPath, err)
 		}
-		if err := os.Chmod(targetPath, os.FileMode(entry.header.Mode)); err != nil {
-			// 权限设置失败不影响解压
-		}
-		if err := os.Chtimes(targetPath, entry.header.AccessTime, entry.header.ModTime); err != nil {
-			// 时间设置失败不影响解压
-		}
+		applyEntryMetadata(targetPath, entry.header)
 
 	case tar.TypeSymlink:
 		// 符号链接
-		// 目录已在预创建阶段创建，这里不需要再创建
+		// 父目录已由调用方创建，这里不需要再创建
 
 		if err := os.Symlink(entry.header.Linkname, targetPath); err != nil {
 			// 如果符号链接已存在，尝试删除后重新创建
@@ -477,7 +765,7 @@ func writeFileEntry(destDir, relPath string, entry *fileEntry) error {
 
 	case tar.TypeLink:
 		// 硬链接
-		// 目录已在预创建阶段创建，这里不需要再创建
+		// 父目录已由调用方创建，这里不需要再创建
 
 		linkTarget := filepath.Join(destDir, entry.header.Linkname)
 		if err := os.Link(linkTarget, targetPath); err != nil {
@@ -502,13 +790,8 @@ func writeFileEntry(destDir, relPath string, entry *fileEntry) error {
 	return nil
 }
 
-// updateUntarProgressWithTotal 更新解压进度（带总数）
-func updateUntarProgressWithTotal(current, total int64, startTime time.Time) {
-	if total == 0 {
-		return
-	}
-	percentage := float64(current) / float64(total) * 100
-
+// updateUntarProgress 更新解压进度（按已读取的 tar 包字节数估算百分比）
+func updateUntarProgress(current, readBytes, totalBytes int64, startTime time.Time) {
 	// 计算每秒文件数
 	elapsed := time.Since(startTime)
 	var filesPerSec float64
@@ -516,6 +799,11 @@ func updateUntarProgressWithTotal(current, total int64, startTime time.Time) {
 		filesPerSec = float64(current) / elapsed.Seconds()
 	}
 
-	fmt.Fprintf(os.Stdout, "\r进度: %d/%d 文件 (%.1f%%) | 速度: %.1f 文件/秒", current, total, percentage, filesPerSec)
+	if totalBytes > 0 {
+		percentage := float64(readBytes) / float64(totalBytes) * 100
+		fmt.Fprintf(os.Stdout, "\r进度: %d 文件 (%.1f%%) | 速度: %.1f 文件/秒", current, percentage, filesPerSec)
+	} else {
+		fmt.Fprintf(os.Stdout, "\r进度: %d 文件 | 速度: %.1f 文件/秒", current, filesPerSec)
+	}
 	os.Stdout.Sync()
 }
@@ -0,0 +1,307 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify <目录> <manifest文件>",
+	Short: "根据 manifest 校验目录内容",
+	Long: `根据 manifest 文件并行校验目录内容是否与生成 manifest 时一致。
+
+校验内容：
+- 缺失的文件：manifest 中列出但目录中不存在
+- 多余的文件：目录中存在但 manifest 中未列出
+- 损坏的文件：类型、大小或内容校验和与 manifest 不一致
+- 无法读取的目录：其中的多余文件无法发现，校验视为失败
+
+manifest 需要使用 manifest --checksum 生成才能校验文件内容，
+否则只校验文件是否存在以及类型和大小。
+
+示例：
+  p-tool manifest /source /tmp/manifest.txt --checksum xxh3
+  p-tool verify /restored /tmp/manifest.txt
+  p-tool verify /restored /tmp/manifest.txt --concurrency 8`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		dirPath := args[0]
+		manifestFile := args[1]
+
+		concurrency, _ := cmd.Flags().GetInt("concurrency")
+
+		// 验证目录
+		dirInfo, err := os.Stat(dirPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 无法访问目录 %s: %v\n", dirPath, err)
+			os.Exit(1)
+		}
+		if !dirInfo.IsDir() {
+			fmt.Fprintf(os.Stderr, "错误: %s 不是一个目录\n", dirPath)
+			os.Exit(1)
+		}
+
+		// 获取目录绝对路径
+		absDirPath, err := filepath.Abs(dirPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 无法获取目录绝对路径: %v\n", err)
+			os.Exit(1)
+		}
+
+		// 读取 manifest 文件
+		fileList, checksumAlgo, err := readManifestWithChecksum(manifestFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 读取 manifest 文件失败: %v\n", err)
+			os.Exit(1)
+		}
+		if checksumAlgo != "" {
+			if _, err := newChecksumHash(checksumAlgo); err != nil {
+				fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+				os.Exit(1)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "警告: manifest 未记录校验和，只校验文件是否存在以及类型和大小\n")
+		}
+
+		// 设置并发数
+		if concurrency <= 0 {
+			concurrency = runtime.NumCPU()
+		}
+
+		fmt.Fprintf(os.Stdout, "开始校验 %d 个文件（并发数: %d）...\n", len(fileList), concurrency)
+
+		result, err := verifyDirectory(absDirPath, fileList, checksumAlgo, concurrency)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\n错误: 校验失败: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(os.Stdout, "\n")
+		printPathList("缺失的文件", result.missing)
+		printPathList("多余的文件", result.extra)
+		printPathList("损坏的文件", result.corrupted)
+		printPathList("无法读取的目录", result.unreadable)
+
+		fmt.Fprintf(os.Stdout, "校验结果: 缺失 %d 个，多余 %d 个，损坏 %d 个，无法读取的目录 %d 个\n",
+			len(result.missing), len(result.extra), len(result.corrupted), len(result.unreadable))
+		if len(result.missing)+len(result.extra)+len(result.corrupted)+len(result.unreadable) > 0 {
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(os.Stdout, "校验通过，目录内容与 manifest 一致！\n")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().Int("concurrency", 0, "指定并发数量，默认为 CPU 核数")
+}
+
+// verifyResult 校验结果
+type verifyResult struct {
+	missing   []string // manifest 中有但目录中不存在
+	extra     []string // 目录中有但 manifest 中不存在
+	corrupted []string // 类型、大小或内容不一致
+
+	unreadable []string // 无法读取的目录，其中的多余文件无法校验
+}
+
+// verifyDirectory 并行校验目录中的文件与 manifest 是否一致
+func verifyDirectory(dirPath string, fileList []ManifestEntry, checksumAlgo string, concurrency int) (*verifyResult, error) {
+	// 扫描目录，用于找出多余的文件
+	// manifest 中记录了符号链接时按链接本身扫描，否则跟随符号链接（与生成 manifest 时一致）
+	scanOpts := ManifestOptions{Concurrency: concurrency}
+	if hasSymlinkEntries(fileList) {
+		scanOpts.Symlinks = symlinksPreserve
+	}
+	// 有目录无法读取时其中的多余文件无法发现，记录这些目录并让校验失败
+	diskList, err := scanDirectory(dirPath, scanOpts)
+	unreadable := unreadableDirs(dirPath, err)
+	if err = warnScanIncomplete(err); err != nil {
+		return nil, err
+	}
+
+	result := &verifyResult{unreadable: unreadable}
+
+	expected := make(map[string]bool, len(fileList))
+	for i := range fileList {
+		expected[fileList[i].Path] = true
+	}
+	for i := range diskList {
+		if !expected[diskList[i].Path] {
+			result.extra = append(result.extra, diskList[i].Path)
+		}
+	}
+
+	totalFiles := int64(len(fileList))
+	var checkedFiles int64
+	var checkedBytes int64
+	totalBytes := manifestTotalSize(fileList)
+
+	startTime := time.Now()
+
+	taskChan := make(chan *ManifestEntry, concurrency*2)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	// 启动进度更新协程
+	progressDone := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				updateProgress(atomic.LoadInt64(&checkedFiles), totalFiles, atomic.LoadInt64(&checkedBytes), totalBytes, startTime)
+			case <-progressDone:
+				return
+			}
+		}
+	}()
+
+	// 启动工作协程
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range taskChan {
+				missing, corrupted, reason := verifyEntry(dirPath, entry, checksumAlgo)
+				if entry.hasMetadata() {
+					atomic.AddInt64(&checkedBytes, entry.Size)
+				}
+
+				mu.Lock()
+				switch {
+				case missing:
+					result.missing = append(result.missing, entry.Path)
+				case corrupted:
+					result.corrupted = append(result.corrupted, entry.Path)
+					fmt.Fprintf(os.Stderr, "警告: 文件不一致 %s: %s\n", entry.Path, reason)
+				}
+				mu.Unlock()
+
+				atomic.AddInt64(&checkedFiles, 1)
+			}
+		}()
+	}
+
+	// 发送任务
+	for i := range fileList {
+		taskChan <- &fileList[i]
+	}
+	close(taskChan)
+
+	// 等待所有协程完成
+	wg.Wait()
+
+	// 停止进度更新协程
+	close(progressDone)
+	time.Sleep(120 * time.Millisecond)
+
+	// 显示最终进度
+	updateProgress(atomic.LoadInt64(&checkedFiles), totalFiles, atomic.LoadInt64(&checkedBytes), totalBytes, startTime)
+
+	// 排序，保证输出稳定
+	sort.Strings(result.missing)
+	sort.Strings(result.extra)
+	sort.Strings(result.corrupted)
+
+	return result, nil
+}
+
+// verifyEntry 校验单个条目，返回是否缺失、是否损坏以及损坏原因
+func verifyEntry(dirPath string, entry *ManifestEntry, checksumAlgo string) (missing, corrupted bool, reason string) {
+	fullPath := filepath.Join(dirPath, entry.Path)
+
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, false, ""
+		}
+		return false, true, err.Error()
+	}
+
+	// 旧格式 manifest 没有元数据，只要存在即可
+	if !entry.hasMetadata() {
+		return false, false, ""
+	}
+
+	// 扫描时会跟随符号链接，因此普通文件条目允许磁盘上是指向文件的符号链接
+	if info.Mode()&os.ModeSymlink != 0 && entry.Type != manifestTypeSymlink {
+		if info, err = os.Stat(fullPath); err != nil {
+			return false, true, err.Error()
+		}
+	}
+
+	switch entry.Type {
+	case manifestTypeSymlink:
+		if info.Mode()&os.ModeSymlink == 0 {
+			return false, true, "不是符号链接"
+		}
+		target, err := os.Readlink(fullPath)
+		if err != nil {
+			return false, true, err.Error()
+		}
+		if target != entry.LinkTarget {
+			return false, true, fmt.Sprintf("符号链接目标不一致: %s != %s", target, entry.LinkTarget)
+		}
+		return false, false, ""
+	case manifestTypeDir:
+		if !info.IsDir() {
+			return false, true, "不是目录"
+		}
+		return false, false, ""
+	case manifestTypeHardlink:
+		targetInfo, err := os.Stat(filepath.Join(dirPath, entry.LinkTarget))
+		if err != nil {
+			return false, true, fmt.Sprintf("硬链接目标不可访问: %v", err)
+		}
+		if !os.SameFile(info, targetInfo) {
+			return false, true, fmt.Sprintf("不是 %s 的硬链接", entry.LinkTarget)
+		}
+		return false, false, ""
+	}
+
+	if !info.Mode().IsRegular() {
+		return false, true, "不是普通文件"
+	}
+	if info.Size() != entry.Size {
+		return false, true, fmt.Sprintf("大小不一致: %d != %d", info.Size(), entry.Size)
+	}
+
+	if checksumAlgo != "" && entry.Checksum != "" {
+		sum, err := hashFile(fullPath, checksumAlgo)
+		if err != nil {
+			return false, true, err.Error()
+		}
+		if sum != entry.Checksum {
+			return false, true, "内容校验和不一致"
+		}
+	}
+
+	return false, false, ""
+}
+
+// printPathList 输出路径列表
+func printPathList(title string, paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stdout, "%s（%d 个）:\n", title, len(paths))
+	for _, p := range paths {
+		fmt.Fprintf(os.Stdout, "  %s\n", formatManifestPath(p))
+	}
+}
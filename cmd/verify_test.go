@@ -0,0 +1,46 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVerifyUnreadableDirectory(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "f"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fileList, err := scanDirectory(root, ManifestOptions{Concurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// manifest 之后新增的目录无法读取，其中的多余文件无法发现
+	locked := filepath.Join(root, "locked")
+	if err := os.Mkdir(locked, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(locked, "extra"), []byte("extra"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0755)
+	if _, err := os.ReadDir(locked); err == nil {
+		t.Skip("当前用户可以读取无权限的目录")
+	}
+
+	result, err := verifyDirectory(root, fileList, "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"locked"}; !reflect.DeepEqual(result.unreadable, want) {
+		t.Errorf("无法读取的目录为 %q，应为 %q", result.unreadable, want)
+	}
+}
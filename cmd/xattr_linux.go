@@ -0,0 +1,65 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyXattrs 将源文件的扩展属性复制到目标文件（不跟随符号链接）
+func copyXattrs(sourcePath, destPath string) error {
+	size, err := unix.Llistxattr(sourcePath, nil)
+	if err != nil {
+		if errors.Is(err, unix.ENOTSUP) {
+			return nil
+		}
+		return fmt.Errorf("读取扩展属性列表失败: %w", err)
+	}
+	if size == 0 {
+		return nil
+	}
+
+	names := make([]byte, size)
+	size, err = unix.Llistxattr(sourcePath, names)
+	if err != nil {
+		return fmt.Errorf("读取扩展属性列表失败: %w", err)
+	}
+
+	for _, name := range strings.Split(string(names[:size]), "\x00") {
+		if name == "" {
+			continue
+		}
+
+		valueSize, err := unix.Lgetxattr(sourcePath, name, nil)
+		if err != nil {
+			return fmt.Errorf("读取扩展属性 %s 失败: %w", name, err)
+		}
+		value := make([]byte, valueSize)
+		if valueSize > 0 {
+			if valueSize, err = unix.Lgetxattr(sourcePath, name, value); err != nil {
+				return fmt.Errorf("读取扩展属性 %s 失败: %w", name, err)
+			}
+		}
+
+		if err := unix.Lsetxattr(destPath, name, value[:valueSize], 0); err != nil {
+			return fmt.Errorf("设置扩展属性 %s 失败: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// lchtimes 设置符号链接本身的修改时间（访问时间保持不变）
+func lchtimes(path string, mtime time.Time) error {
+	ts := []unix.Timespec{
+		{Nsec: unix.UTIME_OMIT},
+		unix.NsecToTimespec(mtime.UnixNano()),
+	}
+	return unix.UtimesNanoAt(unix.AT_FDCWD, path, ts, unix.AT_SYMLINK_NOFOLLOW)
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import "time"
+
+// copyXattrs 在非 Linux 平台上不复制扩展属性
+func copyXattrs(sourcePath, destPath string) error {
+	return nil
+}
+
+// lchtimes 在非 Linux 平台上不设置符号链接本身的时间
+func lchtimes(path string, mtime time.Time) error {
+	return nil
+}
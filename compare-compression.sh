@@ -3,6 +3,12 @@
 # 压缩方式对比脚本
 # 用法: ./compare-compression.sh <要打包的文件夹路径>
 # 功能: 对比不同压缩方式的文件大小和耗时（包括压缩和解压缩）
+#       p-tool 使用内置的压缩实现（tar/untar --compress），不依赖系统的压缩命令；
+#       系统中有对应的命令时，同时检查生成的 tar 包能否被标准工具直接解压
+#
+# 环境变量:
+#   COMPARE_FORMATS   要测试的 p-tool 压缩格式（默认 "none zstd gzip lz4 xz bzip2"）
+#   COMPARE_TAR_ARGS  传给 p-tool tar 的额外参数，例如 "--compress-threads 8 --level 9"
 
 # 检查参数
 if [ $# -ne 1 ]; then
@@ -63,7 +69,10 @@ declare -a METHODS
 declare -a TIMES
 declare -a COMPRESS_FILES
 declare -a UNCOMPRESS_TIMES
-declare -a USE_ZSTD_FLAGS
+
+# 要测试的压缩格式和传给 p-tool tar 的额外参数
+FORMATS="${COMPARE_FORMATS:-none zstd gzip lz4 xz bzip2}"
+TAR_ARGS="${COMPARE_TAR_ARGS:-}"
 
 # 测试计数器
 TEST_NUM=0
@@ -71,10 +80,9 @@ TOTAL_TESTS=0
 
 # 计算总测试数
 if [ "$SKIP_PTOOL" = false ]; then
-    TOTAL_TESTS=$((TOTAL_TESTS + 1))  # p-tool tar-multi
-    if [ "$TAR_SUPPORTS_ZSTD" = true ]; then
-        TOTAL_TESTS=$((TOTAL_TESTS + 1))  # p-tool tar-multi --zstd
-    fi
+    for format in $FORMATS; do
+        TOTAL_TESTS=$((TOTAL_TESTS + 1))  # p-tool tar --compress <格式>
+    done
 fi
 TOTAL_TESTS=$((TOTAL_TESTS + 1))  # 系统 tar (无压缩)
 if [ "$TAR_SUPPORTS_ZSTD" = true ]; then
@@ -140,108 +148,75 @@ get_timestamp() {
     fi
 }
 
-# 测试 1: p-tool tar-multi
+# 函数：与压缩格式对应的系统解压命令，用于检查 tar 包能否被标准工具解压
+decompress_cmd() {
+    case $1 in
+        zstd) echo "zstd -dcq" ;;
+        gzip) echo "gzip -dc" ;;
+        lz4) echo "lz4 -dc" ;;
+        xz) echo "xz -dc" ;;
+        bzip2) echo "bzip2 -dc" ;;
+    esac
+}
+
+# 测试 1: p-tool tar / untar 使用内置实现的各种压缩格式
 if [ "$SKIP_PTOOL" = false ]; then
-    TEST_NUM=$((TEST_NUM + 1))
-    echo "[$TEST_NUM/$TOTAL_TESTS] 测试 p-tool tar-multi..."
-    OUTPUT_DIR="$TEMP_DIR/ptool-tar-multi"
-    mkdir -p "$OUTPUT_DIR"
-    START_TIME=$(get_timestamp)
-    if $PTOOL_CMD tar-multi "$SOURCE_DIR" "$OUTPUT_DIR" 2>/dev/null; then
-        END_TIME=$(get_timestamp)
-        ELAPSED=$(awk "BEGIN {printf \"%.3f\", $END_TIME - $START_TIME}")
-        # 计算所有 tar 文件的总大小
-        SIZE=0
-        for tar_file in "$OUTPUT_DIR"/part-*.tar; do
-            if [ -f "$tar_file" ]; then
-                file_size=$(get_file_size "$tar_file")
-                SIZE=$((SIZE + file_size))
-            fi
-        done
-        RESULTS+=("$SIZE")
-        TIMES+=("$ELAPSED")
-        COMPRESS_FILES+=("$OUTPUT_DIR")
-        USE_ZSTD_FLAGS+=("false")
-        METHODS+=("p-tool tar-multi")
-        echo "  ✓ 压缩完成: $(format_size $SIZE) | 耗时: $(format_time $ELAPSED)"
-        
-        # 测试解压缩
-        echo "  测试解压缩..."
-        EXTRACT_DIR="$TEMP_DIR/extract-ptool-tar-multi"
-        mkdir -p "$EXTRACT_DIR"
+    for format in $FORMATS; do
+        TEST_NUM=$((TEST_NUM + 1))
+        METHOD="p-tool tar --compress $format"
+        echo "[$TEST_NUM/$TOTAL_TESTS] 测试 $METHOD..."
+        OUTPUT_FILE="$TEMP_DIR/ptool-$format.tar"
         START_TIME=$(get_timestamp)
-        if $PTOOL_CMD untar-multi "$OUTPUT_DIR" "$EXTRACT_DIR" 2>/dev/null; then
+        if $PTOOL_CMD tar "$SOURCE_DIR" "$OUTPUT_FILE" --compress "$format" $TAR_ARGS > /dev/null 2>&1; then
             END_TIME=$(get_timestamp)
-            UNCOMPRESS_ELAPSED=$(awk "BEGIN {printf \"%.3f\", $END_TIME - $START_TIME}")
-            UNCOMPRESS_TIMES+=("$UNCOMPRESS_ELAPSED")
-            echo "  ✓ 解压完成: 耗时: $(format_time $UNCOMPRESS_ELAPSED)"
-        else
-            UNCOMPRESS_TIMES+=("0")
-            echo "  ✗ 解压失败"
-        fi
-        rm -rf "$EXTRACT_DIR"
-    else
-        RESULTS+=("0")
-        TIMES+=("0")
-        COMPRESS_FILES+=("")
-        USE_ZSTD_FLAGS+=("false")
-        UNCOMPRESS_TIMES+=("0")
-        METHODS+=("p-tool tar-multi")
-        echo "  ✗ 失败"
-    fi
-    echo ""
-fi
+            ELAPSED=$(awk "BEGIN {printf \"%.3f\", $END_TIME - $START_TIME}")
+            SIZE=$(get_file_size "$OUTPUT_FILE")
+            RESULTS+=("$SIZE")
+            TIMES+=("$ELAPSED")
+            COMPRESS_FILES+=("$OUTPUT_FILE")
+            METHODS+=("$METHOD")
+            echo "  ✓ 压缩完成: $(format_size $SIZE) | 耗时: $(format_time $ELAPSED)"
 
-# 测试 1.5: p-tool tar-multi --zstd (如果系统 tar 支持 zstd)
-if [ "$SKIP_PTOOL" = false ] && [ "$TAR_SUPPORTS_ZSTD" = true ]; then
-    TEST_NUM=$((TEST_NUM + 1))
-    echo "[$TEST_NUM/$TOTAL_TESTS] 测试 p-tool tar-multi --zstd..."
-    OUTPUT_DIR="$TEMP_DIR/ptool-tar-multi-zstd"
-    mkdir -p "$OUTPUT_DIR"
-    START_TIME=$(get_timestamp)
-    if $PTOOL_CMD tar-multi "$SOURCE_DIR" "$OUTPUT_DIR" --zstd 2>/dev/null; then
-        END_TIME=$(get_timestamp)
-        ELAPSED=$(awk "BEGIN {printf \"%.3f\", $END_TIME - $START_TIME}")
-        # 计算所有 tar.zst 文件的总大小
-        SIZE=0
-        for tar_file in "$OUTPUT_DIR"/part-*.tar.zst; do
-            if [ -f "$tar_file" ]; then
-                file_size=$(get_file_size "$tar_file")
-                SIZE=$((SIZE + file_size))
+            # 检查标准工具能否直接解压
+            CHECK_CMD=$(decompress_cmd "$format")
+            if [ -n "$CHECK_CMD" ] && command -v "${CHECK_CMD%% *}" &> /dev/null; then
+                if $CHECK_CMD "$OUTPUT_FILE" 2>/dev/null | tar -tf - > /dev/null 2>&1; then
+                    echo "  ✓ 可以使用 ${CHECK_CMD%% *} 直接解压"
+                else
+                    echo "  ✗ ${CHECK_CMD%% *} 无法解压"
+                fi
             fi
-        done
-        RESULTS+=("$SIZE")
-        TIMES+=("$ELAPSED")
-        COMPRESS_FILES+=("$OUTPUT_DIR")
-        USE_ZSTD_FLAGS+=("true")
-        METHODS+=("p-tool tar-multi --zstd")
-        echo "  ✓ 压缩完成: $(format_size $SIZE) | 耗时: $(format_time $ELAPSED)"
-        
-        # 测试解压缩
-        echo "  测试解压缩..."
-        EXTRACT_DIR="$TEMP_DIR/extract-ptool-tar-multi-zstd"
-        mkdir -p "$EXTRACT_DIR"
-        START_TIME=$(get_timestamp)
-        if $PTOOL_CMD untar-multi "$OUTPUT_DIR" "$EXTRACT_DIR" --zstd 2>/dev/null; then
-            END_TIME=$(get_timestamp)
-            UNCOMPRESS_ELAPSED=$(awk "BEGIN {printf \"%.3f\", $END_TIME - $START_TIME}")
-            UNCOMPRESS_TIMES+=("$UNCOMPRESS_ELAPSED")
-            echo "  ✓ 解压完成: 耗时: $(format_time $UNCOMPRESS_ELAPSED)"
+
+            # 测试解压缩，并与源目录比较
+            echo "  测试解压缩..."
+            EXTRACT_DIR="$TEMP_DIR/extract-ptool-$format"
+            mkdir -p "$EXTRACT_DIR"
+            START_TIME=$(get_timestamp)
+            if $PTOOL_CMD untar "$OUTPUT_FILE" "$EXTRACT_DIR" --compress "$format" > /dev/null 2>&1; then
+                END_TIME=$(get_timestamp)
+                UNCOMPRESS_ELAPSED=$(awk "BEGIN {printf \"%.3f\", $END_TIME - $START_TIME}")
+                UNCOMPRESS_TIMES+=("$UNCOMPRESS_ELAPSED")
+                if diff -r "$SOURCE_DIR" "$EXTRACT_DIR" > /dev/null 2>&1; then
+                    echo "  ✓ 解压完成: 耗时: $(format_time $UNCOMPRESS_ELAPSED)"
+                else
+                    echo "  ✗ 解压完成，但内容与源目录不一致"
+                fi
+            else
+                UNCOMPRESS_TIMES+=("0")
+                echo "  ✗ 解压失败"
+            fi
+            rm -rf "$EXTRACT_DIR"
+            rm -f "$OUTPUT_FILE"
         else
+            RESULTS+=("0")
+            TIMES+=("0")
+            COMPRESS_FILES+=("")
             UNCOMPRESS_TIMES+=("0")
-            echo "  ✗ 解压失败"
+            METHODS+=("$METHOD")
+            echo "  ✗ 失败"
         fi
-        rm -rf "$EXTRACT_DIR"
-    else
-        RESULTS+=("0")
-        TIMES+=("0")
-        COMPRESS_FILES+=("")
-        USE_ZSTD_FLAGS+=("true")
-        UNCOMPRESS_TIMES+=("0")
-        METHODS+=("p-tool tar-multi --zstd")
-        echo "  ✗ 失败"
-    fi
-    echo ""
+        echo ""
+    done
 fi
 
 # 测试 2: 系统 tar (不加压缩)
@@ -256,7 +231,6 @@ if tar -cf "$OUTPUT_FILE" -C "$(dirname "$SOURCE_DIR")" "$DIR_NAME" 2>/dev/null;
     RESULTS+=("$SIZE")
     TIMES+=("$ELAPSED")
     COMPRESS_FILES+=("$OUTPUT_FILE")
-    USE_ZSTD_FLAGS+=("false")
     METHODS+=("系统 tar (无压缩)")
     echo "  ✓ 压缩完成: $(format_size $SIZE) | 耗时: $(format_time $ELAPSED)"
     
@@ -279,7 +253,6 @@ else
     RESULTS+=("0")
     TIMES+=("0")
     COMPRESS_FILES+=("")
-    USE_ZSTD_FLAGS+=("false")
     UNCOMPRESS_TIMES+=("0")
     METHODS+=("系统 tar (无压缩)")
     echo "  ✗ 失败"
@@ -299,7 +272,6 @@ if [ "$TAR_SUPPORTS_ZSTD" = true ]; then
         RESULTS+=("$SIZE")
         TIMES+=("$ELAPSED")
         COMPRESS_FILES+=("$OUTPUT_FILE")
-        USE_ZSTD_FLAGS+=("true")
         METHODS+=("系统 tar (zstd)")
         echo "  ✓ 压缩完成: $(format_size $SIZE) | 耗时: $(format_time $ELAPSED)"
         
@@ -322,8 +294,7 @@ if [ "$TAR_SUPPORTS_ZSTD" = true ]; then
         RESULTS+=("0")
         TIMES+=("0")
         COMPRESS_FILES+=("")
-        USE_ZSTD_FLAGS+=("false")
-        UNCOMPRESS_TIMES+=("0")
+            UNCOMPRESS_TIMES+=("0")
         METHODS+=("系统 tar (zstd)")
         echo "  ✗ 失败"
     fi
@@ -341,30 +312,6 @@ printf "%-30s %18s %18s %18s\n" "压缩方式" "文件大小" "压缩耗时" "
 echo "------------------------------------------"
 
 # 找到最小的文件大小和最快的时间作为基准
-# 首先处理 tar-multi 的特殊情况，确保所有文件大小都被正确计算
-for i in "${!METHODS[@]}"; do
-    METHOD="${METHODS[$i]}"
-    if [ "$METHOD" = "p-tool tar-multi" ] && [ -d "${COMPRESS_FILES[$i]}" ]; then
-        SIZE=0
-        for tar_file in "${COMPRESS_FILES[$i]}"/part-*.tar; do
-            if [ -f "$tar_file" ]; then
-                file_size=$(get_file_size "$tar_file")
-                SIZE=$((SIZE + file_size))
-            fi
-        done
-        RESULTS[$i]=$SIZE
-    elif [ "$METHOD" = "p-tool tar-multi --zstd" ] && [ -d "${COMPRESS_FILES[$i]}" ]; then
-        SIZE=0
-        for tar_file in "${COMPRESS_FILES[$i]}"/part-*.tar.zst; do
-            if [ -f "$tar_file" ]; then
-                file_size=$(get_file_size "$tar_file")
-                SIZE=$((SIZE + file_size))
-            fi
-        done
-        RESULTS[$i]=$SIZE
-    fi
-done
-
 MIN_SIZE=0
 MIN_COMPRESS_TIME=0
 MIN_UNCOMPRESS_TIME=0
@@ -394,28 +341,7 @@ for i in "${!METHODS[@]}"; do
     COMPRESS_TIME="${TIMES[$i]}"
     UNCOMPRESS_TIME="${UNCOMPRESS_TIMES[$i]}"
     METHOD="${METHODS[$i]}"
-    
-    # 对于 tar-multi，需要特殊处理文件大小计算（它生成的是目录）
-    if [ "$METHOD" = "p-tool tar-multi" ] && [ -d "${COMPRESS_FILES[$i]}" ]; then
-        SIZE=0
-        for tar_file in "${COMPRESS_FILES[$i]}"/part-*.tar; do
-            if [ -f "$tar_file" ]; then
-                file_size=$(get_file_size "$tar_file")
-                SIZE=$((SIZE + file_size))
-            fi
-        done
-        RESULTS[$i]=$SIZE
-    elif [ "$METHOD" = "p-tool tar-multi --zstd" ] && [ -d "${COMPRESS_FILES[$i]}" ]; then
-        SIZE=0
-        for tar_file in "${COMPRESS_FILES[$i]}"/part-*.tar.zst; do
-            if [ -f "$tar_file" ]; then
-                file_size=$(get_file_size "$tar_file")
-                SIZE=$((SIZE + file_size))
-            fi
-        done
-        RESULTS[$i]=$SIZE
-    fi
-    
+
     if [ $SIZE -gt 0 ] && awk "BEGIN {exit !($COMPRESS_TIME > 0)}" 2>/dev/null; then
         SIZE_FORMATTED=$(format_size $SIZE)
         COMPRESS_TIME_FORMATTED=$(format_time $COMPRESS_TIME)
@@ -2,10 +2,17 @@ module github.com/mywsq/p-tool
 
 go 1.25.3
 
-require github.com/spf13/cobra v1.10.1
+require (
+	github.com/klauspost/compress v1.18.1
+	github.com/spf13/cobra v1.10.1
+	github.com/ulikunitz/xz v0.5.9
+	github.com/zeebo/blake3 v0.2.4
+	github.com/zeebo/xxh3 v1.1.0
+	golang.org/x/sys v0.30.0
+)
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/klauspost/compress v1.18.1 // indirect
+	github.com/klauspost/cpuid/v2 v2.2.10 // indirect
 	github.com/spf13/pflag v1.0.10 // indirect
 )